@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"file-agent/internal/analytics"
+	"file-agent/internal/handlers"
+	"file-agent/internal/scanner"
+	"file-agent/internal/storage"
+)
+
+// commandEnv зависимости административных команд
+type commandEnv struct {
+	storage      *storage.S3Storage
+	internalPort string // Внутренний порт работающего сервиса
+}
+
+// runCommand выполняет административную команду вместо запуска сервера:
+//
+//	file-agent rescan [id...]        - повторная антивирусная проверка файлов работающим сервисом
+//	file-agent rebuild-analytics     - пересчет сохраненной статистики по всем файлам
+func runCommand(env commandEnv, name string, args []string) error {
+	ctx := context.Background()
+
+	switch name {
+	case "rescan":
+		return requestRescan(ctx, env.internalPort, args)
+
+	case "rebuild-analytics":
+		summary, requested, err := analytics.Rebuild(ctx, env.storage)
+		if err != nil {
+			return err
+		}
+		if requested {
+			log.Printf("Analytics are maintained by a running instance, rebuild requested")
+			return nil
+		}
+		log.Printf("Analytics rebuilt: %d files, %s", summary.TotalFiles, analytics.FormatSize(summary.TotalSize))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// requestRescan запускает повторную проверку в работающем сервисе через
+// внутренний порт: метаданные обновляет сам сервис, а не отдельный процесс
+func requestRescan(ctx context.Context, internalPort string, fileIDs []string) error {
+	if internalPort == "" {
+		return fmt.Errorf("INTERNAL_PORT is not configured")
+	}
+
+	body, err := json.Marshal(handlers.RescanRequest{FileIDs: fileIDs})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("http://127.0.0.1:%s/scan/rescan", internalPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		log.Printf("Rescan started, progress: GET %s", url)
+		return nil
+	case http.StatusConflict:
+		var status scanner.RescanStatus
+		json.NewDecoder(resp.Body).Decode(&status)
+		return fmt.Errorf("rescan is already running since %v", status.StartedAt)
+	default:
+		var response handlers.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+		return fmt.Errorf("service returned %s: %s", resp.Status, response.Error)
+	}
+}
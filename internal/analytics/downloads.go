@@ -0,0 +1,255 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+// downloadsPrefix префикс журнала скачиваний: downloads/{YYYY-MM-DD}/{время}.ndjson
+const downloadsPrefix = "downloads/"
+
+// DownloadEvent запись о скачивании файла
+type DownloadEvent struct {
+	FileID     string    `json:"file_id"`
+	Filename   string    `json:"filename"`
+	UploadedBy string    `json:"uploaded_by"`          // Автор загрузки файла (для статистики по пользователям)
+	Downloader string    `json:"downloader,omitempty"` // Аутентифицированный пользователь, скачавший файл
+	Time       time.Time `json:"time"`
+	Bytes      int64     `json:"bytes"`
+	Completed  bool      `json:"completed"` // false - клиент прервал скачивание
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+}
+
+// DownloadCounters счетчики скачиваний
+type DownloadCounters struct {
+	Count     int64 `json:"count"`
+	Completed int64 `json:"completed"`
+	Aborted   int64 `json:"aborted"` // Клиент прервал скачивание
+	BytesSent int64 `json:"bytes_sent"`
+}
+
+// DownloadStats статистика скачиваний файла
+type DownloadStats struct {
+	Filename string `json:"filename"`
+	DownloadCounters
+	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+}
+
+// DownloaderStats исходящий трафик пользователя, скачивавшего файлы
+type DownloaderStats struct {
+	Downloader string `json:"downloader"`
+	DownloadCounters
+}
+
+// FileDownloads статистика скачиваний с идентификатором файла
+type FileDownloads struct {
+	FileID string `json:"file_id"`
+	DownloadStats
+}
+
+// AddDownload учитывает скачивание в счетчиках файла, автора загрузки,
+// скачавшего пользователя и почасовом исходящем трафике
+func (s *Summary) AddDownload(event DownloadEvent) {
+	update(s.Egress, event.Time.Unix()/3600, 1, event.Bytes)
+
+	downloader := event.Downloader
+	if downloader == "" {
+		downloader = "anonymous"
+	}
+	counters, ok := s.Downloaders[downloader]
+	if !ok {
+		counters = &DownloadCounters{}
+		s.Downloaders[downloader] = counters
+	}
+	counters.add(event)
+
+	uploader := event.UploadedBy
+	if uploader == "" {
+		uploader = "anonymous"
+	}
+	user := s.user(uploader)
+	user.Downloads++
+	user.EgressBytes += event.Bytes
+
+	stats, ok := s.Downloads[event.FileID]
+	if !ok {
+		stats = &DownloadStats{}
+		s.Downloads[event.FileID] = stats
+	}
+	stats.Filename = event.Filename
+	stats.add(event)
+	if stats.LastAccessed == nil || event.Time.After(*stats.LastAccessed) {
+		accessed := event.Time
+		stats.LastAccessed = &accessed
+	}
+}
+
+// add учитывает скачивание в счетчиках
+func (c *DownloadCounters) add(event DownloadEvent) {
+	c.Count++
+	c.BytesSent += event.Bytes
+	if event.Completed {
+		c.Completed++
+	} else {
+		c.Aborted++
+	}
+}
+
+// EgressSince возвращает количество скачиваний и отправленные байты
+// начиная с часа, содержащего since
+func (s *Summary) EgressSince(since time.Time) Breakdown {
+	return sumSince(s.Egress, since)
+}
+
+// MostDownloaded возвращает limit файлов с наибольшим числом скачиваний.
+// У снимка статистики они предрассчитаны (см. Store.Summary)
+func (s *Summary) MostDownloaded(limit int) []FileDownloads {
+	if s.mostDownloaded != nil && limit <= topLimit {
+		return s.mostDownloaded[:min(limit, len(s.mostDownloaded))]
+	}
+	return mostDownloaded(s.Downloads, limit)
+}
+
+// mostDownloaded выбирает limit файлов с наибольшим числом скачиваний
+func mostDownloaded(downloads map[string]*DownloadStats, limit int) []FileDownloads {
+	files := make([]FileDownloads, 0, len(downloads))
+	for fileID, stats := range downloads {
+		files = append(files, FileDownloads{FileID: fileID, DownloadStats: *stats})
+	}
+
+	sortDownloads(files)
+
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files
+}
+
+// sortDownloads сортирует файлы по убыванию числа скачиваний и отправленных байт
+func sortDownloads(files []FileDownloads) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Count != files[j].Count {
+			return files[i].Count > files[j].Count
+		}
+		return files[i].BytesSent > files[j].BytesSent
+	})
+}
+
+// TopDownloaders возвращает limit пользователей с наибольшим исходящим
+// трафиком. У снимка статистики они предрассчитаны (см. Store.Summary)
+func (s *Summary) TopDownloaders(limit int) []DownloaderStats {
+	if s.topDownloaders != nil && limit <= topLimit {
+		return s.topDownloaders[:min(limit, len(s.topDownloaders))]
+	}
+
+	downloaders := make([]DownloaderStats, 0, len(s.Downloaders))
+	for downloader, counters := range s.Downloaders {
+		downloaders = append(downloaders, DownloaderStats{Downloader: downloader, DownloadCounters: *counters})
+	}
+
+	sort.Slice(downloaders, func(i, j int) bool {
+		if downloaders[i].BytesSent != downloaders[j].BytesSent {
+			return downloaders[i].BytesSent > downloaders[j].BytesSent
+		}
+		return downloaders[i].Downloader < downloaders[j].Downloader
+	})
+
+	if len(downloaders) > limit {
+		downloaders = downloaders[:limit]
+	}
+	return downloaders
+}
+
+// saveDownloadEvents дописывает события в журнал скачиваний отдельным
+// объектом и возвращает его ключ. Ключи объектов возрастают со временем.
+// source - имя объекта изменений ведомого, из которого взяты события
+// (пусто для скачиваний самого экземпляра); оно сохраняется в ключе
+func saveDownloadEvents(ctx context.Context, s3Storage *storage.S3Storage, events []DownloadEvent, source string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return "", fmt.Errorf("failed to marshal download event: %w", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%d.ndjson", downloadsPrefix, now.Format("2006-01-02"), now.UnixNano())
+	if source != "" {
+		key = fmt.Sprintf("%s%s/%d_%s.ndjson", downloadsPrefix, now.Format("2006-01-02"), now.UnixNano(), source)
+	}
+	if err := s3Storage.PutObject(ctx, key, buf.Bytes(), "application/x-ndjson"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// downloadSource возвращает имя объекта изменений, из которого записан
+// объект журнала, или пустую строку
+func downloadSource(key string) string {
+	name := strings.TrimSuffix(path.Base(key), ".ndjson")
+	if _, source, ok := strings.Cut(name, "_"); ok {
+		return source
+	}
+	return ""
+}
+
+// loadDownloadEvents читает журнал скачиваний, записанный после объекта
+// after (пустой after - весь журнал), и передает события в fn. Возвращает
+// ключи прочитанных объектов по возрастанию
+func loadDownloadEvents(ctx context.Context, s3Storage *storage.S3Storage, after string, fn func(DownloadEvent)) ([]string, error) {
+	keys, err := s3Storage.ListKeysAfter(ctx, downloadsPrefix, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var read []string
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".ndjson") {
+			continue
+		}
+
+		reader, _, err := s3Storage.GetObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			var event DownloadEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				log.Printf("Skipping invalid download event in %s: %v", key, err)
+				continue
+			}
+			fn(event)
+		}
+		err = scanner.Err()
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		read = append(read, key)
+	}
+
+	return read, nil
+}
+
+// lastKey возвращает последний из прочитанных ключей или after
+func lastKey(keys []string, after string) string {
+	if len(keys) == 0 {
+		return after
+	}
+	return keys[len(keys)-1]
+}
@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"file-agent/internal/storage"
+)
+
+// forward передает ведущему изменения ведомого отдельным объектом изменений
+func (s *Store) forward(ctx context.Context) error {
+	s.mu.Lock()
+	changes := s.outbox
+	s.outbox = nil
+	s.mu.Unlock()
+
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := saveChanges(ctx, s.storage, s.owner, changes); err != nil {
+		s.mu.Lock()
+		s.outbox = append(changes, s.outbox...)
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// reload обновляет статистику ведомого из бакета: загружает статистику
+// заново, если ведущий сохранил новую, и дочитывает журнал скачиваний.
+// Изменения, еще не переданные ведущему, остаются учтенными
+func (s *Store) reload(ctx context.Context) error {
+	info, err := s.storage.StatObject(ctx, aggregatesKey)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		// Ведущий еще не рассчитал статистику
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	version, through := s.version, s.through
+	s.mu.RUnlock()
+
+	if info.ETag == version {
+		var events []DownloadEvent
+		keys, err := loadDownloadEvents(ctx, s.storage, through, func(event DownloadEvent) {
+			events = append(events, event)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load download events: %w", err)
+		}
+
+		s.mu.Lock()
+		for _, event := range events {
+			s.summary.AddDownload(event)
+			s.updateTop(event.FileID)
+			s.changed = true
+		}
+		s.through = lastKey(keys, through)
+		s.mu.Unlock()
+		return nil
+	}
+
+	var saved aggregates
+	if err := s.storage.GetJSON(ctx, aggregatesKey, &saved); err != nil {
+		return err
+	}
+	if saved.Version != aggregatesVersion {
+		log.Printf("Analytics aggregates have format version %d instead of %d, waiting for the leader", saved.Version, aggregatesVersion)
+		return nil
+	}
+
+	summary := saved.Summary.normalize()
+	keys, err := loadDownloadEvents(ctx, s.storage, saved.DownloadsThrough, summary.AddDownload)
+	if err != nil {
+		return fmt.Errorf("failed to load download events: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = summary
+	s.rebuiltAt = saved.RebuiltAt
+	s.through = lastKey(keys, saved.DownloadsThrough)
+	s.version = info.ETag
+	s.reset()
+	for _, c := range s.outbox {
+		s.apply(c)
+	}
+	return nil
+}
+
+// stepDown переводит ведущего в ведомые. Изменения файлов, не вошедшие в
+// сохраненную статистику, и скачивания, не записанные в журнал, будут
+// переданы новому ведущему; статистика загружается заново при следующем
+// обновлении
+func (s *Store) stepDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outbox := s.unsaved
+	for _, event := range s.pending {
+		event := event
+		outbox = append(outbox, change{Download: &event})
+	}
+	s.outbox = append(outbox, s.outbox...)
+	s.leader = false
+	s.unsaved = nil
+	s.pending = nil
+	s.applied = nil
+	s.dirty = false
+	s.version = ""
+}
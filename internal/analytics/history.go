@@ -0,0 +1,273 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+// historyPrefix префикс ежедневных снимков: analytics/history/{YYYY-MM-DD}.json
+const historyPrefix = "analytics/history/"
+
+// SnapshotCheckInterval период проверки, сохранен ли снимок за текущий день
+const SnapshotCheckInterval = time.Hour
+
+// dateLayout формат даты снимка
+const dateLayout = "2006-01-02"
+
+// Snapshot состояние хранилища за день (UTC)
+type Snapshot struct {
+	Date       string                `json:"date"`
+	TakenAt    time.Time             `json:"taken_at"`
+	TotalFiles int64                 `json:"total_files"`
+	TotalSize  int64                 `json:"total_size"`
+	Users      map[string]*Breakdown `json:"users"`
+	Types      map[string]*Breakdown `json:"types"`
+}
+
+// Growth средний прирост за день по линейной регрессии
+type Growth struct {
+	FilesPerDay float64 `json:"files_per_day"`
+	BytesPerDay float64 `json:"bytes_per_day"`
+}
+
+// History сохраняет ежедневные снимки статистики и читает их для отчетов.
+// Прошедшие дни не изменяются, поэтому их снимки кэшируются в памяти
+type History struct {
+	storage    *storage.S3Storage
+	aggregates *Store
+
+	mu    sync.Mutex
+	cache map[string]*Snapshot
+	saved string // Дата последнего сохраненного снимка
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewHistory создает историю снимков статистики из aggregates
+func NewHistory(s3Storage *storage.S3Storage, aggregates *Store) *History {
+	return &History{
+		storage:    s3Storage,
+		aggregates: aggregates,
+		cache:      make(map[string]*Snapshot),
+	}
+}
+
+// Start запускает планировщик: снимок за текущий день сохраняется при
+// запуске и при первой проверке после полуночи UTC
+func (h *History) Start() {
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+
+	go func() {
+		defer close(h.done)
+
+		ticker := time.NewTicker(SnapshotCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := h.ensureSnapshot(context.Background(), time.Now().UTC()); err != nil {
+				log.Printf("Failed to save analytics snapshot: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает планировщик
+func (h *History) Stop() {
+	if h.stop != nil {
+		close(h.stop)
+		<-h.done
+	}
+}
+
+// ensureSnapshot сохраняет снимок за день now, если его еще нет
+func (h *History) ensureSnapshot(ctx context.Context, now time.Time) error {
+	date := now.Format(dateLayout)
+
+	h.mu.Lock()
+	saved := h.saved
+	h.mu.Unlock()
+	if saved == date {
+		return nil
+	}
+
+	var existing Snapshot
+	err := h.storage.GetJSON(ctx, snapshotKey(date), &existing)
+	if err == nil {
+		h.markSaved(date)
+		return nil
+	}
+	if !errors.Is(err, storage.ErrObjectNotFound) {
+		return err
+	}
+
+	summary := h.aggregates.Summary()
+	snapshot := &Snapshot{
+		Date:       date,
+		TakenAt:    now,
+		TotalFiles: summary.TotalFiles,
+		TotalSize:  summary.TotalSize,
+		Users:      make(map[string]*Breakdown, len(summary.Users)),
+		Types:      summary.Types,
+	}
+	for user, stats := range summary.Users {
+		total := stats.Breakdown
+		snapshot.Users[user] = &total
+	}
+
+	if err := h.storage.PutJSON(ctx, snapshotKey(date), snapshot); err != nil {
+		return err
+	}
+
+	h.markSaved(date)
+	log.Printf("Saved analytics snapshot for %s: %d files, %s", date, snapshot.TotalFiles, FormatSize(snapshot.TotalSize))
+	return nil
+}
+
+// markSaved запоминает дату последнего сохраненного снимка
+func (h *History) markSaved(date string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.saved = date
+}
+
+// Snapshots возвращает снимки за даты [from, to] в хронологическом порядке
+func (h *History) Snapshots(ctx context.Context, from, to time.Time) ([]*Snapshot, error) {
+	first, last := from.UTC().Format(dateLayout), to.UTC().Format(dateLayout)
+	today := time.Now().UTC().Format(dateLayout)
+
+	keys, err := h.storage.ListKeys(ctx, historyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, key := range keys {
+		date := strings.TrimSuffix(strings.TrimPrefix(key, historyPrefix), ".json")
+		if date < first || date > last {
+			continue
+		}
+
+		h.mu.Lock()
+		snapshot, ok := h.cache[date]
+		h.mu.Unlock()
+
+		if !ok {
+			snapshot = &Snapshot{}
+			if err := h.storage.GetJSON(ctx, key, snapshot); err != nil {
+				return nil, fmt.Errorf("failed to load snapshot %s: %w", date, err)
+			}
+			if date < today {
+				h.mu.Lock()
+				h.cache[date] = snapshot
+				h.mu.Unlock()
+			}
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Date < snapshots[j].Date
+	})
+
+	return snapshots, nil
+}
+
+// Downsample оставляет последний снимок каждого интервала (week, month);
+// для day снимки возвращаются без изменений
+func Downsample(snapshots []*Snapshot, granularity string) []*Snapshot {
+	if granularity == GranularityDay {
+		return snapshots
+	}
+
+	var result []*Snapshot
+	var current time.Time
+	for _, snapshot := range snapshots {
+		date, err := time.Parse(dateLayout, snapshot.Date)
+		if err != nil {
+			continue
+		}
+		start := truncate(date, granularity)
+		if len(result) > 0 && start.Equal(current) {
+			result[len(result)-1] = snapshot
+			continue
+		}
+		current = start
+		result = append(result, snapshot)
+	}
+
+	return result
+}
+
+// EstimateGrowth вычисляет средний прирост файлов и байт за день методом
+// наименьших квадратов. Для оценки нужно не меньше двух снимков
+func EstimateGrowth(snapshots []*Snapshot) (Growth, bool) {
+	var n, sumX, sumFiles, sumBytes, sumXX, sumXFiles, sumXBytes float64
+	for _, snapshot := range snapshots {
+		date, err := time.Parse(dateLayout, snapshot.Date)
+		if err != nil {
+			continue
+		}
+		x := float64(date.Unix()) / 86400
+		n++
+		sumX += x
+		sumXX += x * x
+		sumFiles += float64(snapshot.TotalFiles)
+		sumBytes += float64(snapshot.TotalSize)
+		sumXFiles += x * float64(snapshot.TotalFiles)
+		sumXBytes += x * float64(snapshot.TotalSize)
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return Growth{}, false
+	}
+
+	return Growth{
+		FilesPerDay: (n*sumXFiles - sumX*sumFiles) / denominator,
+		BytesPerDay: (n*sumXBytes - sumX*sumBytes) / denominator,
+	}, true
+}
+
+// ForecastCapacity оценивает, когда общий объем достигнет capacity при
+// текущем приросте. Возвращает false, если объем не растет
+func ForecastCapacity(last *Snapshot, growth Growth, capacity int64) (time.Time, bool) {
+	date, err := time.Parse(dateLayout, last.Date)
+	if err != nil {
+		return time.Time{}, false
+	}
+	remaining := capacity - last.TotalSize
+	if remaining <= 0 {
+		return date, true
+	}
+	if growth.BytesPerDay <= 0 {
+		return time.Time{}, false
+	}
+
+	days := float64(remaining) / growth.BytesPerDay
+	if days > 100*365 {
+		return time.Time{}, false
+	}
+	return date.Add(time.Duration(days * float64(24*time.Hour))).Truncate(time.Hour), true
+}
+
+// snapshotKey возвращает ключ снимка за дату
+func snapshotKey(date string) string {
+	return historyPrefix + date + ".json"
+}
@@ -0,0 +1,141 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+// inboxPrefix префикс изменений, переданных ведомыми экземплярами ведущему:
+// analytics/inbox/{время}-{экземпляр}.ndjson
+const inboxPrefix = "analytics/inbox/"
+
+// change изменение статистики: загрузка, изменение или удаление файла
+// либо скачивание. Ведомые экземпляры передают изменения ведущему
+type change struct {
+	Removed  *storage.FileMetadata `json:"removed,omitempty"`  // Учтенная версия файла
+	Added    *storage.FileMetadata `json:"added,omitempty"`    // Новая версия файла
+	Upload   bool                  `json:"upload,omitempty"`   // Added - принятая загрузка (для квот)
+	Download *DownloadEvent        `json:"download,omitempty"` // Скачивание файла
+}
+
+// saveChanges записывает изменения ведомого отдельным объектом
+func saveChanges(ctx context.Context, s3Storage *storage.S3Storage, owner string, changes []change) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, c := range changes {
+		if err := encoder.Encode(c); err != nil {
+			return fmt.Errorf("failed to marshal analytics change: %w", err)
+		}
+	}
+
+	key := fmt.Sprintf("%s%d-%s.ndjson", inboxPrefix, time.Now().UTC().UnixNano(), owner)
+	return s3Storage.PutObject(ctx, key, buf.Bytes(), "application/x-ndjson")
+}
+
+// loadChanges читает объект изменений ведомого
+func loadChanges(ctx context.Context, s3Storage *storage.S3Storage, key string) ([]change, error) {
+	reader, _, err := s3Storage.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var changes []change
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var c change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", key, err)
+		}
+		changes = append(changes, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	return changes, nil
+}
+
+// inboxName возвращает имя объекта изменений без префикса и расширения
+func inboxName(key string) string {
+	return strings.TrimSuffix(path.Base(key), ".ndjson")
+}
+
+// receive учитывает изменения, переданные ведомыми. Скачивания из каждого
+// объекта изменений записываются в журнал объектом с его именем, поэтому
+// после аварийного завершения ведущего они не учитываются дважды: logged -
+// имена объектов, скачивания из которых уже прочитаны из журнала
+func (s *Store) receive(ctx context.Context, logged map[string]bool) error {
+	keys, err := s.storage.ListKeys(ctx, inboxPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		s.mu.RLock()
+		done := slices.Contains(s.applied, key)
+		s.mu.RUnlock()
+		if done || !strings.HasSuffix(key, ".ndjson") {
+			continue
+		}
+
+		changes, err := loadChanges(ctx, s.storage, key)
+		if err != nil {
+			return err
+		}
+
+		var events []DownloadEvent
+		for _, c := range changes {
+			if c.Download != nil {
+				events = append(events, *c.Download)
+			}
+		}
+		name := inboxName(key)
+		if len(events) > 0 && !logged[name] {
+			logKey, err := saveDownloadEvents(ctx, s.storage, events, name)
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			s.through = logKey
+			s.logged = true
+			s.mu.Unlock()
+		}
+
+		s.mu.Lock()
+		for _, c := range changes {
+			s.apply(c)
+		}
+		s.applied = append(s.applied, key)
+		s.dirty = true
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// cleanup удаляет объекты изменений ведомых, вошедшие в сохраненную статистику
+func (s *Store) cleanup(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.storage.DeleteObject(ctx, key); err != nil {
+			log.Printf("Failed to delete applied analytics changes: %v", err)
+			continue
+		}
+		s.mu.Lock()
+		s.applied = slices.DeleteFunc(s.applied, func(applied string) bool {
+			return applied == key
+		})
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,124 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"file-agent/internal/storage"
+)
+
+const (
+	// leaseKey объект с арендой записи статистики
+	leaseKey = "analytics/lease.json"
+	// leaseDuration время, на которое экземпляр закрепляет за собой запись;
+	// аренда продлевается при каждом сохранении статистики
+	leaseDuration = 6 * FlushInterval
+	// leaseSettle пауза перед проверкой захвата аренды
+	leaseSettle = time.Second
+)
+
+// ErrLeaseHeld возвращается, если статистику ведет другой экземпляр сервиса
+var ErrLeaseHeld = errors.New("analytics aggregates are written by another instance")
+
+// lease аренда записи статистики. Статистику изменяет только экземпляр,
+// которому принадлежит аренда, иначе экземпляры перезаписывали бы
+// изменения друг друга
+type lease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// newOwner возвращает идентификатор экземпляра для аренды
+func newOwner() string {
+	hostname, _ := os.Hostname()
+	return hostname + "-" + uuid.New().String()[:8]
+}
+
+// acquireLease захватывает аренду для owner, если она свободна или истекла
+// (экземпляр мог завершиться аварийно). S3 не поддерживает условную запись,
+// поэтому одновременный захват определяется повторным чтением
+func acquireLease(ctx context.Context, s3Storage *storage.S3Storage, owner string) error {
+	current, err := loadLease(ctx, s3Storage)
+	if err != nil {
+		return err
+	}
+	if current.held(owner) {
+		return fmt.Errorf("%w: %s until %s", ErrLeaseHeld, current.Owner, current.ExpiresAt.Format(time.RFC3339))
+	}
+
+	if err := saveLease(ctx, s3Storage, owner); err != nil {
+		return err
+	}
+	if err := sleep(ctx, leaseSettle); err != nil {
+		return err
+	}
+
+	current, err = loadLease(ctx, s3Storage)
+	if err != nil {
+		return err
+	}
+	if current.Owner != owner {
+		return fmt.Errorf("%w: %s", ErrLeaseHeld, current.Owner)
+	}
+	return nil
+}
+
+// renewLease продлевает аренду, если ее не захватил другой экземпляр
+func renewLease(ctx context.Context, s3Storage *storage.S3Storage, owner string) error {
+	current, err := loadLease(ctx, s3Storage)
+	if err != nil {
+		return err
+	}
+	if current.held(owner) {
+		return fmt.Errorf("%w: %s", ErrLeaseHeld, current.Owner)
+	}
+	return saveLease(ctx, s3Storage, owner)
+}
+
+// releaseLease снимает аренду, чтобы новый экземпляр мог сразу начать запись
+func releaseLease(ctx context.Context, s3Storage *storage.S3Storage, owner string) error {
+	current, err := loadLease(ctx, s3Storage)
+	if err != nil || current.Owner != owner {
+		return err
+	}
+	return s3Storage.DeleteObject(ctx, leaseKey)
+}
+
+// loadLease загружает аренду; отсутствующая аренда возвращается пустой
+func loadLease(ctx context.Context, s3Storage *storage.S3Storage) (lease, error) {
+	var current lease
+	if err := s3Storage.GetJSON(ctx, leaseKey, &current); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return lease{}, fmt.Errorf("failed to load analytics lease: %w", err)
+	}
+	return current, nil
+}
+
+func saveLease(ctx context.Context, s3Storage *storage.S3Storage, owner string) error {
+	current := lease{Owner: owner, ExpiresAt: time.Now().UTC().Add(leaseDuration)}
+	if err := s3Storage.PutJSON(ctx, leaseKey, current); err != nil {
+		return fmt.Errorf("failed to save analytics lease: %w", err)
+	}
+	return nil
+}
+
+// held проверяет, что аренда действует и принадлежит другому экземпляру
+func (l lease) held(owner string) bool {
+	return l.Owner != "" && l.Owner != owner && l.ExpiresAt.After(time.Now())
+}
+
+// sleep ожидает d или отмены контекста
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	// Встроенная база часовых поясов: в минимальном образе ее нет
+	_ "time/tzdata"
+)
+
+// Гранулярность временного ряда
+const (
+	GranularityHour  = "hour"
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// MaxBuckets ограничение на количество интервалов ряда
+const MaxBuckets = 10000
+
+// ErrInvalidRange возвращается для некорректных параметров ряда
+var ErrInvalidRange = errors.New("invalid time range")
+
+// Bucket интервал временного ряда [Start, End)
+type Bucket struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Breakdown
+}
+
+// Series временной ряд загрузок. Интервалы выравниваются по границам часов,
+// дней, недель (с понедельника) или месяцев в указанном часовом поясе
+type Series struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Granularity string    `json:"granularity"`
+	Timezone    string    `json:"timezone"`
+	Buckets     []Bucket  `json:"buckets"`
+}
+
+// NewSeries создает пустой ряд для интервала [from, to). Начало интервала
+// округляется вниз до границы первого интервала, чтобы он был полным
+func NewSeries(from, to time.Time, granularity string, location *time.Location) (*Series, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+	switch granularity {
+	case GranularityHour, GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return nil, fmt.Errorf("%w: unknown granularity %q", ErrInvalidRange, granularity)
+	}
+
+	series := &Series{
+		From:        from.In(location),
+		To:          to.In(location),
+		Granularity: granularity,
+		Timezone:    location.String(),
+		Buckets:     []Bucket{},
+	}
+
+	for start := truncate(from.In(location), granularity); start.Before(to); {
+		if len(series.Buckets) == MaxBuckets {
+			return nil, fmt.Errorf("%w: more than %d buckets, use a coarser granularity", ErrInvalidRange, MaxBuckets)
+		}
+		end := next(start, granularity)
+		series.Buckets = append(series.Buckets, Bucket{Start: start, End: end})
+		start = end
+	}
+	series.From = series.Buckets[0].Start
+
+	return series, nil
+}
+
+// AddBreakdown учитывает загрузки в момент t, если он попадает в интервал ряда
+func (s *Series) AddBreakdown(t time.Time, b Breakdown) {
+	if t.Before(s.From) || !t.Before(s.To) {
+		return
+	}
+
+	i := sort.Search(len(s.Buckets), func(i int) bool {
+		return t.Before(s.Buckets[i].End)
+	})
+	if i < len(s.Buckets) {
+		s.Buckets[i].FileCount += b.FileCount
+		s.Buckets[i].TotalSize += b.TotalSize
+	}
+}
+
+// Empty возвращает ряд с теми же интервалами без данных
+func (s *Series) Empty() *Series {
+	empty := *s
+	empty.Buckets = make([]Bucket, len(s.Buckets))
+	for i, bucket := range s.Buckets {
+		empty.Buckets[i] = Bucket{Start: bucket.Start, End: bucket.End}
+	}
+	return &empty
+}
+
+// ParseTime разбирает границу интервала: RFC 3339 или дату YYYY-MM-DD
+// (начало дня в указанном часовом поясе)
+func ParseTime(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not RFC 3339 time or YYYY-MM-DD date", ErrInvalidRange, value)
+}
+
+// truncate возвращает начало интервала, содержащего t. Вычисляется через
+// календарные поля, чтобы переходы на летнее время не сдвигали границы
+func truncate(t time.Time, granularity string) time.Time {
+	year, month, day := t.Date()
+	location := t.Location()
+
+	switch granularity {
+	case GranularityHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, location)
+	case GranularityWeek:
+		// Неделя начинается с понедельника
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, location)
+	case GranularityMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, location)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
+
+// next возвращает начало следующего интервала
+func next(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return start.Add(time.Hour)
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
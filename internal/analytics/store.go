@@ -0,0 +1,744 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+// aggregatesKey ключ объекта с сохраненной статистикой
+const aggregatesKey = "analytics/aggregates.json"
+
+// rebuildRequestKey запрос пересчета статистики работающим сервисом
+const rebuildRequestKey = "analytics/rebuild-request.json"
+
+// FlushInterval период записи журнала скачиваний и сохранения изменений
+// файлов в бакет
+const FlushInterval = 10 * time.Second
+
+// CompactInterval период, с которым скачивания, уже записанные в журнал,
+// переносятся в сохраненную статистику, если файлы не изменялись
+const CompactInterval = 5 * time.Minute
+
+// snapshotInterval минимальный период между публикациями снимка статистики
+const snapshotInterval = time.Second
+
+// topLimit количество файлов и пользователей в предрассчитанных топах снимка
+const topLimit = 10
+
+// aggregatesVersion версия формата сохраненной статистики. Статистика
+// другой версии (например, сохраненная до разбивки по часам у пользователей,
+// до учета квот по owner или до переноса журнала скачиваний в статистику)
+// пересчитывается при загрузке
+const aggregatesVersion = 4
+
+// aggregates сохраняемое состояние статистики
+type aggregates struct {
+	Version   int       `json:"version"`
+	Summary   *Summary  `json:"summary"`
+	RebuiltAt time.Time `json:"rebuilt_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Последний объект журнала скачиваний, учтенный в статистике. Более
+	// ранние объекты при загрузке и пересчете не читаются
+	DownloadsThrough string `json:"downloads_through,omitempty"`
+
+	// Учтенные объекты изменений ведомых, которые еще могут оставаться в
+	// бакете: при загрузке они повторно не применяются
+	Applied []string `json:"applied,omitempty"`
+}
+
+// rebuildRequest запрос пересчета, оставленный командой rebuild-analytics
+type rebuildRequest struct {
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// Store поддерживает статистику по всем файлам в памяти, обновляя ее при
+// загрузке, изменении, удалении и скачивании файлов. Статистику ведет один
+// экземпляр сервиса - ведущий, владелец аренды analytics/lease.json: он
+// периодически сохраняет ее в бакет вместе с журналом скачиваний. Остальные
+// экземпляры работают ведомыми: загружают статистику, сохраненную ведущим,
+// передают ему свои изменения через analytics/inbox/ и захватывают аренду,
+// когда она освобождается
+type Store struct {
+	storage *storage.S3Storage
+	owner   string // Идентификатор экземпляра для аренды записи
+
+	mu        sync.RWMutex
+	leader    bool // Экземпляр владеет арендой и сохраняет статистику
+	summary   *Summary
+	rebuiltAt time.Time
+	dirty     bool            // Изменения файлов, не сохраненные в бакет
+	pending   []DownloadEvent // Скачивания ведущего, еще не записанные в журнал
+	unsaved   []change        // Изменения файлов ведущего после сохраненной статистики
+	outbox    []change        // Изменения ведомого, еще не переданные ведущему
+	applied   []string        // Учтенные объекты изменений ведомых, еще не удаленные
+	version   string          // ETag статистики, загруженной ведомым
+
+	through string    // Последний объект журнала, учтенный в статистике
+	logged  bool      // Журнал содержит скачивания после сохраненной статистики
+	savedAt time.Time // Время последнего сохранения статистики
+
+	snapshot   *Summary        // Опубликованный снимок для чтения
+	snapshotAt time.Time       // Время публикации снимка
+	changed    bool            // Статистика изменилась после публикации снимка
+	top        []FileDownloads // Самые скачиваемые файлы, nil - нужен пересчет
+
+	// Файлы, измененные во время пересчета, и их текущие метаданные
+	// (nil - файл удален). Не nil только во время пересчета
+	touched map[string]*storage.FileMetadata
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStore создает пустое хранилище статистики; данные загружаются в Load
+func NewStore(s3Storage *storage.S3Storage) *Store {
+	return &Store{
+		storage: s3Storage,
+		owner:   newOwner(),
+		summary: NewSummary(),
+	}
+}
+
+// Load загружает статистику. Если аренда записи свободна, экземпляр
+// захватывает ее и становится ведущим, иначе работает ведомым
+func (s *Store) Load(ctx context.Context) error {
+	err := acquireLease(ctx, s.storage, s.owner)
+	if errors.Is(err, ErrLeaseHeld) {
+		log.Printf("Analytics: %v, running as a follower", err)
+		return s.reload(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return s.lead(ctx)
+}
+
+// lead загружает статистику после захвата аренды: сохраненную статистику,
+// журнал скачиваний после нее и изменения ведомых. Если статистики еще нет
+// или она в старом формате, она пересчитывается. Изменения, которые
+// экземпляр не успел передать ведущему, применяются к результату
+func (s *Store) lead(ctx context.Context) error {
+	var saved aggregates
+	err := s.storage.GetJSON(ctx, aggregatesKey, &saved)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return err
+	}
+	if err != nil || saved.Version != aggregatesVersion {
+		if err != nil {
+			log.Printf("Analytics aggregates not found, rebuilding")
+		} else {
+			log.Printf("Analytics aggregates have format version %d instead of %d, rebuilding", saved.Version, aggregatesVersion)
+		}
+		// Изменения файлов пересчет возьмет из метаданных, скачивания - нет
+		s.mu.Lock()
+		for _, c := range s.outbox {
+			if c.Download != nil {
+				s.pending = append(s.pending, *c.Download)
+			}
+		}
+		s.outbox = nil
+		s.leader = true
+		s.mu.Unlock()
+		_, err = s.Rebuild(ctx)
+		return err
+	}
+
+	summary := saved.Summary.normalize()
+	keys, err := loadDownloadEvents(ctx, s.storage, saved.DownloadsThrough, summary.AddDownload)
+	if err != nil {
+		return fmt.Errorf("failed to load download events: %w", err)
+	}
+	through := lastKey(keys, saved.DownloadsThrough)
+
+	s.mu.Lock()
+	s.summary = summary
+	s.rebuiltAt = saved.RebuiltAt
+	s.through = through
+	s.logged = through != saved.DownloadsThrough
+	s.savedAt = saved.UpdatedAt
+	s.applied = saved.Applied
+	s.dirty = false
+	s.reset()
+	s.leader = true
+	outbox := s.outbox
+	s.outbox = nil
+	for _, c := range outbox {
+		s.apply(c)
+		s.keep(c)
+	}
+	s.mu.Unlock()
+
+	// Скачивания из изменений ведомых, уже записанные в журнал, повторно
+	// не учитываются
+	logged := make(map[string]bool)
+	for _, key := range keys {
+		if source := downloadSource(key); source != "" {
+			logged[source] = true
+		}
+	}
+	return s.receive(ctx, logged)
+}
+
+// Start запускает периодическое сохранение статистики ведущим (вместе с
+// запросами пересчета от команды rebuild-analytics) или обновление
+// статистики ведомым
+func (s *Store) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.tick(context.Background())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// tick выполняет периодическую работу ведущего или ведомого
+func (s *Store) tick(ctx context.Context) {
+	if s.isLeader() {
+		if err := s.rebuildIfRequested(ctx); err != nil {
+			log.Printf("Failed to rebuild analytics aggregates: %v", err)
+		}
+		if err := s.Flush(ctx); err != nil {
+			log.Printf("Failed to save analytics aggregates: %v", err)
+		}
+		return
+	}
+
+	if err := s.Flush(ctx); err != nil {
+		log.Printf("Failed to forward analytics changes: %v", err)
+	}
+
+	// Освободившуюся аренду (ведущий остановлен или аварийно завершился)
+	// захватывает ведомый
+	err := acquireLease(ctx, s.storage, s.owner)
+	if err == nil {
+		if err := s.lead(ctx); err != nil {
+			log.Printf("Failed to take over analytics aggregates: %v", err)
+			s.stepDown()
+			if err := releaseLease(ctx, s.storage, s.owner); err != nil {
+				log.Printf("Failed to release analytics lease: %v", err)
+			}
+			return
+		}
+		log.Printf("Analytics aggregates are now written by this instance")
+		return
+	}
+	if !errors.Is(err, ErrLeaseHeld) {
+		log.Printf("Failed to acquire analytics lease: %v", err)
+	}
+
+	if err := s.reload(ctx); err != nil {
+		log.Printf("Failed to reload analytics aggregates: %v", err)
+	}
+}
+
+// Stop останавливает периодическую работу, сохраняет или передает ведущему
+// последние изменения и снимает аренду записи. Аренда снимается и при
+// ошибке сохранения, чтобы ведомый мог сразу ее захватить
+func (s *Store) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		log.Printf("Failed to save analytics aggregates: %v", err)
+	}
+	if err := releaseLease(context.Background(), s.storage, s.owner); err != nil {
+		log.Printf("Failed to release analytics lease: %v", err)
+	}
+}
+
+// isLeader проверяет, что экземпляр ведет статистику
+func (s *Store) isLeader() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leader
+}
+
+// Flush у ведущего продлевает аренду, учитывает изменения ведомых,
+// записывает новые скачивания в журнал и сохраняет статистику, если
+// изменились файлы. Скачивания переносятся в сохраненную статистику не
+// чаще CompactInterval: до этого они восстанавливаются из журнала. Если
+// аренду захватил другой экземпляр, ведущий становится ведомым. Ведомый
+// передает свои изменения ведущему
+func (s *Store) Flush(ctx context.Context) error {
+	if !s.isLeader() {
+		return s.forward(ctx)
+	}
+
+	if err := renewLease(ctx, s.storage, s.owner); err != nil {
+		if !errors.Is(err, ErrLeaseHeld) {
+			return err
+		}
+		log.Printf("Analytics lease lost (%v), running as a follower", err)
+		s.stepDown()
+		return s.forward(ctx)
+	}
+
+	if err := s.receive(ctx, nil); err != nil {
+		log.Printf("Failed to apply analytics changes from followers: %v", err)
+	}
+
+	// Копия статистики снимается вместе с пачкой скачиваний, поэтому
+	// содержит ровно скачивания из журнала до этой пачки включительно
+	s.mu.Lock()
+	events := s.pending
+	s.pending = nil
+	var current *aggregates
+	var saving int
+	if s.dirty || (len(events) > 0 || s.logged) && time.Since(s.savedAt) >= CompactInterval {
+		current = &aggregates{
+			Version:          aggregatesVersion,
+			Summary:          s.summary.Clone(),
+			RebuiltAt:        s.rebuiltAt,
+			DownloadsThrough: s.through,
+			Applied:          append([]string(nil), s.applied...),
+		}
+		saving = len(s.unsaved)
+		s.dirty = false
+	}
+	s.mu.Unlock()
+
+	if len(events) > 0 {
+		key, err := saveDownloadEvents(ctx, s.storage, events, "")
+		if err != nil {
+			s.mu.Lock()
+			s.pending = append(events, s.pending...)
+			s.dirty = s.dirty || current != nil
+			s.mu.Unlock()
+			return err
+		}
+
+		s.mu.Lock()
+		s.through = key
+		s.logged = true
+		s.mu.Unlock()
+		if current != nil {
+			current.DownloadsThrough = key
+		}
+	}
+
+	if current == nil {
+		return nil
+	}
+
+	current.UpdatedAt = time.Now().UTC()
+	if err := s.storage.PutJSON(ctx, aggregatesKey, current); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	s.savedAt = current.UpdatedAt
+	s.logged = s.through != current.DownloadsThrough
+	s.unsaved = s.unsaved[saving:]
+	s.mu.Unlock()
+
+	// Изменения ведомых, вошедшие в сохраненную статистику, больше не нужны
+	s.cleanup(ctx, current.Applied)
+	return nil
+}
+
+// Add учитывает загруженный файл
+func (s *Store) Add(m *storage.FileMetadata) {
+	s.record(change{Added: m})
+}
+
+// AddUpload учитывает только что загруженный файл и принятую загрузку
+// в суточном счетчике пользователя, загрузившего файл
+func (s *Store) AddUpload(m *storage.FileMetadata) {
+	s.record(change{Added: m, Upload: true})
+}
+
+// Remove исключает удаленный файл. Исходящий трафик за прошлые периоды
+// сохраняется, счетчики скачиваний файла удаляются
+func (s *Store) Remove(m *storage.FileMetadata) {
+	s.record(change{Removed: m})
+}
+
+// RecordDownload учитывает скачивание файла. Скачивание сохраняется в
+// журнале (у ведомого - передается ведущему) при следующем Flush
+func (s *Store) RecordDownload(event DownloadEvent) {
+	s.record(change{Download: &event})
+}
+
+// Replace заменяет учтенную версию метаданных файла новой
+func (s *Store) Replace(old, updated *storage.FileMetadata) {
+	s.record(change{Removed: old, Added: updated})
+}
+
+// record применяет изменение и запоминает его для сохранения ведущим или
+// передачи ведущему
+func (s *Store) record(c change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apply(c)
+	if !s.leader {
+		s.outbox = append(s.outbox, c)
+		return
+	}
+	s.keep(c)
+}
+
+// keep запоминает изменение ведущего до сохранения; вызывается под mu
+func (s *Store) keep(c change) {
+	if c.Download != nil {
+		s.pending = append(s.pending, *c.Download)
+	} else {
+		s.unsaved = append(s.unsaved, c)
+	}
+}
+
+// apply применяет изменение к статистике; вызывается под mu
+func (s *Store) apply(c change) {
+	switch {
+	case c.Download != nil:
+		s.summary.AddDownload(*c.Download)
+		s.updateTop(c.Download.FileID)
+		s.changed = true
+		return
+	case c.Added == nil:
+		s.summary.Remove(c.Removed)
+		delete(s.summary.Downloads, c.Removed.ID)
+		s.touch(c.Removed.ID, nil)
+		if s.topIndex(c.Removed.ID) >= 0 {
+			s.top = nil
+		}
+	default:
+		if c.Removed != nil {
+			s.summary.Remove(c.Removed)
+		}
+		s.summary.Add(c.Added)
+		if c.Upload {
+			s.summary.CountUpload(Owner(c.Added), c.Added.UploadedAt)
+		}
+		s.touch(c.Added.ID, c.Added)
+		s.renameTop(c.Added)
+	}
+	s.dirty = true
+	s.changed = true
+}
+
+// Downloads возвращает статистику скачиваний файла
+func (s *Store) Downloads(fileID string) (DownloadStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats, ok := s.summary.Downloads[fileID]
+	if !ok {
+		return DownloadStats{}, false
+	}
+	return *stats, true
+}
+
+// touch запоминает изменение файла во время пересчета; вызывается под mu
+func (s *Store) touch(fileID string, m *storage.FileMetadata) {
+	if s.touched != nil {
+		s.touched[fileID] = m
+	}
+}
+
+// Totals возвращает общее количество и объем файлов
+func (s *Store) Totals() Breakdown {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Breakdown{FileCount: s.summary.TotalFiles, TotalSize: s.summary.TotalSize}
+}
+
+// OwnerUsage возвращает файлы пользователя, загрузившего их, и количество
+// принятых загрузок за сутки UTC, содержащие day
+func (s *Store) OwnerUsage(owner string, day time.Time) (stored Breakdown, uploads int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usage, ok := s.summary.Owners[owner]
+	if !ok {
+		return Breakdown{}, 0
+	}
+	return usage.Breakdown, usage.Uploads[day.Unix()/86400]
+}
+
+// Summary возвращает снимок статистики с предрассчитанными MostDownloaded
+// и TopDownloaders. Снимок общий для всех вызывающих и не должен
+// изменяться; после изменений статистики он публикуется заново, но не чаще
+// snapshotInterval. Скачивания отдельных файлов в снимок не входят, их
+// возвращает Downloads
+func (s *Store) Summary() *Summary {
+	s.mu.RLock()
+	snapshot := s.snapshot
+	fresh := snapshot != nil && (!s.changed || time.Since(s.snapshotAt) < snapshotInterval)
+	s.mu.RUnlock()
+	if fresh {
+		return snapshot
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot == nil || s.changed && time.Since(s.snapshotAt) >= snapshotInterval {
+		s.publish()
+	}
+	return s.snapshot
+}
+
+// publish публикует новый снимок статистики; вызывается под mu
+func (s *Store) publish() {
+	if s.top == nil {
+		s.top = mostDownloaded(s.summary.Downloads, topLimit)
+	}
+
+	snapshot := s.summary.clone(false)
+	snapshot.mostDownloaded = append(make([]FileDownloads, 0, len(s.top)), s.top...)
+	snapshot.topDownloaders = s.summary.TopDownloaders(topLimit)
+
+	s.snapshot = snapshot
+	s.snapshotAt = time.Now()
+	s.changed = false
+}
+
+// reset сбрасывает снимок и топ после замены статистики; вызывается под mu
+func (s *Store) reset() {
+	s.snapshot = nil
+	s.top = nil
+	s.changed = true
+}
+
+// updateTop учитывает скачивание файла в самых скачиваемых файлах.
+// Счетчики файлов только растут, поэтому файл вне топа может попасть в него,
+// лишь обогнав последний; вызывается под mu
+func (s *Store) updateTop(fileID string) {
+	if s.top == nil {
+		return
+	}
+
+	entry := FileDownloads{FileID: fileID, DownloadStats: *s.summary.Downloads[fileID]}
+	if i := s.topIndex(fileID); i >= 0 {
+		s.top[i] = entry
+	} else {
+		s.top = append(s.top, entry)
+	}
+	sortDownloads(s.top)
+	if len(s.top) > topLimit {
+		s.top = s.top[:topLimit]
+	}
+}
+
+// renameTop обновляет имя файла в самых скачиваемых файлах; вызывается под mu
+func (s *Store) renameTop(m *storage.FileMetadata) {
+	if i := s.topIndex(m.ID); i >= 0 {
+		s.top[i].Filename = m.Filename
+	}
+}
+
+// topIndex возвращает позицию файла в самых скачиваемых файлах или -1
+func (s *Store) topIndex(fileID string) int {
+	for i := range s.top {
+		if s.top[i].FileID == fileID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rebuild пересчитывает статистику по метаданным всех файлов и заменяет
+// текущую. Скачивания берутся из сохраненной статистики и журнала,
+// записанного после нее. Изменения файлов во время пересчета (в том числе
+// переданные ведомыми) и скачивания, еще не записанные в журнал,
+// применяются к результату, поэтому не теряются. Вызывается ведущим, не
+// параллельно с Flush
+func (s *Store) Rebuild(ctx context.Context) (*Summary, error) {
+	rebuiltAt := time.Now().UTC()
+
+	s.mu.Lock()
+	s.touched = make(map[string]*storage.FileMetadata)
+	s.mu.Unlock()
+
+	// Пересчет может длиться дольше срока аренды, поэтому она продлевается
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := renewLease(ctx, s.storage, s.owner); err != nil {
+					log.Printf("Failed to renew analytics lease: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	seen, summary, through, applied, err := build(ctx, s.storage)
+	close(stop)
+	if err == nil {
+		// Изменения ведомых за время пересчета попадают в touched, а
+		// скачивания из них - в журнал, который дочитывается
+		s.mu.Lock()
+		for _, key := range applied {
+			if !slices.Contains(s.applied, key) {
+				s.applied = append(s.applied, key)
+			}
+		}
+		s.mu.Unlock()
+		if err = s.receive(ctx, nil); err == nil {
+			var keys []string
+			keys, err = loadDownloadEvents(ctx, s.storage, through, summary.AddDownload)
+			through = lastKey(keys, through)
+		}
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.touched = nil
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for fileID, current := range s.touched {
+		// Пересчет мог учесть любую версию файла: заменяем ее текущей
+		if old, ok := seen[fileID]; ok {
+			summary.Remove(old)
+		}
+		if current != nil {
+			summary.Add(current)
+		} else {
+			delete(summary.Downloads, fileID)
+		}
+	}
+	for _, event := range s.pending {
+		summary.AddDownload(event)
+	}
+	summary.mergeUploads(s.summary)
+	s.touched = nil
+	s.summary = summary
+	s.rebuiltAt = rebuiltAt
+	s.through = through
+	s.dirty = true
+	s.reset()
+	result := summary.Clone()
+	s.mu.Unlock()
+
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// rebuildIfRequested выполняет пересчет, запрошенный командой rebuild-analytics
+func (s *Store) rebuildIfRequested(ctx context.Context) error {
+	var request rebuildRequest
+	if err := s.storage.GetJSON(ctx, rebuildRequestKey, &request); err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("Rebuilding analytics aggregates requested at %s", request.RequestedAt.Format(time.RFC3339))
+	summary, err := s.Rebuild(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Analytics rebuilt: %d files, %s", summary.TotalFiles, FormatSize(summary.TotalSize))
+
+	return s.storage.DeleteObject(ctx, rebuildRequestKey)
+}
+
+// Rebuild пересчитывает статистику командой rebuild-analytics. Если
+// статистику ведет работающий сервис, команда оставляет ему запрос
+// пересчета и возвращает requested = true: сервис выполнит его при
+// следующем сохранении, не теряя изменений, сделанных во время пересчета
+func Rebuild(ctx context.Context, s3Storage *storage.S3Storage) (summary *Summary, requested bool, err error) {
+	store := NewStore(s3Storage)
+	err = acquireLease(ctx, s3Storage, store.owner)
+	if errors.Is(err, ErrLeaseHeld) {
+		request := rebuildRequest{RequestedAt: time.Now().UTC()}
+		if err := s3Storage.PutJSON(ctx, rebuildRequestKey, request); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err := releaseLease(context.Background(), s3Storage, store.owner); err != nil {
+			log.Printf("Failed to release analytics lease: %v", err)
+		}
+	}()
+
+	store.leader = true
+	summary, err = store.Rebuild(ctx)
+	return summary, false, err
+}
+
+// build рассчитывает статистику по метаданным всех файлов, скачиваниям из
+// сохраненной статистики и журналу, записанному после нее. Если сохраненной
+// статистики нет или она в старом формате, читается весь журнал. Возвращает
+// также учтенные версии метаданных файлов, последний прочитанный объект
+// журнала и учтенные объекты изменений ведомых из сохраненной статистики
+func build(ctx context.Context, s3Storage *storage.S3Storage) (map[string]*storage.FileMetadata, *Summary, string, []string, error) {
+	summary := NewSummary()
+	var after string
+	var saved aggregates
+	err := s3Storage.GetJSON(ctx, aggregatesKey, &saved)
+	switch {
+	case err == nil && saved.Version == aggregatesVersion:
+		summary = saved.Summary.normalize().downloadsOnly()
+		after = saved.DownloadsThrough
+	case err != nil && !errors.Is(err, storage.ErrObjectNotFound):
+		return nil, nil, "", nil, fmt.Errorf("failed to load analytics aggregates: %w", err)
+	}
+
+	allMetadata, err := s3Storage.ListAllMetadata(ctx)
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+
+	// Суточные счетчики загрузок восстанавливаются по существующим файлам;
+	// счетчики работающего сервиса переносятся в Rebuild
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+
+	seen := make(map[string]*storage.FileMetadata, len(allMetadata))
+	for _, meta := range allMetadata {
+		seen[meta.ID] = meta
+		summary.Add(meta)
+		if !meta.UploadedAt.Before(since) {
+			summary.CountUpload(Owner(meta), meta.UploadedAt)
+		}
+	}
+
+	keys, err := loadDownloadEvents(ctx, s3Storage, after, summary.AddDownload)
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("failed to load download events: %w", err)
+	}
+
+	// Счетчики скачиваний остаются только у существующих файлов
+	for fileID := range summary.Downloads {
+		if _, ok := seen[fileID]; !ok {
+			delete(summary.Downloads, fileID)
+		}
+	}
+
+	return seen, summary, lastKey(keys, after), saved.Applied, nil
+}
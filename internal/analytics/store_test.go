@@ -0,0 +1,162 @@
+package analytics
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+func TestStoreMaintainsMostDownloaded(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now()
+
+	var files []*storage.FileMetadata
+	for i := 0; i < 30; i++ {
+		file := &storage.FileMetadata{ID: fmt.Sprint(i), Filename: fmt.Sprintf("%d.txt", i), Size: 10, UploadedAt: now}
+		files = append(files, file)
+		store.Add(file)
+	}
+	store.Summary()
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		file := files[random.Intn(len(files))]
+		store.RecordDownload(DownloadEvent{FileID: file.ID, Filename: file.Filename, Time: now, Bytes: int64(random.Intn(1000)), Completed: true})
+		if i == 1000 {
+			// Удаление файла из топа требует пересчета
+			store.Remove(files[0])
+			files = files[1:]
+		}
+	}
+
+	store.mu.Lock()
+	want := mostDownloaded(store.summary.Downloads, topLimit)
+	store.snapshotAt = time.Time{}
+	store.mu.Unlock()
+
+	if got := store.Summary().MostDownloaded(topLimit); !reflect.DeepEqual(got, want) {
+		t.Errorf("MostDownloaded() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStoreSummarySnapshot(t *testing.T) {
+	store := NewStore(nil)
+	file := &storage.FileMetadata{ID: "1", Filename: "a.txt", Size: 100, UploadedAt: time.Now()}
+	store.Add(file)
+
+	first := store.Summary()
+	if first.TotalFiles != 1 || len(first.Downloads) != 0 {
+		t.Fatalf("snapshot = %+v, want 1 file without per-file downloads", first)
+	}
+	if again := store.Summary(); again != first {
+		t.Error("unchanged statistics was published again")
+	}
+
+	store.RecordDownload(DownloadEvent{FileID: "1", Filename: "a.txt", Time: time.Now(), Bytes: 100, Completed: true})
+	if got := store.Summary(); got != first {
+		t.Error("snapshot was published more often than snapshotInterval")
+	}
+	if first.EgressSince(time.Time{}).FileCount != 0 {
+		t.Error("published snapshot was modified")
+	}
+
+	store.mu.Lock()
+	store.snapshotAt = time.Now().Add(-snapshotInterval)
+	store.mu.Unlock()
+
+	updated := store.Summary()
+	if updated == first {
+		t.Fatal("changed statistics was not published after snapshotInterval")
+	}
+	top := updated.MostDownloaded(5)
+	if len(top) != 1 || top[0].FileID != "1" || top[0].Count != 1 {
+		t.Errorf("MostDownloaded() = %+v, want file 1 with 1 download", top)
+	}
+	if downloaders := updated.TopDownloaders(5); len(downloaders) != 1 || downloaders[0].Downloader != "anonymous" {
+		t.Errorf("TopDownloaders() = %+v, want anonymous", downloaders)
+	}
+	if stats, ok := store.Downloads("1"); !ok || stats.Count != 1 {
+		t.Errorf("Downloads() = %+v, %v, want 1 download", stats, ok)
+	}
+}
+
+func TestSummaryDownloadsOnly(t *testing.T) {
+	file := &storage.FileMetadata{ID: "1", Filename: "a.txt", Size: 100, UploadedBy: "alice", UploadedAt: time.Now()}
+
+	summary := NewSummary()
+	summary.Add(file)
+	summary.AddDownload(DownloadEvent{FileID: "1", Filename: "a.txt", UploadedBy: "alice", Time: time.Now(), Bytes: 100, Completed: true})
+
+	downloads := summary.downloadsOnly()
+	if downloads.TotalFiles != 0 || len(downloads.Types) != 0 || len(downloads.Hours) != 0 {
+		t.Errorf("downloadsOnly() kept file statistics: %+v", downloads)
+	}
+	alice := downloads.Users["alice"]
+	if alice == nil || alice.FileCount != 0 || alice.Downloads != 1 || alice.EgressBytes != 100 {
+		t.Errorf("alice = %+v, want only 1 download of 100 bytes", alice)
+	}
+
+	// Файлы добавляются к скачиваниям при пересчете
+	downloads.Add(file)
+	if alice := downloads.Users["alice"]; alice.FileCount != 1 || alice.Downloads != 1 {
+		t.Errorf("alice after Add = %+v, want 1 file and 1 download", alice)
+	}
+	if stats := downloads.Downloads["1"]; stats == nil || stats.Count != 1 {
+		t.Errorf("downloads = %+v, want 1 download of file 1", downloads.Downloads)
+	}
+}
+
+func TestStoreStepDownForwardsUnsavedChanges(t *testing.T) {
+	store := NewStore(nil)
+	store.leader = true
+
+	file := &storage.FileMetadata{ID: "1", Filename: "a.txt", Size: 100, UploadedBy: "alice", UploadedAt: time.Now()}
+	store.AddUpload(file)
+	store.RecordDownload(DownloadEvent{FileID: "1", Filename: "a.txt", UploadedBy: "alice", Time: time.Now(), Bytes: 100, Completed: true})
+	if len(store.unsaved) != 1 || len(store.pending) != 1 || len(store.outbox) != 0 {
+		t.Fatalf("leader kept %d unsaved, %d pending, %d outbox changes, want 1, 1, 0", len(store.unsaved), len(store.pending), len(store.outbox))
+	}
+
+	store.stepDown()
+	if store.isLeader() || len(store.unsaved) != 0 || len(store.pending) != 0 {
+		t.Fatalf("after stepDown leader = %v, unsaved = %d, pending = %d", store.leader, len(store.unsaved), len(store.pending))
+	}
+
+	// Новый ведущий получает те же изменения, что были у прежнего
+	store.Remove(file)
+	leader := NewStore(nil)
+	leader.leader = true
+	for _, c := range store.outbox {
+		leader.apply(c)
+	}
+	summary := leader.summary
+	if summary.TotalFiles != 0 || summary.Users["alice"].Downloads != 1 || summary.Owners["alice"].Uploads[time.Now().Unix()/86400] != 1 {
+		t.Errorf("summary from forwarded changes = %+v, want no files, 1 download and 1 upload", summary)
+	}
+	if _, ok := summary.Downloads["1"]; ok {
+		t.Error("download counters of the removed file were kept")
+	}
+}
+
+func TestDownloadSource(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"downloads/2025-03-01/1740787200000000000.ndjson", ""},
+		{"downloads/2025-03-01/1740787200000000001_1740787100000000000-host-1a2b3c4d.ndjson", "1740787100000000000-host-1a2b3c4d"},
+	}
+
+	for _, tt := range tests {
+		if got := downloadSource(tt.key); got != tt.want {
+			t.Errorf("downloadSource(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if name := inboxName(inboxPrefix + "1740787100000000000-host-1a2b3c4d.ndjson"); name != "1740787100000000000-host-1a2b3c4d" {
+		t.Errorf("inboxName() = %q", name)
+	}
+}
@@ -0,0 +1,486 @@
+package analytics
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+// Breakdown количество и объем файлов в группе
+type Breakdown struct {
+	FileCount int64 `json:"file_count"`
+	TotalSize int64 `json:"total_size"`
+}
+
+// SizeBucket интервал гистограммы размеров [MinSize, MaxSize)
+type SizeBucket struct {
+	Label   string `json:"label"`
+	MinSize int64  `json:"min_size"`
+	MaxSize int64  `json:"max_size,omitempty"` // Не задан для последнего интервала
+	Breakdown
+}
+
+// sizeBounds границы интервалов гистограммы размеров
+var sizeBounds = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20, 1 << 30}
+
+// noExtension группа файлов без расширения
+const noExtension = "none"
+
+// Summary сводная статистика по набору файлов. Поддерживает добавление и
+// удаление файлов, поэтому может обновляться инкрементально
+type Summary struct {
+	TotalFiles int64                     `json:"total_files"`
+	TotalSize  int64                     `json:"total_size"`
+	Extensions map[string]*Breakdown     `json:"files_by_extension"`
+	Types      map[string]*Breakdown     `json:"files_by_content_type"`
+	Histogram  []SizeBucket              `json:"size_histogram"`
+	Hours      map[int64]*Breakdown      `json:"hours"` // Загрузки по часам UTC (ключ - Unix-время начала часа / 3600)
+	Users      map[string]*UserSummary   `json:"users"`
+	Downloads  map[string]*DownloadStats `json:"downloads"` // Скачивания по идентификатору файла
+	Egress     map[int64]*Breakdown      `json:"egress"`    // Скачивания и отправленные байты по часам UTC
+
+	// Скачивания по аутентифицированному пользователю, скачавшему файл
+	Downloaders map[string]*DownloadCounters `json:"downloaders"`
+
+	// Файлы и принятые загрузки по пользователю, загрузившему файл (для квот)
+	Owners map[string]*OwnerUsage `json:"owners"`
+
+	// Предрассчитанные топы снимка статистики; у изменяемой статистики nil
+	mostDownloaded []FileDownloads
+	topDownloaders []DownloaderStats
+}
+
+// UserSummary статистика по автору загрузки
+type UserSummary struct {
+	Breakdown
+	Types       map[string]*Breakdown `json:"types"`
+	Hours       map[int64]*Breakdown  `json:"hours"` // Загрузки по часам UTC, как в Summary.Hours
+	Downloads   int64                 `json:"downloads"`
+	EgressBytes int64                 `json:"egress_bytes"`
+}
+
+// OwnerUsage использование квоты пользователем, загрузившим файлы. В отличие
+// от UserSummary не зависит от редактируемого поля uploaded_by
+type OwnerUsage struct {
+	Breakdown
+	// Принятые загрузки по суткам UTC (ключ - Unix-время начала суток / 86400).
+	// Удаление файла их не уменьшает
+	Uploads map[int64]int64 `json:"uploads"`
+}
+
+// NewSummary создает пустую статистику
+func NewSummary() *Summary {
+	histogram := make([]SizeBucket, len(sizeBounds)+1)
+	var min int64
+	for i := range histogram {
+		histogram[i].MinSize = min
+		if i < len(sizeBounds) {
+			histogram[i].MaxSize = sizeBounds[i]
+			min = sizeBounds[i]
+		}
+		histogram[i].Label = bucketLabel(histogram[i].MinSize, histogram[i].MaxSize)
+	}
+
+	return &Summary{
+		Extensions: make(map[string]*Breakdown),
+		Types:      make(map[string]*Breakdown),
+		Histogram:  histogram,
+		Hours:      make(map[int64]*Breakdown),
+		Users:      make(map[string]*UserSummary),
+		Downloads:  make(map[string]*DownloadStats),
+		Egress:     make(map[int64]*Breakdown),
+
+		Downloaders: make(map[string]*DownloadCounters),
+		Owners:      make(map[string]*OwnerUsage),
+	}
+}
+
+// Add учитывает файл в статистике
+func (s *Summary) Add(m *storage.FileMetadata) {
+	s.apply(m, 1)
+}
+
+// Remove исключает ранее учтенный файл из статистики
+func (s *Summary) Remove(m *storage.FileMetadata) {
+	s.apply(m, -1)
+}
+
+// apply изменяет счетчики на sign файлов
+func (s *Summary) apply(m *storage.FileMetadata, sign int64) {
+	size := sign * m.Size
+	s.TotalFiles += sign
+	s.TotalSize += size
+
+	update(s.Extensions, Extension(m.Filename), sign, size)
+	update(s.Types, contentType(m), sign, size)
+	update(s.Hours, m.UploadedAt.Unix()/3600, sign, size)
+
+	bucket := &s.Histogram[bucketIndex(m.Size)]
+	bucket.FileCount += sign
+	bucket.TotalSize += size
+
+	user := Uploader(m)
+	stats := s.user(user)
+	stats.FileCount += sign
+	stats.TotalSize += size
+	update(stats.Types, contentType(m), sign, size)
+	update(stats.Hours, m.UploadedAt.Unix()/3600, sign, size)
+	// Пользователь без файлов остается, пока у него есть скачивания: они
+	// не должны пропадать при переименовании автора или удалении файлов
+	if stats.FileCount <= 0 && stats.Downloads == 0 && stats.EgressBytes == 0 {
+		delete(s.Users, user)
+	}
+
+	name := Owner(m)
+	owner := s.owner(name)
+	owner.FileCount += sign
+	owner.TotalSize += size
+	if owner.FileCount <= 0 && len(owner.Uploads) == 0 {
+		delete(s.Owners, name)
+	}
+
+	// Имя файла в статистике скачиваний следует за переименованием
+	if downloads, ok := s.Downloads[m.ID]; ok && sign > 0 {
+		downloads.Filename = m.Filename
+	}
+}
+
+// user возвращает статистику пользователя, создавая ее при необходимости
+func (s *Summary) user(name string) *UserSummary {
+	stats, ok := s.Users[name]
+	if !ok {
+		stats = &UserSummary{
+			Types: make(map[string]*Breakdown),
+			Hours: make(map[int64]*Breakdown),
+		}
+		s.Users[name] = stats
+	}
+	return stats
+}
+
+// owner возвращает использование квоты пользователем, создавая его при необходимости
+func (s *Summary) owner(name string) *OwnerUsage {
+	usage, ok := s.Owners[name]
+	if !ok {
+		usage = &OwnerUsage{Uploads: make(map[int64]int64)}
+		s.Owners[name] = usage
+	}
+	return usage
+}
+
+// CountUpload учитывает принятую загрузку файла в суточном счетчике
+// пользователя. Хранятся только текущие и предыдущие сутки
+func (s *Summary) CountUpload(owner string, at time.Time) {
+	usage := s.owner(owner)
+	day := at.Unix() / 86400
+	usage.Uploads[day]++
+	for d := range usage.Uploads {
+		if d < day-1 {
+			delete(usage.Uploads, d)
+		}
+	}
+}
+
+// mergeUploads переносит суточные счетчики загрузок из previous. Пересчет
+// видит только существующие файлы, поэтому из двух значений берется большее
+func (s *Summary) mergeUploads(previous *Summary) {
+	for name, usage := range previous.Owners {
+		for day, count := range usage.Uploads {
+			owner := s.owner(name)
+			owner.Uploads[day] = max(owner.Uploads[day], count)
+		}
+	}
+}
+
+// Since возвращает загрузки начиная с часа, содержащего since
+func (s *Summary) Since(since time.Time) Breakdown {
+	return sumSince(s.Hours, since)
+}
+
+// FillSeries заполняет временной ряд почасовыми данными. Для часовых поясов
+// со смещением, не кратным часу, границы интервалов приблизительны
+func (s *Summary) FillSeries(series *Series) {
+	fillSeries(s.Hours, series)
+}
+
+// FillSeries заполняет временной ряд загрузками пользователя
+func (u *UserSummary) FillSeries(series *Series) {
+	fillSeries(u.Hours, series)
+}
+
+// FillStored заполняет ряд файлами пользователя, хранящимися на конец
+// каждого интервала. Учитываются только существующие файлы: удаленные
+// файлы не входят в статистику
+func (u *UserSummary) FillStored(series *Series) {
+	deltas := make([]Breakdown, len(series.Buckets)+1)
+	for hour, b := range u.Hours {
+		t := time.Unix(hour*3600, 0)
+		i := sort.Search(len(series.Buckets), func(i int) bool {
+			return t.Before(series.Buckets[i].End)
+		})
+		deltas[i].FileCount += b.FileCount
+		deltas[i].TotalSize += b.TotalSize
+	}
+
+	var stored Breakdown
+	for i := range series.Buckets {
+		stored.FileCount += deltas[i].FileCount
+		stored.TotalSize += deltas[i].TotalSize
+		series.Buckets[i].Breakdown = stored
+	}
+}
+
+// Clone возвращает независимую копию статистики
+func (s *Summary) Clone() *Summary {
+	return s.clone(true)
+}
+
+// clone копирует статистику; без withDownloads скачивания отдельных файлов
+// не копируются
+func (s *Summary) clone(withDownloads bool) *Summary {
+	clone := &Summary{
+		TotalFiles: s.TotalFiles,
+		TotalSize:  s.TotalSize,
+		Extensions: cloneBreakdowns(s.Extensions),
+		Types:      cloneBreakdowns(s.Types),
+		Histogram:  append([]SizeBucket(nil), s.Histogram...),
+		Hours:      cloneBreakdowns(s.Hours),
+		Users:      make(map[string]*UserSummary, len(s.Users)),
+		Downloads:  make(map[string]*DownloadStats),
+		Egress:     cloneBreakdowns(s.Egress),
+
+		Downloaders: make(map[string]*DownloadCounters, len(s.Downloaders)),
+		Owners:      make(map[string]*OwnerUsage, len(s.Owners)),
+	}
+	for user, stats := range s.Users {
+		copied := *stats
+		copied.Types = cloneBreakdowns(stats.Types)
+		copied.Hours = cloneBreakdowns(stats.Hours)
+		clone.Users[user] = &copied
+	}
+	if withDownloads {
+		for fileID, stats := range s.Downloads {
+			copied := *stats
+			clone.Downloads[fileID] = &copied
+		}
+	}
+	for downloader, counters := range s.Downloaders {
+		copied := *counters
+		clone.Downloaders[downloader] = &copied
+	}
+	for owner, usage := range s.Owners {
+		copied := *usage
+		copied.Uploads = make(map[int64]int64, len(usage.Uploads))
+		for day, count := range usage.Uploads {
+			copied.Uploads[day] = count
+		}
+		clone.Owners[owner] = &copied
+	}
+	return clone
+}
+
+// downloadsOnly возвращает статистику только со скачиваниями: по файлам,
+// по часам, по скачавшим пользователям и по авторам загрузки
+func (s *Summary) downloadsOnly() *Summary {
+	result := NewSummary()
+	result.Downloads = s.Downloads
+	result.Egress = s.Egress
+	result.Downloaders = s.Downloaders
+	for name, stats := range s.Users {
+		if stats.Downloads == 0 && stats.EgressBytes == 0 {
+			continue
+		}
+		user := result.user(name)
+		user.Downloads = stats.Downloads
+		user.EgressBytes = stats.EgressBytes
+	}
+	return result
+}
+
+// normalize восполняет пустые поля статистики, загруженной из бакета
+func (s *Summary) normalize() *Summary {
+	empty := NewSummary()
+	if s == nil {
+		return empty
+	}
+	if s.Extensions == nil {
+		s.Extensions = empty.Extensions
+	}
+	if s.Types == nil {
+		s.Types = empty.Types
+	}
+	if len(s.Histogram) != len(empty.Histogram) {
+		s.Histogram = empty.Histogram
+	}
+	if s.Hours == nil {
+		s.Hours = empty.Hours
+	}
+	if s.Users == nil {
+		s.Users = empty.Users
+	}
+	if s.Downloads == nil {
+		s.Downloads = empty.Downloads
+	}
+	if s.Egress == nil {
+		s.Egress = empty.Egress
+	}
+	if s.Downloaders == nil {
+		s.Downloaders = empty.Downloaders
+	}
+	if s.Owners == nil {
+		s.Owners = empty.Owners
+	}
+	for _, usage := range s.Owners {
+		if usage.Uploads == nil {
+			usage.Uploads = make(map[int64]int64)
+		}
+	}
+	for _, stats := range s.Users {
+		if stats.Types == nil {
+			stats.Types = make(map[string]*Breakdown)
+		}
+		if stats.Hours == nil {
+			stats.Hours = make(map[int64]*Breakdown)
+		}
+	}
+	return s
+}
+
+// AverageSize возвращает средний размер файла
+func (s *Summary) AverageSize() int64 {
+	if s.TotalFiles == 0 {
+		return 0
+	}
+	return s.TotalSize / s.TotalFiles
+}
+
+// Extension возвращает расширение файла в нижнем регистре без точки
+func Extension(filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if ext == "" {
+		return noExtension
+	}
+	return ext
+}
+
+// Uploader возвращает автора загрузки для статистики
+func Uploader(m *storage.FileMetadata) string {
+	if m.UploadedBy == "" {
+		return "anonymous"
+	}
+	return m.UploadedBy
+}
+
+// Owner возвращает пользователя, загрузившего файл, для квот. У файлов,
+// загруженных до появления поля owner, используется автор загрузки
+func Owner(m *storage.FileMetadata) string {
+	if m.Owner == "" {
+		return Uploader(m)
+	}
+	return m.Owner
+}
+
+// FormatSize форматирует размер в байтах в читаемом виде (1.5 MB)
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size)
+	units := []string{"KB", "MB", "GB", "TB", "PB", "EB"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// contentType возвращает тип файла, определенный при загрузке
+func contentType(m *storage.FileMetadata) string {
+	if m.ContentType == "" {
+		return storage.DefaultContentType
+	}
+	return m.ContentType
+}
+
+// update изменяет счетчики группы; пустые группы удаляются
+func update[K comparable](groups map[K]*Breakdown, key K, count, size int64) {
+	group, ok := groups[key]
+	if !ok {
+		group = &Breakdown{}
+		groups[key] = group
+	}
+	group.FileCount += count
+	group.TotalSize += size
+	if group.FileCount <= 0 {
+		delete(groups, key)
+	}
+}
+
+// sumSince суммирует почасовые группы начиная с часа, содержащего since
+func sumSince(hours map[int64]*Breakdown, since time.Time) Breakdown {
+	var total Breakdown
+	from := since.Unix() / 3600
+	for hour, b := range hours {
+		if hour >= from {
+			total.FileCount += b.FileCount
+			total.TotalSize += b.TotalSize
+		}
+	}
+	return total
+}
+
+// fillSeries переносит почасовые группы во временной ряд
+func fillSeries(hours map[int64]*Breakdown, series *Series) {
+	for hour, b := range hours {
+		series.AddBreakdown(time.Unix(hour*3600, 0), *b)
+	}
+}
+
+// cloneBreakdowns копирует группы статистики
+func cloneBreakdowns[K comparable](groups map[K]*Breakdown) map[K]*Breakdown {
+	clone := make(map[K]*Breakdown, len(groups))
+	for key, group := range groups {
+		copied := *group
+		clone[key] = &copied
+	}
+	return clone
+}
+
+// bucketIndex возвращает номер интервала гистограммы для размера
+func bucketIndex(size int64) int {
+	for i, bound := range sizeBounds {
+		if size < bound {
+			return i
+		}
+	}
+	return len(sizeBounds)
+}
+
+// bucketLabel возвращает подпись интервала гистограммы
+func bucketLabel(min, max int64) string {
+	switch {
+	case max == 0:
+		return ">= " + compactSize(min)
+	case min == 0:
+		return "< " + compactSize(max)
+	}
+	return compactSize(min) + " - " + compactSize(max)
+}
+
+// compactSize форматирует границу интервала без дробной части (10 KB)
+func compactSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for size >= 1024 && size%1024 == 0 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d %s", size, units[i])
+}
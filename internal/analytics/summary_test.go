@@ -0,0 +1,151 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"file-agent/internal/storage"
+)
+
+func TestSummaryKeepsDownloadsOnRename(t *testing.T) {
+	uploaded := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	file := &storage.FileMetadata{ID: "1", Filename: "a.txt", Size: 100, UploadedBy: "alice", UploadedAt: uploaded}
+
+	summary := NewSummary()
+	summary.Add(file)
+	summary.AddDownload(DownloadEvent{FileID: "1", Filename: "a.txt", UploadedBy: "alice", Time: uploaded, Bytes: 100, Completed: true})
+
+	renamed := *file
+	renamed.UploadedBy = "bob"
+	summary.Remove(file)
+	summary.Add(&renamed)
+
+	alice, ok := summary.Users["alice"]
+	if !ok {
+		t.Fatal("alice was removed together with her download counters")
+	}
+	if alice.FileCount != 0 || alice.Downloads != 1 || alice.EgressBytes != 100 {
+		t.Errorf("alice = %+v, want no files and 1 download of 100 bytes", alice)
+	}
+	if bob := summary.Users["bob"]; bob == nil || bob.FileCount != 1 || bob.TotalSize != 100 {
+		t.Errorf("bob = %+v, want 1 file of 100 bytes", bob)
+	}
+}
+
+func TestSummaryRemovesEmptyUsers(t *testing.T) {
+	file := &storage.FileMetadata{ID: "1", Filename: "a.txt", Size: 100, UploadedBy: "alice", UploadedAt: time.Now()}
+
+	summary := NewSummary()
+	summary.Add(file)
+	summary.Remove(file)
+
+	if _, ok := summary.Users["alice"]; ok {
+		t.Error("user without files and downloads was not removed")
+	}
+	if summary.TotalFiles != 0 || summary.TotalSize != 0 || len(summary.Hours) != 0 || len(summary.Types) != 0 {
+		t.Errorf("summary after remove = %+v, want empty", summary)
+	}
+}
+
+func TestSummaryDownloadOfUnknownUploader(t *testing.T) {
+	summary := NewSummary()
+	summary.AddDownload(DownloadEvent{FileID: "1", Time: time.Now(), Bytes: 10})
+
+	if user := summary.Users["anonymous"]; user == nil || user.Downloads != 1 || user.EgressBytes != 10 {
+		t.Errorf("anonymous = %+v, want 1 download of 10 bytes", user)
+	}
+	if counters := summary.Downloaders["anonymous"]; counters == nil || counters.Count != 1 {
+		t.Errorf("downloaders = %+v, want anonymous download", summary.Downloaders)
+	}
+}
+
+func TestUserSummaryFillStored(t *testing.T) {
+	summary := NewSummary()
+	for i, uploaded := range []time.Time{
+		time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC), // До начала ряда
+		time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), // После конца ряда
+	} {
+		summary.Add(&storage.FileMetadata{ID: string(rune('a' + i)), Size: 100, UploadedBy: "alice", UploadedAt: uploaded})
+	}
+
+	series, err := NewSeries(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), GranularityMonth, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary.Users["alice"].FillStored(series)
+
+	want := []int64{2, 2, 3}
+	for i, bucket := range series.Buckets {
+		if bucket.FileCount != want[i] || bucket.TotalSize != want[i]*100 {
+			t.Errorf("bucket %s = %+v, want %d files", bucket.Start.Format("2006-01"), bucket.Breakdown, want[i])
+		}
+	}
+}
+
+func TestSummaryOwnerUsageIgnoresUploadedBy(t *testing.T) {
+	uploaded := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	file := &storage.FileMetadata{ID: "1", Filename: "a.txt", Size: 100, UploadedBy: "alice", Owner: "alice", UploadedAt: uploaded}
+
+	summary := NewSummary()
+	summary.Add(file)
+	summary.CountUpload(Owner(file), file.UploadedAt)
+
+	// Смена автора через PATCH не переносит использование квоты
+	renamed := *file
+	renamed.UploadedBy = "bob"
+	summary.Remove(file)
+	summary.Add(&renamed)
+
+	alice := summary.Owners["alice"]
+	if alice == nil || alice.FileCount != 1 || alice.TotalSize != 100 {
+		t.Fatalf("alice = %+v, want 1 file of 100 bytes", alice)
+	}
+	if _, ok := summary.Owners["bob"]; ok {
+		t.Error("usage was attributed to the edited uploaded_by")
+	}
+
+	// Удаление освобождает объем, но не суточный счетчик загрузок
+	summary.Remove(&renamed)
+	day := uploaded.Unix() / 86400
+	if alice := summary.Owners["alice"]; alice == nil || alice.FileCount != 0 || alice.Uploads[day] != 1 {
+		t.Errorf("alice after delete = %+v, want no files and 1 upload today", alice)
+	}
+}
+
+func TestSummaryMergeUploadsKeepsDeletedUploads(t *testing.T) {
+	uploaded := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	day := uploaded.Unix() / 86400
+
+	previous := NewSummary()
+	for i := 0; i < 3; i++ {
+		previous.CountUpload("alice", uploaded)
+	}
+
+	// Пересчет видит только оставшийся файл
+	rebuilt := NewSummary()
+	rebuilt.CountUpload("alice", uploaded)
+	rebuilt.CountUpload("bob", uploaded)
+	rebuilt.mergeUploads(previous)
+
+	if got := rebuilt.Owners["alice"].Uploads[day]; got != 3 {
+		t.Errorf("alice uploads = %d, want 3", got)
+	}
+	if got := rebuilt.Owners["bob"].Uploads[day]; got != 1 {
+		t.Errorf("bob uploads = %d, want 1", got)
+	}
+}
+
+func TestSummaryCountUploadKeepsTwoDays(t *testing.T) {
+	first := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	summary := NewSummary()
+	summary.CountUpload("alice", first)
+	summary.CountUpload("alice", first.AddDate(0, 0, 1))
+	summary.CountUpload("alice", first.AddDate(0, 0, 2))
+
+	if got := len(summary.Owners["alice"].Uploads); got != 2 {
+		t.Errorf("kept %d days of upload counters, want 2", got)
+	}
+}
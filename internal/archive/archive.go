@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Поддерживаемые форматы архивов
+const (
+	FormatZIP   = "zip"
+	FormatTAR   = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+var (
+	// ErrUnsupported возвращается, если файл не является поддерживаемым архивом
+	ErrUnsupported = errors.New("unsupported archive")
+	// ErrEntryNotFound возвращается, если в архиве нет запрошенного файла
+	ErrEntryNotFound = errors.New("archive entry not found")
+)
+
+// Entry запись архива
+type Entry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Dir     bool      `json:"dir,omitempty"`
+}
+
+// Format возвращает формат архива по MIME-типу или пустую строку
+func Format(contentType string) string {
+	switch contentType {
+	case "application/zip":
+		return FormatZIP
+	case "application/x-tar":
+		return FormatTAR
+	case "application/gzip":
+		// Проверяется при чтении: внутри может быть не TAR
+		return FormatTarGz
+	}
+	return ""
+}
+
+// List возвращает список записей архива. ZIP читается через центральный
+// каталог в конце файла, TAR - по заголовкам с пропуском содержимого,
+// TAR.GZ - последовательно целиком
+func List(r io.ReaderAt, size int64, format string) ([]Entry, error) {
+	entries := []Entry{}
+
+	if format == FormatZIP {
+		archive, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		for _, f := range archive.File {
+			entries = append(entries, zipEntry(f))
+		}
+		return entries, nil
+	}
+
+	err := walkTar(r, size, format, func(header *tar.Header) bool {
+		if entry, ok := tarEntry(header); ok {
+			entries = append(entries, entry)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Open открывает запись архива для чтения
+func Open(r io.ReaderAt, size int64, format, name string) (io.ReadCloser, *Entry, error) {
+	name = cleanName(name)
+
+	if format == FormatZIP {
+		archive, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		for _, f := range archive.File {
+			entry := zipEntry(f)
+			if entry.Name != name || entry.Dir {
+				continue
+			}
+			reader, err := f.Open()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open %s: %w", name, err)
+			}
+			return reader, &entry, nil
+		}
+		return nil, nil, ErrEntryNotFound
+	}
+
+	// Для TAR содержимое читается из того же потока, поэтому возвращаем
+	// поток, который остается открытым после поиска записи
+	tarReader, closer, err := openTar(r, size, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			closer.Close()
+			return nil, nil, ErrEntryNotFound
+		}
+		if err != nil {
+			closer.Close()
+			return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		entry, ok := tarEntry(header)
+		if ok && !entry.Dir && entry.Name == name {
+			return readCloser{Reader: tarReader, Closer: closer}, &entry, nil
+		}
+	}
+}
+
+// walkTar перебирает записи TAR-архива
+func walkTar(r io.ReaderAt, size int64, format string, fn func(header *tar.Header) bool) error {
+	tarReader, closer, err := openTar(r, size, format)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for first := true; ; first = false {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if first {
+				return fmt.Errorf("%w: %v", ErrUnsupported, err)
+			}
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if !fn(header) {
+			return nil
+		}
+	}
+}
+
+// openTar открывает TAR-поток. Для несжатого TAR поток поддерживает Seek,
+// поэтому содержимое записей пропускается без чтения
+func openTar(r io.ReaderAt, size int64, format string) (*tar.Reader, io.Closer, error) {
+	section := io.NewSectionReader(r, 0, size)
+
+	switch format {
+	case FormatTAR:
+		return tar.NewReader(section), io.NopCloser(nil), nil
+	case FormatTarGz:
+		gz, err := gzip.NewReader(section)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		return tar.NewReader(gz), gz, nil
+	}
+	return nil, nil, ErrUnsupported
+}
+
+// zipEntry преобразует запись ZIP. Имена из старых архивов Windows без флага
+// UTF-8 обычно в кодировке CP866
+func zipEntry(f *zip.File) Entry {
+	name := f.Name
+	if f.NonUTF8 && !utf8.ValidString(name) {
+		if decoded, err := charmap.CodePage866.NewDecoder().String(name); err == nil {
+			name = decoded
+		}
+	}
+
+	return Entry{
+		Name:    cleanName(name),
+		Size:    int64(f.UncompressedSize64),
+		ModTime: f.Modified.UTC(),
+		Dir:     f.FileInfo().IsDir(),
+	}
+}
+
+// tarEntry преобразует заголовок TAR. Ссылки и специальные файлы пропускаются
+func tarEntry(header *tar.Header) (Entry, bool) {
+	entry := Entry{
+		Name:    cleanName(header.Name),
+		Size:    header.Size,
+		ModTime: header.ModTime.UTC(),
+	}
+
+	switch header.Typeflag {
+	case tar.TypeReg:
+	case tar.TypeDir:
+		entry.Dir = true
+		entry.Size = 0
+	default:
+		return entry, false
+	}
+	return entry, entry.Name != ""
+}
+
+// cleanName приводит путь записи к виду dir/file без ведущих ./ и /
+func cleanName(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(name, "/")
+}
+
+// readCloser объединяет поток записи и закрытие исходного потока
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
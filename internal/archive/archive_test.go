@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var testFiles = []struct {
+	name    string
+	content string
+}{
+	{"readme.txt", "hello"},
+	{"docs/guide.md", "# guide"},
+}
+
+func zipArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if _, err := w.Create("docs/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range testFiles {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.WriteHeader(&tar.Header{Name: "./docs/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: mtime})
+	w.WriteHeader(&tar.Header{Name: "link", Linkname: "readme.txt", Typeflag: tar.TypeSymlink, ModTime: mtime})
+	for _, f := range testFiles {
+		hdr := &tar.Header{Name: "./" + f.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.content)), ModTime: mtime}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func archives(t *testing.T) map[string][]byte {
+	return map[string][]byte{
+		FormatZIP:   zipArchive(t),
+		FormatTAR:   tarArchive(t),
+		FormatTarGz: gzipped(t, tarArchive(t)),
+	}
+}
+
+func TestList(t *testing.T) {
+	for format, data := range archives(t) {
+		t.Run(format, func(t *testing.T) {
+			entries, err := List(bytes.NewReader(data), int64(len(data)), format)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+				if entry.Dir != (entry.Name == "docs") {
+					t.Errorf("entry %q dir = %v", entry.Name, entry.Dir)
+				}
+			}
+			want := []string{"docs", "readme.txt", "docs/guide.md"}
+			if len(names) != len(want) {
+				t.Fatalf("List() = %v, want %v", names, want)
+			}
+			for i := range want {
+				if names[i] != want[i] {
+					t.Errorf("List() = %v, want %v", names, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for format, data := range archives(t) {
+		t.Run(format, func(t *testing.T) {
+			reader, entry, err := Open(bytes.NewReader(data), int64(len(data)), format, "/docs/../docs/guide.md")
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if string(content) != "# guide" || entry.Size != 7 {
+				t.Errorf("Open() = %q (%d bytes), want %q", content, entry.Size, "# guide")
+			}
+
+			for _, name := range []string{"missing.txt", "docs", "link"} {
+				if _, _, err := Open(bytes.NewReader(data), int64(len(data)), format, name); !errors.Is(err, ErrEntryNotFound) {
+					t.Errorf("Open(%q) error = %v, want ErrEntryNotFound", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestListMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+	}{
+		{"empty zip", FormatZIP, nil},
+		{"zip garbage", FormatZIP, []byte("PK\x03\x04 not really a zip")},
+		{"tar garbage", FormatTAR, bytes.Repeat([]byte("x"), 1024)},
+		{"gzip garbage", FormatTarGz, []byte("\x1f\x8bgarbage")},
+		{"gzip of non-tar", FormatTarGz, gzipped(t, bytes.Repeat([]byte("text "), 200))},
+		{"unknown format", "rar", []byte("Rar!")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := List(bytes.NewReader(tt.data), int64(len(tt.data)), tt.format); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("List() error = %v, want ErrUnsupported", err)
+			}
+		})
+	}
+}
+
+// TestListTruncated проверяет, что обрезанные архивы не приводят к панике
+func TestListTruncated(t *testing.T) {
+	for format, data := range archives(t) {
+		t.Run(format, func(t *testing.T) {
+			for n := 0; n < len(data); n += 7 {
+				List(bytes.NewReader(data[:n]), int64(n), format)
+				if reader, _, err := Open(bytes.NewReader(data[:n]), int64(n), format, "docs/guide.md"); err == nil {
+					io.Copy(io.Discard, reader)
+					reader.Close()
+				}
+			}
+		})
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := map[string]string{
+		"a/b.txt":          "a/b.txt",
+		"./a/b.txt":        "a/b.txt",
+		"/etc/passwd":      "etc/passwd",
+		"../../etc/passwd": "etc/passwd",
+		"dir\\file.txt":    "dir/file.txt",
+		"dir/":             "dir",
+		"":                 "",
+	}
+	for name, want := range tests {
+		if got := cleanName(name); got != want {
+			t.Errorf("cleanName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package attributes
+
+import (
+	"io"
+
+	"file-agent/internal/archive"
+)
+
+// archiveExtractor подсчитывает файлы в архиве указанного формата
+func archiveExtractor(format string) extractor {
+	return func(r io.ReaderAt, size int64, attrs Attributes) error {
+		entries, err := archive.List(r, size, format)
+		if err != nil {
+			return err
+		}
+
+		var files int
+		var total int64
+		for _, entry := range entries {
+			if entry.Dir {
+				continue
+			}
+			files++
+			total += entry.Size
+		}
+
+		attrs["entries"] = files
+		attrs["uncompressed_size"] = total
+		return nil
+	}
+}
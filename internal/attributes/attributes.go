@@ -0,0 +1,60 @@
+package attributes
+
+import (
+	"io"
+	"log"
+	"strings"
+
+	"file-agent/internal/archive"
+	"file-agent/internal/storage"
+)
+
+// Attributes атрибуты файла, зависящие от его типа: размеры изображения,
+// число страниц, длительность и т.п.
+type Attributes map[string]interface{}
+
+// extractor извлекает атрибуты файла определенного типа
+type extractor func(r io.ReaderAt, size int64, attrs Attributes) error
+
+// Extract извлекает атрибуты файла по его типу. Ошибки разбора не считаются
+// фатальными: возвращается то, что удалось извлечь, или nil
+func Extract(r io.ReaderAt, size int64, contentType string) Attributes {
+	extract := extractorFor(contentType)
+	if extract == nil {
+		return nil
+	}
+
+	attrs := Attributes{}
+	if err := extract(r, size, attrs); err != nil {
+		log.Printf("Failed to extract attributes from %s file: %v", contentType, err)
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+// extractorFor выбирает обработчик по типу файла
+func extractorFor(contentType string) extractor {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return extractImage
+	case "application/pdf":
+		return extractPDF
+	case "audio/wav":
+		return extractWAV
+	case "audio/flac":
+		return extractFLAC
+	case "audio/mpeg":
+		return extractMP3
+	case "video/mp4", "video/quicktime", "audio/mp4", "video/3gpp":
+		return extractMP4
+	}
+	if format := archive.Format(contentType); format != "" {
+		return archiveExtractor(format)
+	}
+	if storage.IsTextual(contentType) && !strings.HasSuffix(contentType, "svg+xml") {
+		return extractText
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package attributes
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+// quietLog отключает журнал ошибок разбора на время теста
+func quietLog(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+}
+
+func wavFile() []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	data = binary.LittleEndian.AppendUint32(data, 16)
+	data = binary.LittleEndian.AppendUint16(data, 1)     // PCM
+	data = binary.LittleEndian.AppendUint16(data, 2)     // Каналы
+	data = binary.LittleEndian.AppendUint32(data, 8000)  // Частота
+	data = binary.LittleEndian.AppendUint32(data, 32000) // Байт в секунду
+	data = binary.LittleEndian.AppendUint16(data, 4)
+	data = binary.LittleEndian.AppendUint16(data, 16)
+	data = append(data, "data"...)
+	data = binary.LittleEndian.AppendUint32(data, 32000)
+	data = append(data, make([]byte, 32000)...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func flacFile() []byte {
+	info := make([]byte, 34)
+	// 44100 Гц, 2 канала, 16 бит, 88200 сэмплов
+	info[10], info[11], info[12], info[13] = 0x0A, 0xC4, 0x42, 0xF0
+	binary.BigEndian.PutUint32(info[14:], 88200)
+	return append([]byte("fLaC\x80\x00\x00\x22"), info...)
+}
+
+func mp3File() []byte {
+	// Пустой тег ID3v2 и кадр MPEG-1 Layer III 128 кбит/с, 44100 Гц, стерео
+	data := []byte("ID3\x03\x00\x00\x00\x00\x00\x00")
+	data = append(data, 0xFF, 0xFB, 0x90, 0x64)
+	return append(data, make([]byte, 16000-4)...)
+}
+
+func box(kind string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, kind...), body...)
+}
+
+func mp4File() []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)  // Единиц в секунду
+	binary.BigEndian.PutUint32(mvhd[16:], 90500) // Длительность
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+	moov := box("moov", box("mvhd", mvhd), box("trak", box("tkhd", tkhd)))
+	return append(box("ftyp", []byte("isom\x00\x00\x02\x00")), moov...)
+}
+
+const pdfFile = "%PDF-1.4\n" +
+	"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+	"2 0 obj << /Type /Pages /Kids [] /Count 3 >> endobj\n" +
+	"3 0 obj << /Title (Hello \\(world\\)) >> endobj\n" +
+	"trailer << /Root 1 0 R /Info 3 0 R >>\n%%EOF\n"
+
+func zipFile(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"a.txt": "hello", "dir/b.txt": "world!"} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(f, content)
+	}
+	if _, err := w.Create("dir/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func pngFile(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fixtures корректные файлы поддерживаемых типов и их ожидаемые атрибуты
+func fixtures(t *testing.T) []struct {
+	contentType string
+	data        []byte
+	want        Attributes
+} {
+	return []struct {
+		contentType string
+		data        []byte
+		want        Attributes
+	}{
+		{"audio/wav", wavFile(), Attributes{"channels": 2, "sample_rate": 8000, "duration": 1.0}},
+		{"audio/flac", flacFile(), Attributes{"channels": 2, "sample_rate": 44100, "duration": 2.0}},
+		{"audio/mpeg", mp3File(), Attributes{"channels": 2, "sample_rate": 44100, "bitrate": 128000, "duration": 1.0}},
+		{"video/mp4", mp4File(), Attributes{"duration": 90.5, "width": 1920, "height": 1080}},
+		{"application/pdf", []byte(pdfFile), Attributes{"pages": 3, "title": "Hello (world)"}},
+		{"application/zip", zipFile(t), Attributes{"entries": 2, "uncompressed_size": int64(11)}},
+		{"image/png", pngFile(t), Attributes{"width": 3, "height": 2}},
+		{"text/plain", []byte("a\nb\nc"), Attributes{"lines": 3}},
+	}
+}
+
+func TestExtract(t *testing.T) {
+	for _, tt := range fixtures(t) {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got := Extract(bytes.NewReader(tt.data), int64(len(tt.data)), tt.contentType)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractTruncated проверяет, что обрезанные файлы не приводят к панике
+func TestExtractTruncated(t *testing.T) {
+	quietLog(t)
+	for _, tt := range fixtures(t) {
+		t.Run(tt.contentType, func(t *testing.T) {
+			for n := 0; n < len(tt.data); {
+				data := tt.data[:n]
+				Extract(bytes.NewReader(data), int64(n), tt.contentType)
+				if n < 256 {
+					n++
+				} else {
+					n += 97
+				}
+			}
+		})
+	}
+}
+
+func TestExtractMalformed(t *testing.T) {
+	quietLog(t)
+
+	hugeBox := append(binary.BigEndian.AppendUint32(nil, 1), "moov"...)
+	hugeBox = binary.BigEndian.AppendUint64(hugeBox, 1<<62)
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		want        Attributes
+	}{
+		{
+			// Тег ID3v2 длиннее файла
+			name:        "mp3 oversized id3",
+			contentType: "audio/mpeg",
+			data:        append([]byte("ID3\x03\x00\x00\x7f\x7f\x7f\x7f"), make([]byte, 10)...),
+		},
+		{
+			name:        "mp3 id3 with footer at end of file",
+			contentType: "audio/mpeg",
+			data:        []byte("ID3\x04\x00\x10\x00\x00\x00\x00"),
+		},
+		{name: "mp3 without frames", contentType: "audio/mpeg", data: bytes.Repeat([]byte{0xFF}, 100)},
+		{name: "empty mp3", contentType: "audio/mpeg", data: nil},
+		{
+			name:        "wav with huge chunk",
+			contentType: "audio/wav",
+			data:        []byte("RIFF\x00\x00\x00\x00WAVEjunk\xff\xff\xff\xffdata"),
+		},
+		{
+			name:        "wav with short fmt",
+			contentType: "audio/wav",
+			data:        []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00"),
+		},
+		{name: "flac with other first block", contentType: "audio/flac", data: append([]byte("fLaC\x01"), make([]byte, 40)...)},
+		{name: "mp4 with huge box", contentType: "video/mp4", data: hugeBox},
+		{name: "mp4 with too large moov", contentType: "video/mp4", data: append(binary.BigEndian.AppendUint32(nil, maxMoovSize+9), "moov"...)},
+		{name: "mp4 with invalid box size", contentType: "video/mp4", data: []byte("\x00\x00\x00\x04moov")},
+		{name: "mp4 box of zero size", contentType: "video/mp4", data: []byte("\x00\x00\x00\x00free")},
+		{name: "mp4 truncated moov", contentType: "video/mp4", data: []byte("\x00\x00\x00\xffmoov\x00\x00\x00\x30mvhd")},
+		{name: "pdf with unterminated title", contentType: "application/pdf", data: []byte("1 0 obj << /Title (abc\\")},
+		{name: "pdf with broken stream", contentType: "application/pdf", data: []byte("stream\nxx stream\r\n\x78\x9c\xff")},
+		{name: "zip garbage", contentType: "application/zip", data: []byte("PK\x05\x06garbage")},
+		{name: "gzip garbage", contentType: "application/gzip", data: []byte("\x1f\x8b\x08garbage")},
+		{name: "png garbage", contentType: "image/png", data: []byte("\x89PNG\r\n\x1a\n\x00\x00")},
+		{name: "empty text", contentType: "text/plain", data: nil, want: Attributes{"lines": 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Extract(bytes.NewReader(tt.data), int64(len(tt.data)), tt.contentType)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractMP3OversizedID3(t *testing.T) {
+	data := append([]byte("ID3\x03\x00\x00\x7f\x7f\x7f\x7f"), make([]byte, 10)...)
+	err := extractMP3(bytes.NewReader(data), int64(len(data)), Attributes{})
+	if err == nil {
+		t.Fatal("extractMP3() error = nil, want error")
+	}
+}
@@ -0,0 +1,32 @@
+package attributes
+
+import (
+	"image"
+	"io"
+
+	"file-agent/internal/imaging"
+)
+
+// exifScanLength сколько байт начала файла просматривается в поисках EXIF
+const exifScanLength = 256 << 10
+
+// extractImage извлекает размеры изображения с учетом ориентации из EXIF
+func extractImage(r io.ReaderAt, size int64, attrs Attributes) error {
+	cfg, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+
+	width, height := cfg.Width, cfg.Height
+
+	head := make([]byte, min(size, exifScanLength))
+	n, _ := r.ReadAt(head, 0)
+	if imaging.Orientation(head[:n]) >= 5 {
+		// Изображение отображается повернутым на 90°
+		width, height = height, width
+	}
+
+	attrs["width"] = width
+	attrs["height"] = height
+	return nil
+}
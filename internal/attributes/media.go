@@ -0,0 +1,315 @@
+package attributes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxMoovSize ограничение на размер заголовка MP4 (moov), читаемого в память
+const maxMoovSize = 16 << 20
+
+var errUnrecognized = errors.New("unrecognized media format")
+
+// setDuration сохраняет длительность в секундах с точностью до миллисекунды
+func setDuration(attrs Attributes, seconds float64) {
+	if seconds > 0 && !math.IsInf(seconds, 0) {
+		attrs["duration"] = math.Round(seconds*1000) / 1000
+	}
+}
+
+// extractWAV извлекает параметры из заголовка WAV (RIFF)
+func extractWAV(r io.ReaderAt, size int64, attrs Attributes) error {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return errUnrecognized
+	}
+
+	var byteRate uint32
+	chunk := make([]byte, 8)
+	for pos := int64(12); pos+8 <= size; {
+		if _, err := r.ReadAt(chunk, pos); err != nil {
+			return err
+		}
+		length := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			format := make([]byte, 16)
+			if _, err := r.ReadAt(format, pos+8); err != nil {
+				return err
+			}
+			attrs["channels"] = int(binary.LittleEndian.Uint16(format[2:]))
+			attrs["sample_rate"] = int(binary.LittleEndian.Uint32(format[4:]))
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+		case "data":
+			if byteRate > 0 {
+				// Размер данных может быть не заполнен при потоковой записи
+				length = min(length, size-pos-8)
+				setDuration(attrs, float64(length)/float64(byteRate))
+			}
+			return nil
+		}
+
+		pos += 8 + length + length%2
+	}
+	return nil
+}
+
+// extractFLAC извлекает параметры из блока STREAMINFO
+func extractFLAC(r io.ReaderAt, size int64, attrs Attributes) error {
+	header := make([]byte, 8+34)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:4]) != "fLaC" || header[4]&0x7F != 0 {
+		return errUnrecognized
+	}
+
+	info := header[8:]
+	sampleRate := int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	channels := int(info[12]>>1&0x07) + 1
+	samples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:]))
+
+	attrs["sample_rate"] = sampleRate
+	attrs["channels"] = channels
+	if sampleRate > 0 {
+		setDuration(attrs, float64(samples)/float64(sampleRate))
+	}
+	return nil
+}
+
+// Таблицы битрейтов MPEG Layer III (кбит/с) и частот дискретизации MPEG-1
+var (
+	mp3Bitrates   = [2][16]int{{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}}
+	mp3SampleRate = [3]int{44100, 48000, 32000}
+)
+
+// extractMP3 вычисляет длительность MP3 по заголовку Xing/Info/VBRI, а при его
+// отсутствии - по битрейту первого кадра (CBR)
+func extractMP3(r io.ReaderAt, size int64, attrs Attributes) error {
+	head := make([]byte, min(size, 64<<10))
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+
+	// Пропускаем тег ID3v2
+	start := int64(0)
+	if len(head) >= 10 && string(head[:3]) == "ID3" {
+		start = 10 + (int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 | int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F))
+		if head[5]&0x10 != 0 {
+			start += 10
+		}
+		if start >= size {
+			// Тег длиннее файла
+			return fmt.Errorf("%w: id3 tag exceeds file size", errUnrecognized)
+		}
+		if start+4 > int64(len(head)) {
+			head = make([]byte, min(size-start, 64<<10))
+			n, err := r.ReadAt(head, start)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			head = head[:n]
+		} else {
+			head = head[start:]
+		}
+	}
+
+	// Ищем первый кадр MPEG Layer III
+	for i := 0; i+4 <= len(head); i++ {
+		if head[i] != 0xFF || head[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version := head[i+1] >> 3 & 0x03
+		layer := head[i+1] >> 1 & 0x03
+		bitrateIndex := head[i+2] >> 4
+		rateIndex := head[i+2] >> 2 & 0x03
+		if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+
+		mpeg1 := version == 3
+		mono := head[i+3]>>6 == 3
+		sampleRate := mp3SampleRate[rateIndex]
+		samplesPerFrame := 1152
+		table := 0
+		sideInfo := 32
+		if !mpeg1 {
+			sampleRate /= 2
+			if version == 0 {
+				sampleRate /= 2 // MPEG-2.5
+			}
+			samplesPerFrame = 576
+			table = 1
+			sideInfo = 17
+			if mono {
+				sideInfo = 9
+			}
+		} else if mono {
+			sideInfo = 17
+		}
+
+		channels := 2
+		if mono {
+			channels = 1
+		}
+		attrs["sample_rate"] = sampleRate
+		attrs["channels"] = channels
+
+		if frames := vbrFrames(head[i:], sideInfo); frames > 0 {
+			setDuration(attrs, float64(frames)*float64(samplesPerFrame)/float64(sampleRate))
+			return nil
+		}
+
+		bitrate := mp3Bitrates[table][bitrateIndex] * 1000
+		attrs["bitrate"] = bitrate
+		audio := size - start - int64(i)
+		if tag := make([]byte, 3); size >= 128 {
+			if _, err := r.ReadAt(tag, size-128); err == nil && string(tag) == "TAG" {
+				audio -= 128
+			}
+		}
+		setDuration(attrs, float64(audio)*8/float64(bitrate))
+		return nil
+	}
+
+	return fmt.Errorf("%w: no mpeg frame found", errUnrecognized)
+}
+
+// vbrFrames возвращает число кадров из заголовка Xing/Info или VBRI
+func vbrFrames(frame []byte, sideInfo int) uint32 {
+	xing := 4 + sideInfo
+	if len(frame) >= xing+12 {
+		tag := string(frame[xing : xing+4])
+		if (tag == "Xing" || tag == "Info") && frame[xing+7]&0x01 != 0 {
+			return binary.BigEndian.Uint32(frame[xing+8:])
+		}
+	}
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[36+14:])
+	}
+	return 0
+}
+
+// extractMP4 извлекает длительность и размеры видео из заголовка moov
+func extractMP4(r io.ReaderAt, size int64, attrs Attributes) error {
+	moov, err := readMoov(r, size)
+	if err != nil {
+		return err
+	}
+
+	if mvhd := findBox(moov, "mvhd"); len(mvhd) >= 20 {
+		var timescale uint32
+		var duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale = binary.BigEndian.Uint32(mvhd[20:])
+			duration = binary.BigEndian.Uint64(mvhd[24:])
+		} else {
+			timescale = binary.BigEndian.Uint32(mvhd[12:])
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+		}
+		if timescale > 0 {
+			setDuration(attrs, float64(duration)/float64(timescale))
+		}
+	}
+
+	// Размеры берутся из заголовка видеодорожки (у звуковых дорожек они нулевые)
+	for _, trak := range findBoxes(moov, "trak") {
+		tkhd := findBox(trak, "tkhd")
+		offset := 76
+		if len(tkhd) > 0 && tkhd[0] == 1 {
+			offset = 88
+		}
+		if len(tkhd) < offset+8 {
+			continue
+		}
+		width := binary.BigEndian.Uint32(tkhd[offset:]) >> 16
+		height := binary.BigEndian.Uint32(tkhd[offset+4:]) >> 16
+		if width > 0 && height > 0 {
+			attrs["width"] = int(width)
+			attrs["height"] = int(height)
+			break
+		}
+	}
+
+	return nil
+}
+
+// readMoov находит и читает бокс moov среди боксов верхнего уровня.
+// moov может находиться как в начале, так и в конце файла
+func readMoov(r io.ReaderAt, size int64) ([]byte, error) {
+	header := make([]byte, 16)
+	for pos := int64(0); pos+8 <= size; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return nil, err
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		switch length {
+		case 0:
+			length = size - pos
+		case 1:
+			if _, err := r.ReadAt(header[8:], pos+8); err != nil {
+				return nil, err
+			}
+			length = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if length < headerSize {
+			return nil, fmt.Errorf("%w: invalid box size", errUnrecognized)
+		}
+
+		if string(header[4:8]) == "moov" {
+			if length > maxMoovSize {
+				return nil, fmt.Errorf("moov box is too large: %d bytes", length)
+			}
+			moov := make([]byte, length-headerSize)
+			if _, err := r.ReadAt(moov, pos+headerSize); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return moov, nil
+		}
+
+		pos += length
+	}
+	return nil, fmt.Errorf("%w: moov box not found", errUnrecognized)
+}
+
+// findBox ищет бокс в дереве боксов и возвращает его содержимое
+func findBox(data []byte, boxType string) []byte {
+	if boxes := findBoxes(data, boxType); len(boxes) > 0 {
+		return boxes[0]
+	}
+	return nil
+}
+
+// findBoxes возвращает содержимое всех боксов указанного типа на одном уровне,
+// спускаясь в контейнеры moov, trak и mdia
+func findBoxes(data []byte, boxType string) [][]byte {
+	var found [][]byte
+	for pos := 0; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 8 || pos+length > len(data) {
+			break
+		}
+		kind := data[pos+4 : pos+8]
+		content := data[pos+8 : pos+length]
+
+		if bytes.Equal(kind, []byte(boxType)) {
+			found = append(found, content)
+		} else if boxType != "trak" && (bytes.Equal(kind, []byte("trak")) || bytes.Equal(kind, []byte("mdia"))) {
+			found = append(found, findBoxes(content, boxType)...)
+		}
+		pos += length
+	}
+	return found
+}
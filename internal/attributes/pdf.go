@@ -0,0 +1,274 @@
+package attributes
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// maxPDFSize максимальный размер PDF, который разбирается целиком
+	maxPDFSize = 64 << 20
+	// maxInflated ограничение на объем распакованных потоков (защита от "бомб")
+	maxInflated = 64 << 20
+)
+
+var (
+	pagesPattern = regexp.MustCompile(`/Type\s*/Pages\b`)
+	countPattern = regexp.MustCompile(`/Count\s+(\d+)`)
+	infoPattern  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	titlePattern = regexp.MustCompile(`/Title\s*([(<])`)
+)
+
+// extractPDF извлекает число страниц и заголовок документа
+func extractPDF(r io.ReaderAt, size int64, attrs Attributes) error {
+	if size > maxPDFSize {
+		return fmt.Errorf("pdf is too large to parse: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return err
+	}
+
+	// Дерево страниц может находиться в сжатых потоках объектов (PDF 1.5+)
+	pages := countPages(data)
+	if pages == 0 {
+		pages = countPages(inflateStreams(data))
+	}
+	if pages > 0 {
+		attrs["pages"] = pages
+	}
+
+	if title := pdfTitle(data); title != "" {
+		attrs["title"] = title
+	}
+	return nil
+}
+
+// countPages возвращает значение /Count корня дерева страниц - наибольшее
+// среди всех узлов /Type /Pages
+func countPages(data []byte) int {
+	pages := 0
+	for _, loc := range pagesPattern.FindAllIndex(data, -1) {
+		dict := enclosingDict(data, loc[0])
+		if match := countPattern.FindSubmatch(dict); match != nil {
+			if n, err := strconv.Atoi(string(match[1])); err == nil && n > pages {
+				pages = n
+			}
+		}
+	}
+	return pages
+}
+
+// pdfTitle находит заголовок в словаре /Info последней редакции документа
+func pdfTitle(data []byte) string {
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		// Строки зашифрованного документа не читаются без ключа
+		return ""
+	}
+
+	refs := infoPattern.FindAllSubmatch(data, -1)
+	if len(refs) == 0 {
+		return ""
+	}
+	ref := refs[len(refs)-1]
+
+	objPattern := regexp.MustCompile(`(?:^|\s)` + string(ref[1]) + `\s+` + string(ref[2]) + `\s+obj\b`)
+	objects := objPattern.FindAllIndex(data, -1)
+	if len(objects) == 0 {
+		return ""
+	}
+	start := objects[len(objects)-1][1]
+	end := bytes.Index(data[start:], []byte("endobj"))
+	if end < 0 {
+		return ""
+	}
+	object := data[start : start+end]
+
+	match := titlePattern.FindSubmatchIndex(object)
+	if match == nil {
+		return ""
+	}
+
+	var raw []byte
+	if object[match[2]] == '(' {
+		raw = parseLiteralString(object[match[3]:])
+	} else {
+		raw = parseHexString(object[match[3]:])
+	}
+	return strings.TrimSpace(decodePDFText(raw))
+}
+
+// enclosingDict возвращает словарь << ... >>, внутри которого находится pos
+func enclosingDict(data []byte, pos int) []byte {
+	start := -1
+	depth := 0
+	for i := pos - 1; i > 0; i-- {
+		if data[i-1] == '>' && data[i] == '>' {
+			depth++
+			i--
+		} else if data[i-1] == '<' && data[i] == '<' {
+			if depth == 0 {
+				start = i - 1
+				break
+			}
+			depth--
+			i--
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	depth = 0
+	for i := start; i+1 < len(data); i++ {
+		if data[i] == '<' && data[i+1] == '<' {
+			depth++
+			i++
+		} else if data[i] == '>' && data[i+1] == '>' {
+			depth--
+			i++
+			if depth == 0 {
+				return data[start : i+1]
+			}
+		}
+	}
+	return nil
+}
+
+// inflateStreams распаковывает сжатые потоки документа
+func inflateStreams(data []byte) []byte {
+	var out bytes.Buffer
+	keyword := []byte("stream")
+
+	for pos := 0; out.Len() < maxInflated; {
+		i := bytes.Index(data[pos:], keyword)
+		if i < 0 {
+			break
+		}
+		start := pos + i + len(keyword)
+		pos = start
+
+		// После ключевого слова идет перевод строки (\r\n или \n)
+		if start < len(data) && data[start] == '\r' {
+			start++
+		}
+		if start >= len(data) || data[start] != '\n' {
+			continue
+		}
+		start++
+
+		zr, err := zlib.NewReader(bytes.NewReader(data[start:]))
+		if err != nil {
+			continue
+		}
+		io.Copy(&out, io.LimitReader(zr, int64(maxInflated-out.Len())))
+		zr.Close()
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+// parseLiteralString разбирает строку PDF в круглых скобках (после открывающей)
+func parseLiteralString(data []byte) []byte {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+		case '\\':
+			i++
+			if i >= len(data) {
+				return out
+			}
+			c = data[i]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// Перенос строки внутри строки
+				if c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					// Восьмеричный код из 1-3 цифр
+					n := 0
+					for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+						n = n*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					c = byte(n)
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// parseHexString разбирает строку PDF в угловых скобках (после открывающей)
+func parseHexString(data []byte) []byte {
+	end := bytes.IndexByte(data, '>')
+	if end < 0 {
+		return nil
+	}
+
+	digits := make([]byte, 0, end)
+	for _, c := range data[:end] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out, _ := hex.DecodeString(string(digits))
+	return out
+}
+
+// decodePDFText декодирует текстовую строку PDF: UTF-16BE с BOM, UTF-8 с BOM
+// или PDFDocEncoding (приближенно - Latin-1)
+func decodePDFText(raw []byte) string {
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xFE, 0xFF}):
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}):
+		return string(raw[3:])
+	}
+
+	runes := make([]rune, len(raw))
+	for i, c := range raw {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,40 @@
+package attributes
+
+import (
+	"bytes"
+	"io"
+)
+
+// extractText подсчитывает количество строк в текстовом файле
+func extractText(r io.ReaderAt, size int64, attrs Attributes) error {
+	if size == 0 {
+		attrs["lines"] = 0
+		return nil
+	}
+
+	lines := 0
+	last := byte('\n')
+	buf := make([]byte, 64<<10)
+	reader := io.NewSectionReader(r, 0, size)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Последняя строка без перевода строки тоже считается
+	if last != '\n' {
+		lines++
+	}
+
+	attrs["lines"] = lines
+	return nil
+}
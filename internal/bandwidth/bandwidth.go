@@ -0,0 +1,204 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// ChunkSize максимальный объем, отправляемый клиенту за одно ожидание лимитов
+const ChunkSize = 32 << 10
+
+// idleTimeout время, после которого неиспользуемый лимит клиента удаляется
+const idleTimeout = 10 * time.Minute
+
+// Limiter ограничивает скорость передачи алгоритмом token bucket. Объем
+// резервируется сразу, поэтому ожидающие передачи обслуживаются по очереди
+type Limiter struct {
+	rate  float64 // Байт в секунду
+	burst float64 // Объем, который можно отправить без ожидания
+
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
+}
+
+// NewLimiter создает ограничение rate байт в секунду
+func NewLimiter(rate int64) *Limiter {
+	burst := float64(max(rate, ChunkSize))
+	now := time.Now()
+	return &Limiter{rate: float64(rate), burst: burst, tokens: burst, last: now, lastUsed: now}
+}
+
+// Wait резервирует n байт и ждет, пока их можно будет отправить
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.lastUsed = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Клиент отключился: возвращаем неиспользованный резерв
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// idle проверяет, не использовался ли лимит с момента before
+func (l *Limiter) idle(before time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastUsed.Before(before)
+}
+
+// Group лимиты с одинаковой скоростью для разных ключей (адресов, пользователей)
+type Group struct {
+	rate int64
+
+	mu       sync.Mutex
+	limiters map[string]*Limiter
+	cleaned  time.Time
+}
+
+// NewGroup создает группу лимитов rate байт в секунду
+func NewGroup(rate int64) *Group {
+	return &Group{rate: rate, limiters: make(map[string]*Limiter), cleaned: time.Now()}
+}
+
+// Get возвращает лимит для ключа; давно не использовавшиеся лимиты удаляются
+func (g *Group) Get(key string) *Limiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(g.cleaned) > idleTimeout {
+		for k, l := range g.limiters {
+			if l.idle(now.Add(-idleTimeout)) {
+				delete(g.limiters, k)
+			}
+		}
+		g.cleaned = now
+	}
+
+	l, ok := g.limiters[key]
+	if !ok {
+		l = NewLimiter(g.rate)
+		g.limiters[key] = l
+	}
+	return l
+}
+
+// Limits ограничения исходящего трафика в байтах в секунду; 0 - без ограничения
+type Limits struct {
+	Global  int64
+	PerIP   int64
+	PerUser int64
+	PerFile int64
+}
+
+// Throttle ограничивает скорость отдачи файлов
+type Throttle struct {
+	global *Limiter
+	ips    *Group
+	users  *Group
+	files  *Group
+}
+
+// Transfer описывает отдачу файла
+type Transfer struct {
+	ClientIP string
+	User     string // Пустой для неаутентифицированных клиентов
+	FileID   string
+}
+
+// NewThrottle создает ограничение исходящего трафика
+func NewThrottle(limits Limits) *Throttle {
+	t := &Throttle{}
+	if limits.Global > 0 {
+		t.global = NewLimiter(limits.Global)
+	}
+	if limits.PerIP > 0 {
+		t.ips = NewGroup(limits.PerIP)
+	}
+	if limits.PerUser > 0 {
+		t.users = NewGroup(limits.PerUser)
+	}
+	if limits.PerFile > 0 {
+		t.files = NewGroup(limits.PerFile)
+	}
+	return t
+}
+
+// Writer возвращает w с ограничением скорости для передачи. Если ни один
+// лимит не применим, возвращается w без изменений
+func (t *Throttle) Writer(ctx context.Context, w io.Writer, transfer Transfer) io.Writer {
+	if t == nil {
+		return w
+	}
+
+	var limiters []*Limiter
+	if t.global != nil {
+		limiters = append(limiters, t.global)
+	}
+	if t.ips != nil && transfer.ClientIP != "" {
+		limiters = append(limiters, t.ips.Get(transfer.ClientIP))
+	}
+	if t.users != nil && transfer.User != "" {
+		limiters = append(limiters, t.users.Get(transfer.User))
+	}
+	if t.files != nil && transfer.FileID != "" {
+		limiters = append(limiters, t.files.Get(transfer.FileID))
+	}
+
+	if len(limiters) == 0 {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, limiters: limiters}
+}
+
+// writer отправляет данные частями, дожидаясь всех лимитов перед каждой
+type writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), ChunkSize)]
+		for _, l := range w.limiters {
+			if err := l.Wait(w.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
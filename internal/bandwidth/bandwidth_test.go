@@ -0,0 +1,136 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(4 * ChunkSize)
+	ctx := context.Background()
+
+	// Объем, передаваемый за секунду, отправляется без ожидания
+	start := time.Now()
+	if err := l.Wait(ctx, 4*ChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("burst waited %v", elapsed)
+	}
+
+	// Следующие 2 части при 4 частях в секунду - около 0.5s
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, ChunkSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond || elapsed > time.Second {
+		t.Errorf("2 chunks at 4 chunks/s took %v, want about 500ms", elapsed)
+	}
+}
+
+func TestLimiterWaitCanceled(t *testing.T) {
+	l := NewLimiter(ChunkSize)
+	if err := l.Wait(context.Background(), ChunkSize); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, 10*ChunkSize); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Резерв отключившегося клиента возвращается
+	l.mu.Lock()
+	tokens := l.tokens
+	l.mu.Unlock()
+	if tokens < -ChunkSize/10 {
+		t.Errorf("tokens = %v after canceled wait, want refund", tokens)
+	}
+}
+
+func TestThrottleWriterLimiters(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.Background()
+	anonymous := Transfer{ClientIP: "10.0.0.1", FileID: "1"}
+	alice := Transfer{ClientIP: "10.0.0.1", User: "alice", FileID: "1"}
+
+	var nilThrottle *Throttle
+	if w := nilThrottle.Writer(ctx, &buf, alice); w != io.Writer(&buf) {
+		t.Error("nil throttle wrapped the writer")
+	}
+	if w := NewThrottle(Limits{}).Writer(ctx, &buf, alice); w != io.Writer(&buf) {
+		t.Error("throttle without limits wrapped the writer")
+	}
+
+	// Лимит пользователя применяется только к аутентифицированным клиентам
+	perUser := NewThrottle(Limits{PerUser: ChunkSize})
+	if w := perUser.Writer(ctx, &buf, anonymous); w != io.Writer(&buf) {
+		t.Error("per-user limit was applied to an anonymous client")
+	}
+	limited, ok := perUser.Writer(ctx, &buf, alice).(*writer)
+	if !ok || len(limited.limiters) != 1 || limited.limiters[0] != perUser.users.Get("alice") {
+		t.Errorf("alice is not limited by her own per-user limit")
+	}
+
+	all := NewThrottle(Limits{Global: ChunkSize, PerIP: ChunkSize, PerUser: ChunkSize, PerFile: ChunkSize})
+	if w, ok := all.Writer(ctx, &buf, anonymous).(*writer); !ok || len(w.limiters) != 3 {
+		t.Errorf("anonymous client is limited by %d limits, want global, per-IP and per-file", len(w.limiters))
+	}
+	if w, ok := all.Writer(ctx, &buf, alice).(*writer); !ok || len(w.limiters) != 4 {
+		t.Errorf("alice is limited by %d limits, want 4", len(w.limiters))
+	}
+}
+
+func TestThrottleSharedUserLimit(t *testing.T) {
+	throttle := NewThrottle(Limits{PerUser: 4 * ChunkSize})
+	ctx := context.Background()
+
+	// Скачивания одного пользователя с разных адресов делят лимит
+	first := throttle.Writer(ctx, io.Discard, Transfer{ClientIP: "10.0.0.1", User: "alice"})
+	second := throttle.Writer(ctx, io.Discard, Transfer{ClientIP: "10.0.0.2", User: "alice"})
+	data := make([]byte, 3*ChunkSize)
+
+	start := time.Now()
+	for _, w := range []io.Writer{first, second} {
+		if n, err := w.Write(data); err != nil || n != len(data) {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond || elapsed > time.Second {
+		t.Errorf("6 chunks at 4 chunks/s took %v, want about 500ms", elapsed)
+	}
+
+	// Другой пользователь ограничен своим лимитом
+	start = time.Now()
+	if _, err := throttle.Writer(ctx, io.Discard, Transfer{User: "bob"}).Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("bob waited %v for alice's limit", elapsed)
+	}
+}
+
+func TestGroupRemovesIdleLimiters(t *testing.T) {
+	g := NewGroup(ChunkSize)
+	l := g.Get("10.0.0.1")
+	if g.Get("10.0.0.1") != l {
+		t.Fatal("Get() returned a new limiter for the same key")
+	}
+
+	l.mu.Lock()
+	l.lastUsed = time.Now().Add(-2 * idleTimeout)
+	l.mu.Unlock()
+	g.cleaned = time.Now().Add(-2 * idleTimeout)
+
+	g.Get("10.0.0.2")
+	if _, ok := g.limiters["10.0.0.1"]; ok {
+		t.Error("idle limiter was not removed")
+	}
+}
@@ -0,0 +1,177 @@
+package charset
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	textunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// SampleSize сколько байт начала файла используется для определения кодировки
+const SampleSize = 64 << 10
+
+// Поддерживаемые кодировки (имена IANA)
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1251 = "windows-1251"
+	KOI8R       = "koi8-r"
+	IBM866      = "ibm866"
+	Windows1252 = "windows-1252"
+)
+
+// ErrUnknown возвращается для неподдерживаемой кодировки
+var ErrUnknown = errors.New("unknown charset")
+
+var encodings = map[string]encoding.Encoding{
+	UTF16LE:     textunicode.UTF16(textunicode.LittleEndian, textunicode.UseBOM),
+	UTF16BE:     textunicode.UTF16(textunicode.BigEndian, textunicode.UseBOM),
+	Windows1251: charmap.Windows1251,
+	KOI8R:       charmap.KOI8R,
+	IBM866:      charmap.CodePage866,
+	Windows1252: charmap.Windows1252,
+}
+
+// aliases распространенные альтернативные имена кодировок
+var aliases = map[string]string{
+	"utf8":   UTF8,
+	"cp1251": Windows1251,
+	"koi8r":  KOI8R,
+	"cp866":  IBM866,
+	"cp1252": Windows1252,
+}
+
+// Normalize приводит имя кодировки к каноническому виду. Для неизвестных
+// кодировок возвращается пустая строка
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+	if _, ok := encodings[name]; ok || name == UTF8 {
+		return name
+	}
+	return ""
+}
+
+// NewReader возвращает поток, перекодированный из кодировки from в UTF-8
+func NewReader(r io.Reader, from string) (io.Reader, error) {
+	from = Normalize(from)
+	if from == UTF8 {
+		return r, nil
+	}
+	enc, ok := encodings[from]
+	if !ok {
+		return nil, ErrUnknown
+	}
+	return transform.NewReader(r, enc.NewDecoder()), nil
+}
+
+// Detect определяет кодировку текста по образцу. Различаются UTF-8, UTF-16
+// (по BOM), кириллические однобайтовые кодировки и Windows-1252
+func Detect(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return UTF8
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return UTF16LE
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return UTF16BE
+	}
+
+	if validUTF8(sample) {
+		return UTF8
+	}
+
+	// Выбираем однобайтовую кодировку, в которой текст больше всего похож на
+	// осмысленный: частые строчные буквы внутри слов одного алфавита
+	best, bestScore := Windows1252, scoreText(charmap.Windows1252, sample)
+	for _, name := range []string{Windows1251, KOI8R, IBM866} {
+		if score := scoreText(encodings[name].(*charmap.Charmap), sample); score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best
+}
+
+// validUTF8 проверяет UTF-8, допуская обрезанный последний символ образца
+func validUTF8(sample []byte) bool {
+	if utf8.Valid(sample) {
+		return true
+	}
+	for i := 1; i < utf8.UTFMax && i < len(sample); i++ {
+		if utf8.Valid(sample[:len(sample)-i]) {
+			return !utf8.FullRune(sample[len(sample)-i:])
+		}
+	}
+	return false
+}
+
+// russianFrequency относительная частота строчных букв русского языка (‰)
+var russianFrequency = map[rune]int{
+	'о': 110, 'е': 85, 'а': 80, 'и': 74, 'н': 67, 'т': 63, 'с': 55, 'р': 47,
+	'в': 45, 'л': 44, 'к': 35, 'м': 32, 'д': 30, 'п': 28, 'у': 26, 'я': 20,
+	'ы': 19, 'ь': 17, 'г': 17, 'з': 16, 'б': 16, 'ч': 14, 'й': 12, 'х': 10,
+	'ж': 9, 'ш': 7, 'ю': 6, 'ц': 5, 'щ': 4, 'э': 3, 'ф': 2, 'ъ': 1, 'ё': 1,
+}
+
+// latinScore оценка буквы латиницы с диакритикой
+const latinScore = 20
+
+// scoreText оценивает правдоподобие текста, декодированного в кодировке cm.
+// Учитываются только символы из байтов >= 0x80
+func scoreText(cm *charmap.Charmap, sample []byte) int {
+	score := 0
+	prev := unicode.ReplacementChar
+	for i, b := range sample {
+		r := cm.DecodeByte(b)
+		if b < 0x80 {
+			prev = r
+			continue
+		}
+
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			if unicode.IsLower(r) {
+				score += russianFrequency[r]
+			} else {
+				// Заглавные буквы встречаются реже, но целые слова заглавными возможны
+				score += russianFrequency[unicode.ToLower(r)] / 4
+			}
+		case unicode.IsLetter(r):
+			score += latinScore
+		case unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r) && r < 0x2500:
+			// Типографские знаки (кавычки, тире, №) нейтральны
+		default:
+			// Псевдографика и управляющие символы в тексте маловероятны
+			score -= 50
+		}
+
+		// Смешение алфавитов внутри слова выдает неверную кодировку
+		var next rune = ' '
+		if i+1 < len(sample) {
+			next = cm.DecodeByte(sample[i+1])
+		}
+		if mixedScript(prev, r) || mixedScript(r, next) {
+			score -= 60
+		}
+		prev = r
+	}
+	return score
+}
+
+// mixedScript проверяет, что соседние буквы из разных алфавитов
+func mixedScript(a, b rune) bool {
+	if !unicode.IsLetter(a) || !unicode.IsLetter(b) {
+		return false
+	}
+	return unicode.Is(unicode.Cyrillic, a) != unicode.Is(unicode.Cyrillic, b)
+}
@@ -0,0 +1,89 @@
+package charset
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const russianText = "Съешь же ещё этих мягких французских булок, да выпей чаю. Широкая электрификация южных губерний."
+
+func encode(t *testing.T, cm *charmap.Charmap, s string) []byte {
+	t.Helper()
+	data, err := cm.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDetect(t *testing.T) {
+	utf8Text := []byte(russianText)
+
+	tests := []struct {
+		name   string
+		sample []byte
+		want   string
+	}{
+		{"empty", nil, UTF8},
+		{"ascii", []byte("plain ascii text"), UTF8},
+		{"utf-8", utf8Text, UTF8},
+		{"utf-8 with cut rune", utf8Text[:len("Съ")+1], UTF8},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "text"...), UTF8},
+		{"utf-16le bom", []byte{0xFF, 0xFE, 't', 0}, UTF16LE},
+		{"utf-16be bom", []byte{0xFE, 0xFF, 0, 't'}, UTF16BE},
+		{"windows-1251", encode(t, charmap.Windows1251, russianText), Windows1251},
+		{"koi8-r", encode(t, charmap.KOI8R, russianText), KOI8R},
+		{"ibm866", encode(t, charmap.CodePage866, russianText), IBM866},
+		{"windows-1252", encode(t, charmap.Windows1252, "Crème brûlée à la française, garçon"), Windows1252},
+		{"invalid utf-8 in the middle", []byte("abc\xff\xfedef"), Windows1252},
+		{"cut rune after ascii", []byte("a\xD0"), UTF8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.sample); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"UTF-8":        UTF8,
+		"utf8":         UTF8,
+		" CP1251 ":     Windows1251,
+		"windows-1251": Windows1251,
+		"KOI8R":        KOI8R,
+		"cp866":        IBM866,
+		"utf-16le":     UTF16LE,
+		"shift_jis":    "",
+		"":             "",
+	}
+	for name, want := range tests {
+		if got := Normalize(name); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	reader, err := NewReader(strings.NewReader(string(encode(t, charmap.KOI8R, russianText))), "koi8r")
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+	if string(data) != russianText {
+		t.Errorf("decoded = %q, want %q", data, russianText)
+	}
+
+	if _, err := NewReader(strings.NewReader(""), "ebcdic"); err != ErrUnknown {
+		t.Errorf("NewReader(ebcdic) error = %v, want ErrUnknown", err)
+	}
+}
@@ -3,44 +3,81 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"file-agent/internal/analytics"
 	"file-agent/internal/storage"
+	"fmt"
 	"net/http"
-	"sort"
+	"strconv"
 	"time"
 )
 
 // AnalyticsHandler содержит обработчики для аналитики
 type AnalyticsHandler struct {
-	storage *storage.S3Storage
+	storage    *storage.S3Storage
+	aggregates *analytics.Store
+	history    *analytics.History
 }
 
-// NewAnalyticsHandler создает новый AnalyticsHandler
-func NewAnalyticsHandler(s3Storage *storage.S3Storage) *AnalyticsHandler {
+// NewAnalyticsHandler создает новый AnalyticsHandler. Статистика по всем
+// файлам берется из aggregates, с фильтром по тегам - пересчитывается по
+// файлам из индекса тегов
+func NewAnalyticsHandler(s3Storage *storage.S3Storage, aggregates *analytics.Store) *AnalyticsHandler {
 	return &AnalyticsHandler{
-		storage: s3Storage,
+		storage:    s3Storage,
+		aggregates: aggregates,
 	}
 }
 
 // PeriodStats статистика за период
 type PeriodStats struct {
-	Period    string `json:"period"`
-	FileCount int64  `json:"file_count"`
-	TotalSize int64  `json:"total_size"`
+	Period      string `json:"period"`
+	FileCount   int64  `json:"file_count"`
+	TotalSize   int64  `json:"total_size"`
+	Downloads   int64  `json:"downloads"`
+	EgressBytes int64  `json:"egress_bytes"`
 }
 
 // UserStats статистика по пользователю
 type UserStats struct {
-	User      string `json:"user"`
-	FileCount int64  `json:"file_count"`
-	TotalSize int64  `json:"total_size"`
+	User        string `json:"user"`
+	FileCount   int64  `json:"file_count"`
+	TotalSize   int64  `json:"total_size"`
+	Downloads   int64  `json:"downloads"`
+	EgressBytes int64  `json:"egress_bytes"`
 }
 
+// UserPeriodStats файлы пользователя на конец интервала временного ряда
+type UserPeriodStats struct {
+	User      string    `json:"user"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	FileCount int64     `json:"file_count"`
+	TotalSize int64     `json:"total_size"`
+}
+
+// maxUserPeriods ограничение на количество строк user_period в ответе
+const maxUserPeriods = 100000
+
+// maxTagFilterFiles ограничение на количество файлов, статистика по которым
+// пересчитывается для фильтра по тегам
+const maxTagFilterFiles = 1000
+
 // AnalyticsResponse ответ с аналитикой
 type AnalyticsResponse struct {
-	TotalFiles int64         `json:"total_files"`
-	TotalSize  int64         `json:"total_size"`
-	Periods    []PeriodStats `json:"periods"`
-	TopUsers   []UserStats   `json:"top_users"`
+	TotalFiles         int64                           `json:"total_files"`
+	TotalSize          int64                           `json:"total_size"`
+	TotalSizeHuman     string                          `json:"total_size_human"`
+	AverageFileSize    int64                           `json:"average_file_size"`
+	FilesByExtension   map[string]*analytics.Breakdown `json:"files_by_extension"`
+	FilesByContentType map[string]*analytics.Breakdown `json:"files_by_content_type"`
+	SizeHistogram      []analytics.SizeBucket          `json:"size_histogram"`
+	Periods            []PeriodStats                   `json:"periods"`
+	Timeseries         *analytics.Series               `json:"timeseries"`
+	TopUsers           []UserStats                     `json:"top_users"`
+	MostDownloaded     []analytics.FileDownloads       `json:"most_downloaded"`
+	TopDownloaders     []analytics.DownloaderStats     `json:"top_downloaders"`
+	UserPeriods        []UserPeriodStats               `json:"user_periods,omitempty"` // С ?per_user=true
 }
 
 // GetAnalytics обрабатывает запрос аналитики
@@ -49,9 +86,32 @@ func (ah *AnalyticsHandler) GetAnalytics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Получаем все метаданные
+	format, err := responseFormat(r)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := parseSeries(r)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var perUser bool
+	if value := r.URL.Query().Get("per_user"); value != "" {
+		if perUser, err = strconv.ParseBool(value); err != nil {
+			writeErrorResponse(w, "Invalid per_user value", http.StatusBadRequest)
+			return
+		}
+	}
+
 	ctx := context.Background()
-	allMetadata, err := ah.storage.ListAllMetadata(ctx)
+	summary, err := ah.summary(ctx, queryTags(r))
+	if errors.Is(err, storage.ErrTooManyFiles) {
+		writeErrorResponse(w, fmt.Sprintf("Tag filter is too broad: %v", err), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		writeErrorResponse(w, "Failed to load metadata", http.StatusInternalServerError)
 		return
@@ -59,91 +119,193 @@ func (ah *AnalyticsHandler) GetAnalytics(w http.ResponseWriter, r *http.Request)
 
 	now := time.Now().UTC()
 
-	// Инициализируем статистику
 	response := AnalyticsResponse{
-		TotalFiles: int64(len(allMetadata)),
-		Periods:    make([]PeriodStats, 0, 3),
-		TopUsers:   make([]UserStats, 0),
+		TotalFiles:         summary.TotalFiles,
+		TotalSize:          summary.TotalSize,
+		TotalSizeHuman:     analytics.FormatSize(summary.TotalSize),
+		AverageFileSize:    summary.AverageSize(),
+		FilesByExtension:   summary.Extensions,
+		FilesByContentType: summary.Types,
+		SizeHistogram:      summary.Histogram,
+		Periods:            make([]PeriodStats, 0, 3),
+		TopUsers:           make([]UserStats, 0),
 	}
 
-	// Подсчитываем общий размер
-	var totalSize int64
-	for _, meta := range allMetadata {
-		totalSize += meta.Size
+	// Анализируем по периодам (в фиксированном порядке, с точностью до часа)
+	periods := []struct {
+		name  string
+		since time.Time
+	}{
+		{"last_day", now.AddDate(0, 0, -1)},
+		{"last_week", now.AddDate(0, 0, -7)},
+		{"last_month", now.AddDate(0, -1, 0)},
 	}
-	response.TotalSize = totalSize
 
-	// Анализируем по периодам
-	dayAgo := now.AddDate(0, 0, -1)
-	weekAgo := now.AddDate(0, 0, -7)
-	monthAgo := now.AddDate(0, -1, 0)
+	for _, period := range periods {
+		stats := summary.Since(period.since)
+		egress := summary.EgressSince(period.since)
+		response.Periods = append(response.Periods, PeriodStats{
+			Period:      period.name,
+			FileCount:   stats.FileCount,
+			TotalSize:   stats.TotalSize,
+			Downloads:   egress.FileCount,
+			EgressBytes: egress.TotalSize,
+		})
+	}
+
+	// Временной ряд загрузок по интервалам
+	summary.FillSeries(series)
+	response.Timeseries = series
 
-	periods := map[string]time.Time{
-		"last_day":   dayAgo,
-		"last_week":  weekAgo,
-		"last_month": monthAgo,
+	// Анализируем по пользователям и сортируем по размеру
+	userStats := sortedUsers(summary, userSortSize)
+
+	// Берем топ-10
+	if len(userStats) > 10 {
+		userStats = userStats[:10]
 	}
 
-	for periodName, since := range periods {
-		var count int64
-		var size int64
+	response.TopUsers = userStats
 
-		for _, meta := range allMetadata {
-			if meta.UploadedAt.After(since) {
-				count++
-				size += meta.Size
-			}
+	// Самые скачиваемые файлы
+	response.MostDownloaded = summary.MostDownloaded(10)
+
+	// Пользователи с наибольшим исходящим трафиком
+	response.TopDownloaders = summary.TopDownloaders(10)
+
+	// Файлы каждого пользователя на конец каждого интервала ряда
+	if perUser {
+		if len(summary.Users)*len(series.Buckets) > maxUserPeriods {
+			writeErrorResponse(w, fmt.Sprintf("per_user report exceeds %d rows, use a coarser granularity or a shorter range", maxUserPeriods), http.StatusBadRequest)
+			return
 		}
+		response.UserPeriods = userPeriods(summary, series)
+	}
 
-		response.Periods = append(response.Periods, PeriodStats{
-			Period:    periodName,
-			FileCount: count,
-			TotalSize: size,
-		})
+	// Табличные форматы (CSV, NDJSON)
+	if format != formatJSON {
+		writeAnalyticsRecords(w, format, "analytics."+format, analyticsRecords(response))
+		return
 	}
 
-	// Анализируем по пользователям
-	userStatsMap := make(map[string]*UserStats)
+	// Возвращаем ответ
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
 
-	for _, meta := range allMetadata {
-		user := meta.UploadedBy
-		if user == "" {
-			user = "anonymous"
+// userPeriods возвращает файлы пользователей (по имени) на конец интервалов ряда
+func userPeriods(summary *analytics.Summary, series *analytics.Series) []UserPeriodStats {
+	periods := make([]UserPeriodStats, 0, len(summary.Users)*len(series.Buckets))
+	for _, user := range sortedKeys(summary.Users) {
+		stored := series.Empty()
+		summary.Users[user].FillStored(stored)
+		for _, bucket := range stored.Buckets {
+			periods = append(periods, UserPeriodStats{
+				User:      user,
+				Start:     bucket.Start,
+				End:       bucket.End,
+				FileCount: bucket.FileCount,
+				TotalSize: bucket.TotalSize,
+			})
 		}
+	}
+	return periods
+}
 
-		if stats, exists := userStatsMap[user]; exists {
-			stats.FileCount++
-			stats.TotalSize += meta.Size
-		} else {
-			userStatsMap[user] = &UserStats{
-				User:      user,
-				FileCount: 1,
-				TotalSize: meta.Size,
+// summary возвращает статистику по всем файлам или по файлам с тегами.
+// Файлы с тегами берутся из индекса тегов; если их больше maxTagFilterFiles,
+// возвращается storage.ErrTooManyFiles. Для файлов с тегами скачивания
+// берутся из агрегатов, а исходящий трафик за периоды и по скачавшим
+// пользователям учитывается по всем файлам
+func (ah *AnalyticsHandler) summary(ctx context.Context, tags []string) (*analytics.Summary, error) {
+	var aggregated *analytics.Summary
+	if ah.aggregates != nil {
+		aggregated = ah.aggregates.Summary()
+		if len(tags) == 0 {
+			return aggregated, nil
+		}
+	}
+
+	var files []*storage.FileMetadata
+	var err error
+	if len(tags) > 0 {
+		files, err = ah.storage.FindFilesByTags(ctx, tags, maxTagFilterFiles)
+	} else {
+		files, err = ah.storage.ListAllMetadata(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary := analytics.NewSummary()
+	for _, meta := range files {
+		summary.Add(meta)
+	}
+	if aggregated != nil {
+		for _, meta := range files {
+			if stats, ok := ah.downloads(meta.ID); ok {
+				summary.Downloads[meta.ID] = &stats
+				user := summary.Users[analytics.Uploader(meta)]
+				user.Downloads += stats.Count
+				user.EgressBytes += stats.BytesSent
 			}
 		}
 	}
+	if aggregated != nil {
+		summary.Egress = aggregated.Egress
+		summary.Downloaders = aggregated.Downloaders
+	}
+	return summary, nil
+}
+
+// downloads возвращает статистику скачиваний файла из агрегатов
+func (ah *AnalyticsHandler) downloads(fileID string) (analytics.DownloadStats, bool) {
+	if ah.aggregates == nil {
+		return analytics.DownloadStats{}, false
+	}
+	return ah.aggregates.Downloads(fileID)
+}
 
-	// Преобразуем в слайс и сортируем по размеру
-	var userStats []UserStats
-	for _, stats := range userStatsMap {
-		userStats = append(userStats, *stats)
+// parseSeries разбирает параметры временного ряда: from, to (RFC 3339 или
+// YYYY-MM-DD), granularity (hour, day, week, month) и timezone (имя IANA).
+// По умолчанию - последние 30 дней по дням в UTC
+func parseSeries(r *http.Request) (*analytics.Series, error) {
+	query := r.URL.Query()
+
+	location := time.UTC
+	if tz := query.Get("timezone"); tz != "" {
+		loaded, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", tz)
+		}
+		location = loaded
 	}
 
-	sort.Slice(userStats, func(i, j int) bool {
-		return userStats[i].TotalSize > userStats[j].TotalSize
-	})
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		parsed, err := analytics.ParseTime(value, location)
+		if err != nil {
+			return nil, err
+		}
+		to = parsed
+	}
 
-	// Берем топ-10
-	if len(userStats) > 10 {
-		userStats = userStats[:10]
+	from := to.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		parsed, err := analytics.ParseTime(value, location)
+		if err != nil {
+			return nil, err
+		}
+		from = parsed
 	}
 
-	response.TopUsers = userStats
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = analytics.GranularityDay
+	}
 
-	// Возвращаем ответ
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	return analytics.NewSeries(from, to, granularity, location)
 }
 
 // writeErrorResponse записывает ошибку в ответ
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"file-agent/internal/archive"
+	"file-agent/internal/bandwidth"
+	"file-agent/internal/storage"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ArchiveHandler содержит обработчики для просмотра содержимого архивов
+type ArchiveHandler struct {
+	storage  *storage.S3Storage
+	throttle *bandwidth.Throttle
+}
+
+// NewArchiveHandler создает новый ArchiveHandler
+func NewArchiveHandler(s3Storage *storage.S3Storage) *ArchiveHandler {
+	return &ArchiveHandler{
+		storage: s3Storage,
+	}
+}
+
+// SetThrottle включает ограничение скорости отдачи записей архивов
+func (h *ArchiveHandler) SetThrottle(throttle *bandwidth.Throttle) {
+	h.throttle = throttle
+}
+
+// ArchiveListing список записей архива
+type ArchiveListing struct {
+	ID      string          `json:"id"`
+	Format  string          `json:"format"`
+	Total   int             `json:"total"`
+	Entries []archive.Entry `json:"entries"`
+}
+
+// ListEntries возвращает список записей архива. Список кэшируется в
+// хранилище, так как содержимое файла не меняется
+func (h *ArchiveHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	fileID := mux.Vars(r)["id"]
+	metadata, format, ok := h.loadArchive(w, fileID)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var entries []archive.Entry
+	if err := h.storage.GetJSON(ctx, archiveCacheKey(fileID), &entries); err != nil {
+		reader := h.storage.OpenFileAt(ctx, fileID, metadata.Size)
+		entries, err = archive.List(reader, metadata.Size, format)
+		if err != nil {
+			h.writeArchiveError(w, fileID, err)
+			return
+		}
+		if err := h.storage.PutJSON(ctx, archiveCacheKey(fileID), entries); err != nil {
+			log.Printf("Failed to cache archive listing for %s: %v", fileID, err)
+		}
+	}
+
+	// Фильтр по префиксу пути внутри архива
+	if prefix := strings.TrimPrefix(r.URL.Query().Get("prefix"), "/"); prefix != "" {
+		filtered := []archive.Entry{}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name, prefix) {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ArchiveListing{
+		ID:      fileID,
+		Format:  format,
+		Total:   len(entries),
+		Entries: entries,
+	})
+}
+
+// GetEntry отдает содержимое одной записи архива
+func (h *ArchiveHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+	metadata, format, ok := h.loadArchive(w, fileID)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	reader := h.storage.OpenFileAt(ctx, fileID, metadata.Size)
+	content, entry, err := archive.Open(reader, metadata.Size, format, vars["path"])
+	if err != nil {
+		h.writeArchiveError(w, fileID, err)
+		return
+	}
+	defer content.Close()
+
+	name := path.Base(entry.Name)
+	w.Header().Set("Content-Type", storage.GetContentType(name))
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name))
+	w.WriteHeader(http.StatusOK)
+
+	// Записи отдаются с теми же лимитами скорости, что и сам архив
+	out := delivery{throttle: h.throttle}.writer(w, r, fileID)
+	if _, err := io.Copy(out, content); err != nil {
+		log.Printf("Error sending archive entry %s of %s: %v", entry.Name, fileID, err)
+	}
+}
+
+// loadArchive загружает метаданные и проверяет, что файл - доступный архив
+func (h *ArchiveHandler) loadArchive(w http.ResponseWriter, fileID string) (*storage.FileMetadata, string, bool) {
+	metadata, err := h.storage.GetFileMetadata(context.Background(), fileID)
+	if err != nil {
+		writeErrorResponse(w, "File not found", http.StatusNotFound)
+		return nil, "", false
+	}
+
+	if message, status := unavailable(metadata); status != 0 {
+		writeErrorResponse(w, message, status)
+		return nil, "", false
+	}
+
+	format := archive.Format(metadata.ContentType)
+	if format == "" {
+		writeErrorResponse(w, fmt.Sprintf("File is not a supported archive (%s)", metadata.ContentType), http.StatusUnsupportedMediaType)
+		return nil, "", false
+	}
+
+	return metadata, format, true
+}
+
+// writeArchiveError отправляет ошибку чтения архива
+func (h *ArchiveHandler) writeArchiveError(w http.ResponseWriter, fileID string, err error) {
+	switch {
+	case errors.Is(err, archive.ErrEntryNotFound):
+		writeErrorResponse(w, "Archive entry not found", http.StatusNotFound)
+	case errors.Is(err, archive.ErrUnsupported):
+		writeErrorResponse(w, "File is not a supported archive", http.StatusUnsupportedMediaType)
+	default:
+		log.Printf("Failed to read archive %s: %v", fileID, err)
+		writeErrorResponse(w, "Failed to read archive", http.StatusInternalServerError)
+	}
+}
+
+// archiveCacheKey возвращает ключ кэша списка записей архива
+func archiveCacheKey(fileID string) string {
+	return fmt.Sprintf("cache/archives/%s/entries.json", fileID)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"file-agent/internal/analytics"
+	"file-agent/internal/bandwidth"
+	"file-agent/internal/metrics"
+	"file-agent/internal/middleware"
+	"file-agent/internal/storage"
+	"io"
+	"net/http"
+	"time"
+)
+
+// delivery отправляет содержимое файла клиенту: с ограничением скорости
+// и учетом скачивания. Общий путь для файлов, миниатюр и преобразованных изображений
+type delivery struct {
+	throttle   *bandwidth.Throttle
+	aggregates *analytics.Store
+}
+
+// writeTimeout время на отправку одной части скачиваемого ответа. Общий
+// WriteTimeout сервера оборвал бы долгие скачивания, в том числе ограниченные
+// по скорости, поэтому срок записи продлевается перед каждой частью: отдача
+// длится столько, сколько позволяют лимиты, пока клиент принимает данные
+const writeTimeout = 15 * time.Second
+
+// writer возвращает w с ограничением скорости отдачи файла fileID и
+// продлением срока записи
+func (d delivery) writer(w http.ResponseWriter, r *http.Request, fileID string) io.Writer {
+	// Ограничение скорости: общее, по адресу клиента, пользователю и файлу.
+	// Адрес и пользователь берутся только из источников, которым можно доверять
+	return d.throttle.Writer(r.Context(), &deadlineWriter{w: w, controller: http.NewResponseController(w)}, bandwidth.Transfer{
+		ClientIP: middleware.ClientIP(r),
+		User:     middleware.AuthenticatedUser(r.Context()),
+		FileID:   fileID,
+	})
+}
+
+// send копирует content в ответ после уже записанных заголовков и учитывает
+// скачивание файла metadata. size - ожидаемый объем ответа или -1, если он
+// неизвестен (например, при перекодировании); недоотправленный ответ считается
+// прерванным скачиванием
+func (d delivery) send(w http.ResponseWriter, r *http.Request, metadata *storage.FileMetadata, content io.Reader, size int64) (int64, error) {
+	ip := middleware.ClientIP(r)
+	user := middleware.AuthenticatedUser(r.Context())
+	out := d.writer(w, r, metadata.ID)
+
+	w.WriteHeader(http.StatusOK)
+	finished := metrics.TrackTransfer(metrics.DirectionDownload)
+	sent, err := io.Copy(out, content)
+	finished()
+	metrics.TransferBytes.Add(float64(sent), metrics.DirectionDownload)
+
+	if d.aggregates != nil {
+		d.aggregates.RecordDownload(analytics.DownloadEvent{
+			FileID:     metadata.ID,
+			Filename:   metadata.Filename,
+			UploadedBy: analytics.Uploader(metadata),
+			Time:       time.Now().UTC(),
+			Bytes:      sent,
+			Completed:  err == nil && (size < 0 || sent == size),
+			Downloader: user,
+			ClientIP:   ip,
+			UserAgent:  truncate(r.UserAgent(), maxHeaderLength),
+			Referer:    truncate(r.Referer(), maxHeaderLength),
+		})
+	}
+
+	return sent, err
+}
+
+// deadlineWriter отправляет ответ частями по bandwidth.ChunkSize, продлевая
+// срок записи перед каждой. При ограничении скорости части передаются после
+// ожидания лимитов, поэтому срок растет вместе с разрешенным временем отдачи
+type deadlineWriter struct {
+	w          io.Writer
+	controller *http.ResponseController
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), bandwidth.ChunkSize)]
+		// Если соединение не поддерживает сроки (http.ErrNotSupported),
+		// ответ отправляется без них
+		d.controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+		n, err := d.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
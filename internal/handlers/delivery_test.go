@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"file-agent/internal/bandwidth"
+	"file-agent/internal/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeliveryOutlivesWriteTimeout(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 8*bandwidth.ChunkSize)
+	d := delivery{throttle: bandwidth.NewThrottle(bandwidth.Limits{Global: 8 * bandwidth.ChunkSize})}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := d.send(w, r, &storage.FileMetadata{ID: "1"}, bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Errorf("send() = %v", err)
+		}
+	}))
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// Опустошаем лимит, чтобы отдача заняла около секунды
+	d.throttle.Writer(context.Background(), io.Discard, bandwidth.Transfer{}).Write(content)
+
+	start := time.Now()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("download was cut off after %v: %v", time.Since(start), err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Errorf("received %d bytes, want %d", len(body), len(content))
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("download took %v, throttle was not applied", elapsed)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// inlineContentTypes типы, которые безопасно показывать в браузере (?disposition=inline).
+// SVG и HTML сюда не входят, так как могут содержать скрипты
+var inlineContentTypes = map[string]bool{
+	"image/jpeg":       true,
+	"image/png":        true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"image/bmp":        true,
+	"image/avif":       true,
+	"application/pdf":  true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"text/markdown":    true,
+	"application/json": true,
+}
+
+// cyrillicTranslit таблица транслитерации для ASCII-варианта имени файла
+var cyrillicTranslit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// canInline проверяет, можно ли отдать файл с disposition inline
+func canInline(contentType string) bool {
+	return inlineContentTypes[contentType]
+}
+
+// contentDisposition формирует заголовок Content-Disposition по RFC 6266:
+// ASCII-вариант имени в filename и точное имя в filename* (RFC 5987)
+func contentDisposition(dispositionType, filename string) string {
+	fallback := asciiFilename(filename)
+	if fallback == filename {
+		return fmt.Sprintf("%s; filename=\"%s\"", dispositionType, fallback)
+	}
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", dispositionType, fallback, encodeRFC5987(filename))
+}
+
+// asciiFilename возвращает ASCII-вариант имени, безопасный для quoted-string
+func asciiFilename(filename string) string {
+	var b strings.Builder
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\' || r < 0x20 || r == 0x7f:
+			b.WriteByte('_')
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		default:
+			lower := []rune(strings.ToLower(string(r)))[0]
+			translit, ok := cyrillicTranslit[lower]
+			if !ok {
+				b.WriteByte('_')
+				continue
+			}
+			if lower != r && translit != "" {
+				translit = strings.ToUpper(translit[:1]) + translit[1:]
+			}
+			b.WriteString(translit)
+		}
+	}
+	return b.String()
+}
+
+// encodeRFC5987 кодирует значение для ext-value (RFC 5987, attr-char)
+func encodeRFC5987(value string) string {
+	const attrChars = "!#$&+-.^_`|~"
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import "testing"
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string
+		filename    string
+		want        string
+	}{
+		{"ascii", "attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", "inline", "photo.jpg", `inline; filename="photo.jpg"`},
+		{"quotes escaped", "attachment", `a"b\c.txt`, `attachment; filename="a_b_c.txt"; filename*=UTF-8''a%22b%5Cc.txt`},
+		{"cyrillic transliterated", "attachment", "Отчет.pdf", `attachment; filename="Otchet.pdf"; filename*=UTF-8''%D0%9E%D1%82%D1%87%D0%B5%D1%82.pdf`},
+		{"unknown script replaced", "attachment", "文件.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E6%96%87%E4%BB%B6.txt`},
+		{"spaces kept", "attachment", "my file.txt", `attachment; filename="my file.txt"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentDisposition(tt.disposition, tt.filename); got != tt.want {
+				t.Errorf("contentDisposition() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanInline(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"image/png", true},
+		{"application/pdf", true},
+		{"image/svg+xml", false},
+		{"text/html", false},
+		{"application/octet-stream", false},
+	}
+
+	for _, tt := range tests {
+		if got := canInline(tt.contentType); got != tt.want {
+			t.Errorf("canInline(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"file-agent/internal/storage"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы ответа (?format= или заголовок Accept)
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// Типы содержимого табличных форматов
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// exportFlushEvery количество записей, после которого выгрузка отправляется клиенту
+const exportFlushEvery = 100
+
+// responseFormat определяет формат ответа: параметр ?format= (json, csv,
+// ndjson) важнее заголовка Accept. По умолчанию - JSON
+func responseFormat(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		switch format {
+		case formatJSON, formatCSV, formatNDJSON:
+			return format, nil
+		}
+		return "", fmt.Errorf("format must be json, csv or ndjson")
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case csvContentType:
+			return formatCSV, nil
+		case ndjsonContentType, "application/ndjson", "application/jsonl":
+			return formatNDJSON, nil
+		case "application/json":
+			return formatJSON, nil
+		}
+	}
+
+	return formatJSON, nil
+}
+
+// writeCSV записывает таблицу в формате CSV как вложение с именем filename
+func writeCSV(w http.ResponseWriter, filename string, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, row := range rows {
+		writer.Write(row)
+	}
+	writer.Flush()
+}
+
+// writeNDJSON записывает каждую запись отдельной строкой JSON
+func writeNDJSON[T any](w http.ResponseWriter, records []T) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		encoder.Encode(record)
+	}
+}
+
+// csvText защищает текстовое значение ячейки от интерпретации как формулы
+// в табличных редакторах
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvInt форматирует целое значение ячейки
+func csvInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+// csvTime форматирует время ячейки в RFC 3339
+func csvTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.Format(time.RFC3339)
+}
+
+// fileCSVHeader столбцы CSV со списком файлов
+var fileCSVHeader = []string{
+	"id", "filename", "path", "size", "content_type", "uploaded_at", "uploaded_by",
+	"tags", "status", "scan_status", "revision",
+}
+
+// fileCSVRow строка CSV для файла
+func fileCSVRow(m *storage.FileMetadata) []string {
+	return []string{
+		m.ID,
+		csvText(m.Filename),
+		csvText(m.Path),
+		csvInt(m.Size),
+		m.ContentType,
+		csvTime(m.UploadedAt),
+		csvText(m.UploadedBy),
+		csvText(strings.Join(m.Tags, ",")),
+		m.Status,
+		m.ScanStatus,
+		csvInt(m.Revision),
+	}
+}
+
+// ExportMetadata обрабатывает выгрузку метаданных всех файлов в формате
+// NDJSON. Записи передаются клиенту по мере чтения из хранилища
+func (fh *FileHandler) ExportMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	tags := queryTags(r)
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", "metadata.ndjson"))
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	exported := 0
+
+	// Обход прекращается, если клиент отключился
+	err := fh.storage.WalkMetadata(r.Context(), func(metadata *storage.FileMetadata) error {
+		if !metadata.HasTags(tags) {
+			return nil
+		}
+		if err := encoder.Encode(metadata); err != nil {
+			return err
+		}
+
+		exported++
+		if flusher != nil && exported%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Заголовки уже отправлены, клиент увидит оборванную выгрузку
+		log.Printf("Metadata export interrupted after %d records: %v", exported, err)
+	}
+}
+
+// AnalyticsRecord строка аналитики в табличном виде. Section определяет
+// группу показателей, Key - элемент группы
+type AnalyticsRecord struct {
+	Section     string `json:"section"`
+	Key         string `json:"key"`
+	FileCount   int64  `json:"file_count"`
+	TotalSize   int64  `json:"total_size"`
+	Downloads   int64  `json:"downloads"`
+	EgressBytes int64  `json:"egress_bytes"`
+}
+
+// analyticsCSVHeader столбцы CSV с аналитикой
+var analyticsCSVHeader = []string{"section", "key", "file_count", "total_size", "downloads", "egress_bytes"}
+
+// analyticsRecords разворачивает ответ аналитики в строки: total, extension,
+// content_type, size, period, timeseries, user, download (самые скачиваемые
+// файлы) и downloader (исходящий трафик скачавших пользователей)
+func analyticsRecords(response AnalyticsResponse) []AnalyticsRecord {
+	records := []AnalyticsRecord{{
+		Section:   "total",
+		FileCount: response.TotalFiles,
+		TotalSize: response.TotalSize,
+	}}
+
+	for _, ext := range sortedKeys(response.FilesByExtension) {
+		b := response.FilesByExtension[ext]
+		records = append(records, AnalyticsRecord{Section: "extension", Key: ext, FileCount: b.FileCount, TotalSize: b.TotalSize})
+	}
+	for _, ct := range sortedKeys(response.FilesByContentType) {
+		b := response.FilesByContentType[ct]
+		records = append(records, AnalyticsRecord{Section: "content_type", Key: ct, FileCount: b.FileCount, TotalSize: b.TotalSize})
+	}
+	for _, bucket := range response.SizeHistogram {
+		records = append(records, AnalyticsRecord{Section: "size", Key: bucket.Label, FileCount: bucket.FileCount, TotalSize: bucket.TotalSize})
+	}
+	for _, period := range response.Periods {
+		records = append(records, AnalyticsRecord{
+			Section:     "period",
+			Key:         period.Period,
+			FileCount:   period.FileCount,
+			TotalSize:   period.TotalSize,
+			Downloads:   period.Downloads,
+			EgressBytes: period.EgressBytes,
+		})
+	}
+	if response.Timeseries != nil {
+		for _, bucket := range response.Timeseries.Buckets {
+			records = append(records, AnalyticsRecord{
+				Section:   "timeseries",
+				Key:       bucket.Start.Format(time.RFC3339),
+				FileCount: bucket.FileCount,
+				TotalSize: bucket.TotalSize,
+			})
+		}
+	}
+	for _, user := range response.TopUsers {
+		records = append(records, userRecord(user))
+	}
+	for _, file := range response.MostDownloaded {
+		records = append(records, AnalyticsRecord{
+			Section:     "download",
+			Key:         file.FileID,
+			Downloads:   file.Count,
+			EgressBytes: file.BytesSent,
+		})
+	}
+	for _, downloader := range response.TopDownloaders {
+		records = append(records, AnalyticsRecord{
+			Section:     "downloader",
+			Key:         downloader.Downloader,
+			Downloads:   downloader.Count,
+			EgressBytes: downloader.BytesSent,
+		})
+	}
+	for _, period := range response.UserPeriods {
+		records = append(records, AnalyticsRecord{
+			Section:   "user_period",
+			Key:       period.User + "|" + period.Start.Format(time.RFC3339),
+			FileCount: period.FileCount,
+			TotalSize: period.TotalSize,
+		})
+	}
+
+	return records
+}
+
+// userRecord строка аналитики для пользователя
+func userRecord(user UserStats) AnalyticsRecord {
+	return AnalyticsRecord{
+		Section:     "user",
+		Key:         user.User,
+		FileCount:   user.FileCount,
+		TotalSize:   user.TotalSize,
+		Downloads:   user.Downloads,
+		EgressBytes: user.EgressBytes,
+	}
+}
+
+// writeAnalyticsRecords записывает строки аналитики в формате CSV или NDJSON
+func writeAnalyticsRecords(w http.ResponseWriter, format, filename string, records []AnalyticsRecord) {
+	if format == formatNDJSON {
+		writeNDJSON(w, records)
+		return
+	}
+
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, []string{
+			record.Section,
+			csvText(record.Key),
+			csvInt(record.FileCount),
+			csvInt(record.TotalSize),
+			csvInt(record.Downloads),
+			csvInt(record.EgressBytes),
+		})
+	}
+	writeCSV(w, filename, analyticsCSVHeader, rows)
+}
+
+// sortedKeys возвращает ключи в алфавитном порядке
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,12 +1,31 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"file-agent/internal/analytics"
+	"file-agent/internal/attributes"
+	"file-agent/internal/bandwidth"
+	"file-agent/internal/charset"
+	"file-agent/internal/imaging"
+	"file-agent/internal/metrics"
+	"file-agent/internal/middleware"
+	"file-agent/internal/policy"
+	"file-agent/internal/processing"
+	"file-agent/internal/quota"
+	"file-agent/internal/scanner"
 	"file-agent/internal/storage"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -14,8 +33,16 @@ import (
 
 // FileHandler содержит обработчики для работы с файлами
 type FileHandler struct {
-	storage     *storage.S3Storage
-	maxFileSize int64
+	storage      *storage.S3Storage
+	maxFileSize  int64
+	uploadPolicy *policy.Policy
+	scanner      *scanner.Client
+	scanMode     string
+	queue        *processing.Queue
+	stripImages  bool
+	aggregates   *analytics.Store
+	quotas       *quota.Quotas
+	throttle     *bandwidth.Throttle
 }
 
 // NewFileHandler создает новый FileHandler
@@ -26,11 +53,66 @@ func NewFileHandler(s3Storage *storage.S3Storage, maxFileSize int64) *FileHandle
 	}
 }
 
+// SetUploadPolicy задает политику, по которой проверяются загружаемые файлы
+func (fh *FileHandler) SetUploadPolicy(p *policy.Policy) {
+	fh.uploadPolicy = p
+}
+
+// SetScanner включает антивирусную проверку загрузок. В режиме reject
+// зараженные файлы отклоняются, в режиме quarantine сохраняются, но не отдаются
+func (fh *FileHandler) SetScanner(client *scanner.Client, mode string) {
+	fh.scanner = client
+	fh.scanMode = mode
+}
+
+// SetQueue включает асинхронную обработку файлов после загрузки
+func (fh *FileHandler) SetQueue(queue *processing.Queue) {
+	fh.queue = queue
+}
+
+// SetStripMetadata включает удаление EXIF/XMP из изображений по умолчанию.
+// Поле формы strip_metadata переопределяет настройку для отдельной загрузки
+func (fh *FileHandler) SetStripMetadata(enabled bool) {
+	fh.stripImages = enabled
+}
+
+// SetAnalytics включает обновление статистики при загрузке, изменении и удалении файлов
+func (fh *FileHandler) SetAnalytics(store *analytics.Store) {
+	fh.aggregates = store
+}
+
+// SetQuotas включает проверку квот авторов загрузок
+func (fh *FileHandler) SetQuotas(quotas *quota.Quotas) {
+	fh.quotas = quotas
+}
+
+// SetThrottle включает ограничение скорости отдачи файлов
+func (fh *FileHandler) SetThrottle(throttle *bandwidth.Throttle) {
+	fh.throttle = throttle
+}
+
+// delivery возвращает путь отдачи содержимого с ограничением скорости и учетом скачиваний
+func (fh *FileHandler) delivery() delivery {
+	return delivery{throttle: fh.throttle, aggregates: fh.aggregates}
+}
+
+// maxStripSize максимальный размер изображения, из которого удаляются метаданные
+const maxStripSize = 64 << 20
+
+// maxFormOverhead допустимый объем полей формы и заголовков multipart сверх
+// файла. Content-Length за вычетом этого объема считается нижней оценкой
+// размера файла при проверке квоты до чтения тела запроса
+const maxFormOverhead = 1 << 20
+
 // UploadResponse структура ответа при загрузке файла
 type UploadResponse struct {
-	ID       string `json:"id"`
-	Filename string `json:"filename"`
-	URL      string `json:"url"`
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	ScanStatus  string `json:"scan_status,omitempty"`
+	Status      string `json:"status"`
+	URL         string `json:"url"`
 }
 
 // ErrorResponse структура для ошибок
@@ -38,11 +120,49 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// PolicyViolationResponse ответ при отказе политики загрузки
+type PolicyViolationResponse struct {
+	Error     string `json:"error"`
+	Reason    string `json:"reason"`
+	Rule      string `json:"rule,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// QuotaExceededResponse ответ при превышении квоты
+type QuotaExceededResponse struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+	Limit  int64  `json:"limit"`
+	Used   int64  `json:"used"`
+}
+
 // UploadFile обрабатывает загрузку файлов
 func (fh *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		return
 	}
+	defer metrics.TrackTransfer(metrics.DirectionUpload)()
+
+	// Квоты считаются по пользователю, загрузившему файл: поле uploaded_by
+	// задает сам клиент и его можно изменить через PATCH
+	owner := requestActor(r)
+
+	// Общую квоту anonymous один клиент мог бы исчерпать для всех, поэтому
+	// при включенных квотах загружать файлы может только аутентифицированный
+	// пользователь
+	if fh.quotas != nil && middleware.AuthenticatedUser(r.Context()) == "" {
+		fh.writeError(w, "X-Authenticated-User header is required to upload files when quotas are enabled", http.StatusUnauthorized)
+		return
+	}
+
+	// Отказ по квоте до чтения тела запроса, чтобы не принимать файл целиком
+	if fh.quotas != nil && r.ContentLength > 0 {
+		quotaDecision := fh.quotas.Check(owner, max(r.ContentLength-maxFormOverhead, 0), time.Now())
+		if !quotaDecision.Allowed {
+			fh.writeQuotaExceeded(w, quotaDecision)
+			return
+		}
+	}
 
 	// Ограничиваем размер загружаемого файла
 	r.ParseMultipartForm(fh.maxFileSize)
@@ -60,25 +180,213 @@ func (fh *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем информацию о том, кто загружает файл (опционально)
+	// Приводим имя файла к безопасному виду
+	filename := storage.SanitizeFilename(header.Filename)
+
+	// Получаем информацию о том, кто загружает файл (опционально).
+	// Аутентифицированный пользователь важнее поля формы
 	uploadedBy := r.FormValue("uploaded_by")
+	if user := middleware.AuthenticatedUser(r.Context()); user != "" {
+		uploadedBy = user
+	}
+
+	// Теги и пользовательские метаданные (поля tags и meta.*)
+	tags, meta, err := parseUploadTagsAndMeta(r)
+	if err != nil {
+		fh.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Определяем тип по первым байтам файла
+	head := make([]byte, storage.SniffLength)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		fh.writeError(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	contentType := storage.DetectContentType(head[:n], filename)
+
+	// Проверяем политику загрузки до сохранения файла. Правила по автору
+	// применяются только к аутентифицированному пользователю: поле uploaded_by
+	// задает сам клиент
+	decision := fh.uploadPolicy.Evaluate(policy.Upload{
+		Scope:       middleware.ScopeFromContext(r.Context()),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        header.Size,
+		Uploader:    owner,
+	})
+	if !decision.Allowed {
+		fh.writePolicyViolation(w, decision)
+		return
+	}
+
+	// Проверяем и резервируем квоту автора до сохранения файла
+	if fh.quotas != nil {
+		quotaDecision, release := fh.quotas.Reserve(owner, header.Size, time.Now())
+		if !quotaDecision.Allowed {
+			fh.writeQuotaExceeded(w, quotaDecision)
+			return
+		}
+		defer release()
+	}
+
+	// Антивирусная проверка до сохранения файла
+	var scanResult *scanner.Result
+	if fh.scanner != nil {
+		result, err := fh.scanner.Scan(r.Context(), io.NewSectionReader(file, 0, header.Size))
+		if errors.Is(err, scanner.ErrStreamTooLarge) {
+			log.Printf("Upload %s exceeds clamd StreamMaxLength: %v", filename, err)
+			fh.writeError(w, fmt.Sprintf("File size (%d bytes) exceeds the antivirus scan limit", header.Size), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to scan upload %s: %v", filename, err)
+			fh.writeError(w, "Antivirus scan is unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if result.Infected && fh.scanMode != scanner.ModeQuarantine {
+			log.Printf("Rejected infected upload %s: %s", filename, result.Signature)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(PolicyViolationResponse{
+				Error:     "File is infected",
+				Reason:    "infected",
+				Signature: result.Signature,
+			})
+			return
+		}
+		scanResult = &result
+	}
+
+	// Удаляем EXIF/XMP из изображений до сохранения
+	var content io.ReaderAt = file
+	size := header.Size
+	var stripped *imaging.StripResult
+	strip := fh.stripImages
+	if value := r.FormValue("strip_metadata"); value != "" {
+		strip, err = strconv.ParseBool(value)
+		if err != nil {
+			fh.writeError(w, "Invalid strip_metadata value", http.StatusBadRequest)
+			return
+		}
+	}
+	if strip && imaging.CanStrip(contentType) {
+		// Большое изображение нельзя сохранить с метаданными, которые просили удалить
+		if size > maxStripSize {
+			fh.writeError(w, fmt.Sprintf("Image is too large to strip metadata: maximum size is %d bytes", maxStripSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		data, err := io.ReadAll(io.NewSectionReader(file, 0, size))
+		if err != nil {
+			fh.writeError(w, "Failed to read file", http.StatusBadRequest)
+			return
+		}
+		stripped, err = imaging.StripMetadata(data)
+		if errors.Is(err, imaging.ErrMalformed) {
+			fh.writeError(w, "Image structure is damaged, metadata cannot be stripped", http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to strip metadata from %s: %v", filename, err)
+			fh.writeError(w, "Failed to strip image metadata", http.StatusUnprocessableEntity)
+			return
+		}
+		content = bytes.NewReader(stripped.Data)
+		size = int64(len(stripped.Data))
+	}
+
+	// Атрибуты файла по его типу (размеры, число страниц, длительность)
+	attrs := attributes.Extract(content, size, contentType)
+
+	// Кодировка текстовых файлов
+	var textCharset string
+	if storage.IsTextual(contentType) {
+		sample := make([]byte, min(size, charset.SampleSize))
+		n, _ := content.ReadAt(sample, 0)
+		textCharset = charset.Detect(sample[:n])
+	}
+
+	// Папка, в которую загружается файл (опционально, создается при необходимости)
+	ctx := context.Background()
+	folder, err := fh.storage.EnsureFolderPath(ctx, r.FormValue("path"))
+	if err != nil {
+		fh.writeError(w, fmt.Sprintf("Invalid folder path: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// Генерируем UUID для файла
 	fileID := uuid.New().String()
 
 	// Сохраняем файл в S3
-	ctx := context.Background()
-	err = fh.storage.SaveFile(ctx, fileID, header.Filename, file, header.Size, uploadedBy)
+	metadata := &storage.FileMetadata{
+		ID:         fileID,
+		Filename:   filename,
+		Size:       size,
+		UploadedBy: uploadedBy,
+		Owner:      owner,
+		FolderID:   folder.ID,
+		Path:       storage.JoinPath(folder.Path, filename),
+		Tags:       tags,
+		Meta:       meta,
+
+		ContentType:         contentType,
+		DeclaredContentType: header.Header.Get("Content-Type"),
+		Charset:             textCharset,
+		Attributes:          attrs,
+	}
+	if scanResult != nil {
+		scanner.ApplyResult(metadata, *scanResult)
+	}
+	if stripped != nil {
+		metadata.MetadataStripped = true
+		metadata.StrippedMetadata = stripped.Removed
+		metadata.OrientationFixed = stripped.Oriented
+	}
+
+	// Обработчики, которые будут выполнены после загрузки
+	var pending []string
+	if fh.queue != nil {
+		pending = fh.queue.Plan(metadata)
+	}
+
+	err = fh.storage.SaveFile(ctx, metadata, io.NewSectionReader(content, 0, size))
+	if errors.Is(err, storage.ErrFileExists) {
+		fh.writeError(w, fmt.Sprintf("File %s already exists", metadata.Path), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		fh.writeError(w, fmt.Sprintf("Failed to save file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Без задачи обработки файл навсегда остался бы в статусе pending,
+	// поэтому загрузка отменяется
+	if fh.queue != nil {
+		if err := fh.queue.Enqueue(ctx, fileID, pending); err != nil {
+			log.Printf("Failed to enqueue processing for file %s: %v", fileID, err)
+			if _, err := fh.storage.DeleteFile(ctx, fileID); err != nil {
+				log.Printf("Failed to delete file %s after enqueue failure: %v", fileID, err)
+			}
+			fh.writeError(w, "Failed to schedule file processing, try again later", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	metrics.TransferBytes.Add(float64(size), metrics.DirectionUpload)
+	if fh.aggregates != nil {
+		fh.aggregates.AddUpload(metadata)
+	}
+
 	// Возвращаем ответ
 	response := UploadResponse{
-		ID:       fileID,
-		Filename: header.Filename,
-		URL:      fmt.Sprintf("/%s", fileID),
+		ID:          fileID,
+		Filename:    filename,
+		Path:        metadata.Path,
+		ContentType: contentType,
+		ScanStatus:  metadata.ScanStatus,
+		Status:      metadata.Status,
+		URL:         fmt.Sprintf("/%s", fileID),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -100,29 +408,183 @@ func (fh *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fh.serveFile(w, r, fileID)
+}
+
+// DeleteFile обрабатывает удаление файла вместе с миниатюрами и кэшем.
+// Удаление доступно только на внутреннем порту аутентифицированному
+// пользователю. Журнал изменений метаданных сохраняется и дополняется
+// записью об удалении
+func (fh *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if middleware.ScopeFromContext(r.Context()) != middleware.ScopeInternal {
+		fh.writeError(w, "File deletion is only available on the internal port", http.StatusForbidden)
+		return
+	}
+	if middleware.AuthenticatedUser(r.Context()) == "" {
+		fh.writeError(w, "X-Authenticated-User header is required to delete files", http.StatusUnauthorized)
+		return
+	}
+
+	fileID := mux.Vars(r)["id"]
+
+	ctx := context.Background()
+	metadata, err := fh.storage.DeleteFile(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			fh.writeError(w, "File not found", http.StatusNotFound)
+		} else {
+			log.Printf("Failed to delete file %s: %v", fileID, err)
+			fh.writeError(w, "Failed to delete file", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("File %s deleted by %s", fileID, requestActor(r))
+
+	if fh.aggregates != nil {
+		fh.aggregates.Remove(metadata)
+	}
+
+	record := storage.AuditRecord{
+		FileID:    metadata.ID,
+		Revision:  metadata.Revision + 1,
+		ChangedBy: requestActor(r),
+		ChangedAt: time.Now().UTC(),
+		Changes: map[string]storage.FieldChange{
+			"deleted": {Old: false, New: true},
+		},
+	}
+	if err := fh.storage.SaveAuditRecord(ctx, record); err != nil {
+		log.Printf("Failed to save audit record for file %s: %v", metadata.ID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DownloadFileByPath обрабатывает скачивание файлов по пути в дереве папок
+func (fh *FileHandler) DownloadFileByPath(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	vars := mux.Vars(r)
+	filePath := vars["path"]
+
+	if filePath == "" {
+		fh.writeError(w, "File path is required", http.StatusBadRequest)
+		return
+	}
+
+	// Находим файл по пути
+	ctx := context.Background()
+	metadata, err := fh.storage.FindFileByPath(ctx, filePath)
+	if errors.Is(err, storage.ErrFileNotFound) || errors.Is(err, storage.ErrInvalidPath) {
+		fh.writeError(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to find file by path %s: %v", filePath, err)
+		fh.writeError(w, "Failed to find file", http.StatusInternalServerError)
+		return
+	}
+
+	fh.serveFile(w, r, metadata.ID)
+}
+
+// serveFile отправляет содержимое файла клиенту. Параметр ?disposition=inline
+// позволяет просматривать в браузере безопасные типы (изображения, PDF, текст)
+func (fh *FileHandler) serveFile(w http.ResponseWriter, r *http.Request, fileID string) {
 	// Получаем файл из S3
 	ctx := context.Background()
 	fileReader, metadata, err := fh.storage.GetFile(ctx, fileID)
-	if err != nil {
+	if errors.Is(err, storage.ErrFileNotFound) {
 		fh.writeError(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to get file %s: %v", fileID, err)
+		fh.writeError(w, "Failed to get file", http.StatusInternalServerError)
+		return
+	}
 	defer fileReader.Close()
 
-	// Определяем MIME-тип файла
-	contentType := storage.GetContentType(metadata.Filename)
+	if message, status := unavailable(metadata); status != 0 {
+		fh.writeError(w, message, status)
+		return
+	}
+
+	// Кодировка текста: сохраненная при загрузке или определенная по началу
+	// файла (для файлов, загруженных до появления определения кодировки)
+	var content io.Reader = fileReader
+	contentType := metadata.ContentType
+	textCharset := metadata.Charset
+	if textCharset == "" && storage.IsTextual(metadata.ContentType) {
+		buffered := bufio.NewReaderSize(fileReader, charset.SampleSize)
+		sample, _ := buffered.Peek(charset.SampleSize)
+		textCharset = charset.Detect(sample)
+		content = buffered
+	}
+
+	// Перекодирование на лету (?charset=utf-8)
+	transcoded := false
+	if target := r.URL.Query().Get("charset"); target != "" {
+		if charset.Normalize(target) != charset.UTF8 {
+			fh.writeError(w, "Only charset=utf-8 is supported", http.StatusBadRequest)
+			return
+		}
+		if textCharset == "" {
+			fh.writeError(w, "File is not a text file", http.StatusBadRequest)
+			return
+		}
+		content, err = charset.NewReader(content, textCharset)
+		if err != nil {
+			fh.writeError(w, fmt.Sprintf("Cannot convert from %s", textCharset), http.StatusBadRequest)
+			return
+		}
+		textCharset = charset.UTF8
+		transcoded = true
+	}
+	if textCharset != "" {
+		contentType += "; charset=" + textCharset
+	}
 
 	// Устанавливаем заголовки
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", metadata.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	dispositionType := "attachment"
+	if r.URL.Query().Get("disposition") == "inline" && canInline(metadata.ContentType) {
+		dispositionType = "inline"
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(dispositionType, metadata.Filename))
 
-	// Копируем содержимое файла в ответ
-	w.WriteHeader(http.StatusOK)
-	_, err = io.Copy(w, fileReader)
-	if err != nil {
+	// Перекодированный ответ отличается по размеру от файла
+	size := metadata.Size
+	if transcoded {
+		size = -1
+	}
+	if _, err := fh.delivery().send(w, r, metadata, content, size); err != nil {
 		// Логируем ошибку, но не можем уже изменить статус ответа
-		fmt.Printf("Error sending file: %v\n", err)
+		log.Printf("Failed to send file %s: %v", metadata.ID, err)
+	}
+}
+
+// unavailable проверяет, можно ли отдавать содержимое файла. Возвращает
+// сообщение и статус ошибки или нулевой статус, если файл доступен
+func unavailable(metadata *storage.FileMetadata) (string, int) {
+	// Файлы в карантине не отдаются
+	if metadata.Quarantined() {
+		return "File is quarantined", http.StatusForbidden
+	}
+
+	// Файлы, ожидающие антивирусной проверки, тоже не отдаются
+	if result, ok := metadata.Processing[scanner.ProcessorName]; ok && !result.Finished() {
+		return "File is being scanned, try again later", http.StatusConflict
 	}
+
+	return "", 0
 }
 
 // GetFileMetadata обрабатывает получение метаданных файла
@@ -142,15 +604,158 @@ func (fh *FileHandler) GetFileMetadata(w http.ResponseWriter, r *http.Request) {
 	// Получаем метаданные файла из S3
 	ctx := context.Background()
 	metadata, err := fh.storage.GetFileMetadata(ctx, fileID)
-	if err != nil {
+	if errors.Is(err, storage.ErrFileNotFound) {
 		fh.writeError(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to load metadata of file %s: %v", fileID, err)
+		fh.writeError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+
+	// Дополняем метаданные статистикой скачиваний
+	response := FileMetadataResponse{FileMetadata: metadata}
+	if fh.aggregates != nil {
+		if stats, ok := fh.aggregates.Downloads(metadata.ID); ok {
+			response.Downloads = stats.DownloadCounters
+			response.LastAccessed = stats.LastAccessed
+		}
+	}
 
 	// Возвращаем метаданные
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", metadata.ETag())
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(metadata)
+	json.NewEncoder(w).Encode(response)
+}
+
+// FileMetadataResponse метаданные файла со статистикой скачиваний
+type FileMetadataResponse struct {
+	*storage.FileMetadata
+	Downloads    analytics.DownloadCounters `json:"downloads"`
+	LastAccessed *time.Time                 `json:"last_accessed"`
+}
+
+// FileListResponse ответ со списком файлов
+type FileListResponse struct {
+	Files []*storage.FileMetadata `json:"files"`
+}
+
+// ListFiles обрабатывает получение списка файлов с фильтрацией по тегам (?tag=)
+func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	format, err := responseFormat(r)
+	if err != nil {
+		fh.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// С фильтром по тегам файлы берутся из индекса тегов
+	ctx := context.Background()
+	var files []*storage.FileMetadata
+	if tags := queryTags(r); len(tags) > 0 {
+		files, err = fh.storage.FindFilesByTags(ctx, tags, 0)
+	} else {
+		files, err = fh.storage.ListAllMetadata(ctx)
+	}
+	if err != nil {
+		fh.writeError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+
+	if files == nil {
+		files = make([]*storage.FileMetadata, 0)
+	}
+
+	// Сначала самые свежие файлы
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].UploadedAt.After(files[j].UploadedAt)
+	})
+
+	switch format {
+	case formatCSV:
+		rows := make([][]string, 0, len(files))
+		for _, file := range files {
+			rows = append(rows, fileCSVRow(file))
+		}
+		writeCSV(w, "files.csv", fileCSVHeader, rows)
+		return
+	case formatNDJSON:
+		writeNDJSON(w, files)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(FileListResponse{Files: files})
+}
+
+// parseUploadTagsAndMeta извлекает теги и поля meta.* из формы загрузки
+func parseUploadTagsAndMeta(r *http.Request) ([]string, map[string]string, error) {
+	if r.MultipartForm == nil {
+		return nil, nil, nil
+	}
+
+	tags, err := storage.NormalizeTags(storage.ParseTags(r.MultipartForm.Value["tags"]))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var meta map[string]string
+	for field, values := range r.MultipartForm.Value {
+		if !strings.HasPrefix(field, "meta.") || len(values) == 0 {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[strings.TrimPrefix(field, "meta.")] = values[0]
+	}
+	if err := storage.ValidateMeta(meta); err != nil {
+		return nil, nil, err
+	}
+
+	return tags, meta, nil
+}
+
+// queryTags возвращает теги для фильтрации из параметров запроса (?tag=a&tag=b или ?tag=a,b)
+func queryTags(r *http.Request) []string {
+	tags, err := storage.NormalizeTags(storage.ParseTags(r.URL.Query()["tag"]))
+	if err != nil {
+		// Некорректные теги не совпадут ни с одним файлом
+		return storage.ParseTags(r.URL.Query()["tag"])
+	}
+	return tags
+}
+
+// writePolicyViolation записывает отказ политики загрузки в ответ
+func (fh *FileHandler) writePolicyViolation(w http.ResponseWriter, decision policy.Decision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(decision.Status)
+	json.NewEncoder(w).Encode(PolicyViolationResponse{
+		Error:  decision.Message,
+		Reason: decision.Reason,
+		Rule:   decision.Rule,
+	})
+}
+
+// writeQuotaExceeded записывает отказ по квоте в ответ
+func (fh *FileHandler) writeQuotaExceeded(w http.ResponseWriter, decision quota.Decision) {
+	if decision.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(decision.RetryAfter.Seconds())+1))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(decision.Status)
+	json.NewEncoder(w).Encode(QuotaExceededResponse{
+		Error:  decision.Message,
+		Reason: decision.Reason,
+		Limit:  decision.Limit,
+		Used:   decision.Used,
+	})
 }
 
 // writeError записывает ошибку в ответ
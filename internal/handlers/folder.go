@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"file-agent/internal/storage"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// FolderHandler содержит обработчики для работы с виртуальными папками
+type FolderHandler struct {
+	storage *storage.S3Storage
+}
+
+// NewFolderHandler создает новый FolderHandler
+func NewFolderHandler(s3Storage *storage.S3Storage) *FolderHandler {
+	return &FolderHandler{
+		storage: s3Storage,
+	}
+}
+
+// CreateFolderRequest тело запроса на создание папки. Можно указать либо
+// полный путь (недостающие уровни будут созданы), либо имя и родителя
+type CreateFolderRequest struct {
+	Path     string `json:"path,omitempty"`
+	Name     string `json:"name,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// UpdateFolderRequest тело запроса на переименование или перемещение папки
+type UpdateFolderRequest struct {
+	Name       *string `json:"name,omitempty"`
+	ParentID   *string `json:"parent_id,omitempty"`
+	ParentPath *string `json:"parent_path,omitempty"`
+}
+
+// FolderListing содержимое папки
+type FolderListing struct {
+	Folder  *storage.Folder         `json:"folder"`
+	Folders []*storage.Folder       `json:"folders"`
+	Files   []*storage.FileMetadata `json:"files"`
+}
+
+// CreateFolder обрабатывает создание папки
+func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req CreateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+
+	var folder *storage.Folder
+	var err error
+	if req.Path != "" {
+		folder, err = h.storage.EnsureFolderPath(ctx, req.Path)
+	} else {
+		folder, err = h.storage.CreateFolder(ctx, req.ParentID, req.Name)
+	}
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// UpdateFolder обрабатывает переименование и перемещение папки
+func (h *FolderHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	folderID := mux.Vars(r)["id"]
+
+	var req UpdateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+
+	// Родитель может быть задан путем вместо идентификатора
+	parentID := req.ParentID
+	if req.ParentPath != nil {
+		parent, err := h.storage.FindFolderByPath(ctx, *req.ParentPath)
+		if err != nil {
+			writeFolderError(w, err)
+			return
+		}
+		parentID = &parent.ID
+	}
+
+	folder, err := h.storage.UpdateFolder(ctx, folderID, req.Name, parentID)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// ListFolder обрабатывает получение содержимого папки по пути (?path=)
+func (h *FolderHandler) ListFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	ctx := context.Background()
+	folder, err := h.storage.FindFolderByPath(ctx, r.URL.Query().Get("path"))
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	h.writeListing(w, r, folder)
+}
+
+// GetFolder обрабатывает получение содержимого папки по идентификатору
+func (h *FolderHandler) GetFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	// Идентификатор root обозначает корень дерева
+	folderID := mux.Vars(r)["id"]
+	if folderID == "root" {
+		folderID = ""
+	}
+
+	ctx := context.Background()
+	folder, err := h.storage.GetFolder(ctx, folderID)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	h.writeListing(w, r, folder)
+}
+
+// writeListing записывает содержимое папки в ответ. Файлы можно
+// отфильтровать по тегам (?tag=)
+func (h *FolderHandler) writeListing(w http.ResponseWriter, r *http.Request, folder *storage.Folder) {
+	ctx := context.Background()
+	folders, files, err := h.storage.ListFolderChildren(ctx, folder.ID)
+	if err != nil {
+		writeErrorResponse(w, "Failed to list folder", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(FolderListing{
+		Folder:  folder,
+		Folders: folders,
+		Files:   storage.FilterByTags(files, queryTags(r)),
+	})
+}
+
+// writeFolderError преобразует ошибку хранилища в HTTP-ответ
+func writeFolderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrFolderNotFound):
+		writeErrorResponse(w, "Folder not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrFolderExists):
+		writeErrorResponse(w, "Folder already exists", http.StatusConflict)
+	case errors.Is(err, storage.ErrInvalidPath):
+		writeErrorResponse(w, "Invalid folder name or path", http.StatusBadRequest)
+	default:
+		writeErrorResponse(w, "Failed to process folder request", http.StatusInternalServerError)
+	}
+}
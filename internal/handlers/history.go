@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"file-agent/internal/analytics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultHistoryDays период истории по умолчанию
+const defaultHistoryDays = 90
+
+// HistoryResponse ежедневные снимки статистики с оценкой прироста
+type HistoryResponse struct {
+	From        string                `json:"from"`
+	To          string                `json:"to"`
+	Granularity string                `json:"granularity"`
+	Snapshots   []*analytics.Snapshot `json:"snapshots"`
+	Growth      *analytics.Growth     `json:"growth,omitempty"`
+	Forecast    *CapacityForecast     `json:"forecast,omitempty"`
+}
+
+// CapacityForecast прогноз заполнения хранилища
+type CapacityForecast struct {
+	Capacity  int64      `json:"capacity"`
+	Used      int64      `json:"used"`
+	ReachedAt *time.Time `json:"reached_at"` // null, если объем не растет
+}
+
+// HistoryRecord строка истории в табличном виде
+type HistoryRecord struct {
+	Date      string `json:"date"`
+	Section   string `json:"section"`
+	Key       string `json:"key"`
+	FileCount int64  `json:"file_count"`
+	TotalSize int64  `json:"total_size"`
+}
+
+// SetHistory включает историю снимков статистики (/analytics/history)
+func (ah *AnalyticsHandler) SetHistory(history *analytics.History) {
+	ah.history = history
+}
+
+// GetHistory обрабатывает получение ежедневных снимков статистики за период
+// (?from=, ?to=), прореженных до ?granularity= (day, week, month), с оценкой
+// прироста и прогнозом заполнения объема ?capacity= (в байтах)
+func (ah *AnalyticsHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if ah.history == nil {
+		writeErrorResponse(w, "Analytics history is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+
+	format, err := responseFormat(r)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		if to, err = analytics.ParseTime(value, time.UTC); err != nil {
+			writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -defaultHistoryDays)
+	if value := query.Get("from"); value != "" {
+		if from, err = analytics.ParseTime(value, time.UTC); err != nil {
+			writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if from.After(to) {
+		writeErrorResponse(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = analytics.GranularityDay
+	case analytics.GranularityDay, analytics.GranularityWeek, analytics.GranularityMonth:
+	default:
+		writeErrorResponse(w, "granularity must be day, week or month", http.StatusBadRequest)
+		return
+	}
+
+	var capacity int64
+	if value := query.Get("capacity"); value != "" {
+		capacity, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || capacity <= 0 {
+			writeErrorResponse(w, "capacity must be a positive number of bytes", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	snapshots, err := ah.history.Snapshots(ctx, from, to)
+	if err != nil {
+		writeErrorResponse(w, "Failed to load analytics history", http.StatusInternalServerError)
+		return
+	}
+
+	response := HistoryResponse{
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Granularity: granularity,
+		Snapshots:   analytics.Downsample(snapshots, granularity),
+	}
+	if response.Snapshots == nil {
+		response.Snapshots = make([]*analytics.Snapshot, 0)
+	}
+
+	// Прирост оценивается по всем дневным снимкам, а не по прореженным
+	if growth, ok := analytics.EstimateGrowth(snapshots); ok {
+		response.Growth = &growth
+		if capacity > 0 {
+			last := snapshots[len(snapshots)-1]
+			response.Forecast = &CapacityForecast{Capacity: capacity, Used: last.TotalSize}
+			if reachedAt, ok := analytics.ForecastCapacity(last, growth, capacity); ok {
+				response.Forecast.ReachedAt = &reachedAt
+			}
+		}
+	}
+
+	if format != formatJSON {
+		writeHistoryRecords(w, format, historyRecords(response.Snapshots))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// historyRecords разворачивает снимки в строки: total, user и content_type
+func historyRecords(snapshots []*analytics.Snapshot) []HistoryRecord {
+	var records []HistoryRecord
+	for _, snapshot := range snapshots {
+		records = append(records, HistoryRecord{
+			Date:      snapshot.Date,
+			Section:   "total",
+			FileCount: snapshot.TotalFiles,
+			TotalSize: snapshot.TotalSize,
+		})
+		for _, user := range sortedKeys(snapshot.Users) {
+			b := snapshot.Users[user]
+			records = append(records, HistoryRecord{Date: snapshot.Date, Section: "user", Key: user, FileCount: b.FileCount, TotalSize: b.TotalSize})
+		}
+		for _, ct := range sortedKeys(snapshot.Types) {
+			b := snapshot.Types[ct]
+			records = append(records, HistoryRecord{Date: snapshot.Date, Section: "content_type", Key: ct, FileCount: b.FileCount, TotalSize: b.TotalSize})
+		}
+	}
+	return records
+}
+
+// writeHistoryRecords записывает строки истории в формате CSV или NDJSON
+func writeHistoryRecords(w http.ResponseWriter, format string, records []HistoryRecord) {
+	if format == formatNDJSON {
+		writeNDJSON(w, records)
+		return
+	}
+
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, []string{
+			record.Date,
+			record.Section,
+			csvText(record.Key),
+			csvInt(record.FileCount),
+			csvInt(record.TotalSize),
+		})
+	}
+	writeCSV(w, "history.csv", []string{"date", "section", "key", "file_count", "total_size"}, rows)
+}
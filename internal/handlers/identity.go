@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"file-agent/internal/middleware"
+	"net/http"
+	"unicode/utf8"
+)
+
+// AuthenticatedUserHeader заголовок, в котором прокси аутентификации
+// передает идентификатор пользователя
+const AuthenticatedUserHeader = middleware.AuthenticatedUserHeader
+
+// requestActor возвращает аутентифицированного пользователя запроса или
+// anonymous, если заголовку X-Authenticated-User нельзя доверять
+func requestActor(r *http.Request) string {
+	if user := middleware.AuthenticatedUser(r.Context()); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// maxHeaderLength максимальная длина заголовков, сохраняемых в журналах
+const maxHeaderLength = 512
+
+// truncate обрезает строку до limit байт, не разрывая символы UTF-8
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	value = value[:limit]
+	for !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"file-agent/internal/analytics"
+	"file-agent/internal/bandwidth"
+	"file-agent/internal/imaging"
+	"file-agent/internal/storage"
+	"file-agent/internal/thumbnail"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultThumbnailSize размер миниатюры по умолчанию
+	defaultThumbnailSize = 256
+	// defaultImageQuality качество JPEG по умолчанию
+	defaultImageQuality = 85
+	// maxTransformSource максимальный размер исходного файла для преобразования
+	maxTransformSource = 64 << 20
+)
+
+var (
+	// DefaultImageSizes разрешенные ширина и высота результата преобразования
+	DefaultImageSizes = []int{64, 128, 256, 320, 480, 640, 800, 1024, 1280, 1600, 1920, 2048}
+	// DefaultImageQualities разрешенные значения качества JPEG
+	DefaultImageQualities = []int{50, 70, 85, 95}
+)
+
+// ImageHandler содержит обработчики для работы с изображениями
+type ImageHandler struct {
+	storage        *storage.S3Storage
+	thumbnailSizes []int
+	maxDimension   int
+	transforms     chan struct{} // Ограничивает число одновременных преобразований
+	throttle       *bandwidth.Throttle
+	aggregates     *analytics.Store
+
+	// Запрошенные размеры и качество приводятся к этим значениям, чтобы
+	// число кэшируемых вариантов одного файла было ограничено
+	sizes     []int
+	qualities []int
+}
+
+// NewImageHandler создает новый ImageHandler
+func NewImageHandler(s3Storage *storage.S3Storage, thumbnailSizes []int, maxDimension int) *ImageHandler {
+	h := &ImageHandler{
+		storage:        s3Storage,
+		thumbnailSizes: thumbnailSizes,
+		maxDimension:   maxDimension,
+		transforms:     make(chan struct{}, runtime.NumCPU()),
+	}
+	h.SetVariants(DefaultImageSizes, DefaultImageQualities)
+	return h
+}
+
+// SetVariants задает разрешенные размеры и качество результата преобразования.
+// Размеры больше maxDimension отбрасываются; если не осталось ни одного,
+// используется maxDimension
+func (h *ImageHandler) SetVariants(sizes, qualities []int) {
+	h.sizes = nil
+	for _, size := range sizes {
+		if size > 0 && size <= h.maxDimension {
+			h.sizes = append(h.sizes, size)
+		}
+	}
+	if len(h.sizes) == 0 {
+		h.sizes = []int{h.maxDimension}
+	}
+	slices.Sort(h.sizes)
+
+	h.qualities = slices.Clone(qualities)
+	if len(h.qualities) == 0 {
+		h.qualities = []int{defaultImageQuality}
+	}
+	slices.Sort(h.qualities)
+}
+
+// SetThrottle включает ограничение скорости отдачи миниатюр и преобразованных
+// изображений (общее с отдачей файлов)
+func (h *ImageHandler) SetThrottle(throttle *bandwidth.Throttle) {
+	h.throttle = throttle
+}
+
+// SetAnalytics включает учет отдачи миниатюр и преобразованных изображений как скачиваний файла
+func (h *ImageHandler) SetAnalytics(store *analytics.Store) {
+	h.aggregates = store
+}
+
+// GetThumbnail обрабатывает получение миниатюры изображения (?size=256).
+// Возвращается ближайший сгенерированный размер не меньше запрошенного
+func (h *ImageHandler) GetThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	fileID := mux.Vars(r)["id"]
+
+	if len(h.thumbnailSizes) == 0 {
+		writeErrorResponse(w, "Thumbnails are disabled", http.StatusNotFound)
+		return
+	}
+
+	requested := defaultThumbnailSize
+	if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			writeErrorResponse(w, "Invalid size parameter", http.StatusBadRequest)
+			return
+		}
+		requested = size
+	}
+
+	ctx := context.Background()
+	metadata, err := h.storage.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		writeErrorResponse(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if message, status := unavailable(metadata); status != 0 {
+		writeErrorResponse(w, message, status)
+		return
+	}
+
+	size := thumbnail.ChooseSize(h.thumbnailSizes, requested)
+	reader, info, err := h.storage.GetObject(ctx, thumbnail.Key(fileID, size))
+	if err != nil {
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			writeErrorResponse(w, "Failed to load thumbnail", http.StatusInternalServerError)
+			return
+		}
+		if result, ok := metadata.Processing[thumbnail.ProcessorName]; ok && !result.Finished() {
+			writeErrorResponse(w, "Thumbnail is being generated, try again later", http.StatusConflict)
+			return
+		}
+		writeErrorResponse(w, "Thumbnail not available", http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	// Миниатюры не меняются, поэтому их можно кэшировать
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if _, err := h.delivery().send(w, r, metadata, reader, info.Size); err != nil {
+		log.Printf("Error sending thumbnail: %v", err)
+	}
+}
+
+// TransformImage обрабатывает преобразование изображения на лету:
+// ?w=&h=&fit=contain|cover|fill&format=jpeg|png&q=. Результат кэшируется
+// в хранилище по параметрам преобразования
+func (h *ImageHandler) TransformImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	fileID := mux.Vars(r)["id"]
+
+	opts, err := parseImageOptions(r)
+	if err == nil {
+		err = opts.Validate(h.maxDimension)
+	}
+	if err != nil {
+		writeErrorResponse(w, fmt.Sprintf("Invalid image parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+	opts = h.snapOptions(opts)
+
+	ctx := context.Background()
+	metadata, err := h.storage.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		writeErrorResponse(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if message, status := unavailable(metadata); status != 0 {
+		writeErrorResponse(w, message, status)
+		return
+	}
+	if !imaging.Supports(metadata.ContentType) || metadata.Size > maxTransformSource {
+		writeErrorResponse(w, "File is not a supported image", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Сначала пробуем отдать результат из кэша
+	cacheKey := imageCacheKey(fileID, opts)
+	if reader, info, err := h.storage.GetObject(ctx, cacheKey); err == nil {
+		defer reader.Close()
+		h.writeImage(w, r, metadata, reader, info.ContentType, info.Size, "HIT")
+		return
+	}
+
+	// Ожидание свободного слота прекращается, если клиент отключился
+	select {
+	case h.transforms <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	data, err := h.transform(r.Context(), fileID, opts)
+	<-h.transforms
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		if errors.Is(err, imaging.ErrUnsupported) {
+			writeErrorResponse(w, "File is not a supported image", http.StatusUnsupportedMediaType)
+		} else {
+			log.Printf("Failed to transform image %s: %v", fileID, err)
+			writeErrorResponse(w, "Failed to transform image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	contentType := imaging.ContentType(opts.Format)
+	if err := h.storage.PutObject(ctx, cacheKey, data, contentType); err != nil {
+		log.Printf("Failed to cache transformed image %s: %v", cacheKey, err)
+	}
+
+	h.writeImage(w, r, metadata, bytes.NewReader(data), contentType, int64(len(data)), "MISS")
+}
+
+// transform загружает исходное изображение и преобразует его
+func (h *ImageHandler) transform(ctx context.Context, fileID string, opts imaging.Options) ([]byte, error) {
+	reader, _, err := h.storage.GetFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := io.ReadAll(io.LimitReader(reader, maxTransformSource))
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	img, err := imaging.Decode(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, imaging.Transform(img, opts, h.maxDimension), opts.Format, opts.Quality); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeImage отправляет изображение клиенту
+func (h *ImageHandler) writeImage(w http.ResponseWriter, r *http.Request, metadata *storage.FileMetadata, reader io.Reader, contentType string, size int64, cacheStatus string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Cache", cacheStatus)
+	if _, err := h.delivery().send(w, r, metadata, reader, size); err != nil {
+		log.Printf("Error sending image: %v", err)
+	}
+}
+
+// delivery возвращает путь отдачи с ограничением скорости и учетом скачиваний
+func (h *ImageHandler) delivery() delivery {
+	return delivery{throttle: h.throttle, aggregates: h.aggregates}
+}
+
+// snapOptions приводит размеры к ближайшему разрешенному значению не меньше
+// запрошенного (или к наибольшему), а качество - к ближайшему разрешенному
+func (h *ImageHandler) snapOptions(opts imaging.Options) imaging.Options {
+	if opts.Width > 0 {
+		opts.Width = snapUp(h.sizes, opts.Width)
+	}
+	if opts.Height > 0 {
+		opts.Height = snapUp(h.sizes, opts.Height)
+	}
+	opts.Quality = snapNearest(h.qualities, opts.Quality)
+	return opts
+}
+
+// snapUp возвращает наименьшее значение из отсортированного списка не меньше
+// value, а если такого нет - наибольшее
+func snapUp(values []int, value int) int {
+	for _, v := range values {
+		if v >= value {
+			return v
+		}
+	}
+	return values[len(values)-1]
+}
+
+// snapNearest возвращает ближайшее к value значение из отсортированного
+// списка; при равном расстоянии - большее
+func snapNearest(values []int, value int) int {
+	nearest := values[0]
+	for _, v := range values[1:] {
+		if abs(v-value) <= abs(nearest-value) {
+			nearest = v
+		}
+	}
+	return nearest
+}
+
+// abs возвращает модуль числа
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// parseImageOptions разбирает параметры преобразования из запроса
+func parseImageOptions(r *http.Request) (imaging.Options, error) {
+	query := r.URL.Query()
+	opts := imaging.Options{
+		Fit:     query.Get("fit"),
+		Format:  query.Get("format"),
+		Quality: defaultImageQuality,
+	}
+
+	if opts.Fit == "" {
+		opts.Fit = imaging.FitContain
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = imaging.FormatJPEG
+	case "jpg":
+		opts.Format = imaging.FormatJPEG
+	}
+
+	for name, target := range map[string]*int{"w": &opts.Width, "h": &opts.Height, "q": &opts.Quality} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be an integer", name)
+		}
+		*target = n
+	}
+
+	return opts, nil
+}
+
+// imageCacheKey возвращает ключ кэша для результата преобразования
+func imageCacheKey(fileID string, opts imaging.Options) string {
+	return fmt.Sprintf("cache/images/%s/%dx%d-%s-q%d.%s", fileID, opts.Width, opts.Height, opts.Fit, opts.Quality, opts.Format)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"file-agent/internal/imaging"
+	"testing"
+)
+
+func TestSnapOptions(t *testing.T) {
+	h := &ImageHandler{maxDimension: 1024}
+	h.SetVariants([]int{800, 256, 2048, 512}, []int{95, 50, 85})
+
+	tests := []struct {
+		name string
+		opts imaging.Options
+		want imaging.Options
+	}{
+		{"exact values", imaging.Options{Width: 256, Quality: 85}, imaging.Options{Width: 256, Quality: 85}},
+		{"rounded up", imaging.Options{Width: 257, Height: 1, Quality: 85}, imaging.Options{Width: 512, Height: 256, Quality: 85}},
+		{"above largest allowed", imaging.Options{Width: 1000, Quality: 85}, imaging.Options{Width: 800, Quality: 85}},
+		{"missing side kept", imaging.Options{Height: 300, Quality: 85}, imaging.Options{Height: 512, Quality: 85}},
+		{"quality nearest", imaging.Options{Width: 256, Quality: 60}, imaging.Options{Width: 256, Quality: 50}},
+		{"quality tie goes up", imaging.Options{Width: 256, Quality: 90}, imaging.Options{Width: 256, Quality: 95}},
+		{"quality above largest", imaging.Options{Width: 256, Quality: 100}, imaging.Options{Width: 256, Quality: 95}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.snapOptions(tt.opts); got != tt.want {
+				t.Errorf("snapOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetVariantsFallback(t *testing.T) {
+	h := &ImageHandler{maxDimension: 100}
+	h.SetVariants([]int{256, 512}, nil)
+
+	if len(h.sizes) != 1 || h.sizes[0] != 100 {
+		t.Errorf("sizes = %v, want [100]", h.sizes)
+	}
+	if len(h.qualities) != 1 || h.qualities[0] != defaultImageQuality {
+		t.Errorf("qualities = %v, want [%d]", h.qualities, defaultImageQuality)
+	}
+}
+
+func TestImageCacheKeyVariants(t *testing.T) {
+	h := &ImageHandler{maxDimension: 2048}
+	h.SetVariants(DefaultImageSizes, DefaultImageQualities)
+
+	// Близкие запросы попадают в один кэшированный вариант
+	keys := make(map[string]bool)
+	for width := 257; width <= 320; width++ {
+		for quality := 80; quality <= 89; quality++ {
+			opts := h.snapOptions(imaging.Options{Width: width, Fit: imaging.FitContain, Format: imaging.FormatJPEG, Quality: quality})
+			keys[imageCacheKey("id", opts)] = true
+		}
+	}
+	if len(keys) != 1 {
+		t.Errorf("got %d cache keys, want 1: %v", len(keys), keys)
+	}
+}
@@ -41,24 +41,189 @@ func (h *InfoHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
 				Method:      "POST",
 				Description: "Загрузить файл в хранилище",
 				Parameters: map[string]string{
-					"file":        "Файл для загрузки (multipart/form-data)",
-					"uploaded_by": "Имя пользователя или идентификатор загрузившего (опционально)",
+					"file":           "Файл для загрузки (multipart/form-data)",
+					"uploaded_by":    "Имя пользователя или идентификатор загрузившего (опционально, X-Authenticated-User важнее)",
+					"path":           "Путь папки, например /projects/alpha (опционально, создается при необходимости)",
+					"tags":           "Теги через запятую или повторяющимся полем (опционально)",
+					"meta.*":         "Пользовательские метаданные, например meta.ticket=OPS-42 (опционально)",
+					"strip_metadata": "true/false - удалить EXIF/XMP из JPEG, PNG и WebP (по умолчанию STRIP_IMAGE_METADATA)",
 				},
 				Response: map[string]interface{}{
-					"id":       "Уникальный идентификатор файла",
-					"filename": "Оригинальное имя файла",
-					"url":      "Относительный URL для скачивания файла",
+					"id":           "Уникальный идентификатор файла",
+					"filename":     "Оригинальное имя файла",
+					"path":         "Полный путь файла в дереве папок",
+					"content_type": "MIME-тип, определенный по содержимому файла",
+					"scan_status":  "Результат антивирусной проверки (если включена)",
+					"status":       "Статус обработки файла (pending, если запланированы обработчики)",
+					"url":          "Относительный URL для скачивания файла",
+				},
+				Headers: map[string]string{
+					"X-Authenticated-User": "Автор загрузки, по которому проверяются квоты (при включенных квотах обязателен, без него - 401; 507 - объем или количество файлов, 429 - суточный лимит)",
+				},
+			},
+			"GET /quota": {
+				Method:      "GET",
+				Description: "Получить квоту пользователя и ее использование (если задан QUOTA_FILE)",
+				Parameters: map[string]string{
+					"user": "Другой пользователь (только на внутреннем порту INTERNAL_PORT, иначе 403)",
+				},
+				Headers: map[string]string{
+					"X-Authenticated-User": "Пользователь, квота которого запрашивается (без него и без user - 401)",
+				},
+				Response: map[string]interface{}{
+					"user":      "Пользователь",
+					"limits":    "Лимиты: max_bytes, max_files, max_uploads_per_day (отсутствующий не ограничен)",
+					"usage":     "Использование: bytes, files, uploads_today",
+					"resets_at": "Начало следующих суток UTC, когда сбрасывается суточный лимит",
+				},
+			},
+			"POST /scan/rescan": {
+				Method:      "POST",
+				Description: "Запустить повторную антивирусную проверку в фоне (только на внутреннем порту INTERNAL_PORT, если задан CLAMD_ADDRESS); 409, если проверка уже выполняется",
+				Parameters: map[string]string{
+					"file_ids": "Идентификаторы файлов в теле JSON (без них проверяются все файлы)",
+				},
+				Response: map[string]interface{}{
+					"running":    "Выполняется ли проверка",
+					"started_at": "Время запуска",
+				},
+			},
+			"GET /scan/rescan": {
+				Method:      "GET",
+				Description: "Состояние последней повторной проверки (только на внутреннем порту)",
+				Response: map[string]interface{}{
+					"running":     "Выполняется ли проверка",
+					"files":       "Количество запрошенных файлов (0 - все файлы)",
+					"finished_at": "Время завершения",
+					"scanned":     "Проверено файлов",
+					"infected":    "Найдено зараженных",
+					"failed":      "Не удалось проверить",
+					"error":       "Ошибка, прервавшая проверку",
 				},
 			},
 			"GET /{id}": {
 				Method:      "GET",
 				Description: "Скачать файл по его идентификатору",
+				Parameters: map[string]string{
+					"id":          "Уникальный идентификатор файла",
+					"disposition": "inline - показать в браузере (только изображения, PDF и текст), по умолчанию attachment",
+					"charset":     "utf-8 - перекодировать текстовый файл в UTF-8",
+				},
+				Headers: map[string]string{
+					"Content-Type":         "MIME-тип файла, определенный при загрузке, с параметром charset для текста",
+					"Content-Disposition":  "Имя файла: ASCII-вариант в filename и UTF-8 в filename* (RFC 6266/5987)",
+					"X-Authenticated-User": "Кто скачивает файл (лимит скорости EGRESS_RATE_LIMIT_PER_USER и статистика трафика)",
+				},
+			},
+			"DELETE /{id}": {
+				Method:      "DELETE",
+				Description: "Удалить файл вместе с миниатюрами и кэшем; журнал изменений сохраняется. Только на внутреннем порту (INTERNAL_PORT), на основном - 403",
 				Parameters: map[string]string{
 					"id": "Уникальный идентификатор файла",
 				},
 				Headers: map[string]string{
-					"Content-Type":        "MIME-тип файла",
-					"Content-Disposition": "Оригинальное имя файла",
+					"X-Authenticated-User": "Кто удаляет файл (обязательный, записывается в журнал; без него - 401)",
+				},
+			},
+			"GET /{id}/thumbnail": {
+				Method:      "GET",
+				Description: "Получить миниатюру изображения (JPEG, PNG, GIF, WebP)",
+				Parameters: map[string]string{
+					"id":   "Уникальный идентификатор файла",
+					"size": "Желаемый размер в пикселях (по умолчанию 256); возвращается ближайший доступный не меньше",
+				},
+			},
+			"GET /{id}/image": {
+				Method:      "GET",
+				Description: "Преобразовать изображение на лету (результат кэшируется)",
+				Parameters: map[string]string{
+					"id":     "Уникальный идентификатор файла",
+					"w":      "Ширина результата в пикселях (приводится к ближайшему значению из IMAGE_SIZES не меньше запрошенного)",
+					"h":      "Высота результата в пикселях (если не указана одна из сторон, она вычисляется по пропорциям)",
+					"fit":    "contain (по умолчанию), cover или fill",
+					"format": "jpeg (по умолчанию) или png",
+					"q":      "Качество JPEG от 1 до 100 (по умолчанию 85, приводится к ближайшему значению из IMAGE_QUALITIES)",
+				},
+			},
+			"GET /{id}/preview": {
+				Method:      "GET",
+				Description: "Предпросмотр CSV/TSV (заголовок и первые строки) или JSON/NDJSON (сокращенная структура)",
+				Parameters: map[string]string{
+					"id":        "Уникальный идентификатор файла",
+					"rows":      "Количество строк или элементов массива (по умолчанию 20, максимум 1000)",
+					"delimiter": "Разделитель CSV (по умолчанию определяется автоматически; tab - табуляция)",
+				},
+				Response: map[string]interface{}{
+					"format":    "csv, json или ndjson",
+					"delimiter": "Разделитель CSV",
+					"header":    "Заголовок CSV",
+					"rows":      "Первые строки CSV",
+					"preview":   "Структура JSON с отступами, пропущенное отмечено \"…\"",
+					"records":   "Количество показанных строк или записей",
+					"truncated": "Показан не весь файл",
+				},
+			},
+			"GET /{id}/archive/entries": {
+				Method:      "GET",
+				Description: "Список файлов в архиве ZIP, TAR или TAR.GZ без скачивания архива",
+				Parameters: map[string]string{
+					"id":     "Уникальный идентификатор файла",
+					"prefix": "Показать только записи с указанным префиксом пути (опционально)",
+				},
+				Response: map[string]interface{}{
+					"format":  "Формат архива: zip, tar или tar.gz",
+					"total":   "Количество записей",
+					"entries": "Записи: name, size, mtime, dir",
+				},
+			},
+			"GET /{id}/archive/entries/{path}": {
+				Method:      "GET",
+				Description: "Скачать один файл из архива (с ограничением скорости EGRESS_RATE_LIMIT*, как у самого архива)",
+				Parameters: map[string]string{
+					"id":   "Уникальный идентификатор файла",
+					"path": "Путь файла внутри архива",
+				},
+			},
+			"GET /path/{path}": {
+				Method:      "GET",
+				Description: "Скачать файл по пути в дереве папок, например /path/projects/alpha/spec.pdf",
+				Parameters: map[string]string{
+					"path": "Полный путь файла",
+				},
+			},
+			"POST /folders": {
+				Method:      "POST",
+				Description: "Создать папку (JSON)",
+				Parameters: map[string]string{
+					"path":      "Полный путь папки, недостающие уровни создаются автоматически",
+					"name":      "Имя папки (если не указан path)",
+					"parent_id": "Идентификатор родительской папки (если не указан path)",
+				},
+			},
+			"GET /folders": {
+				Method:      "GET",
+				Description: "Получить содержимое папки по пути",
+				Parameters: map[string]string{
+					"path": "Путь папки (по умолчанию корень)",
+					"tag":  "Фильтр файлов по тегу (опционально)",
+				},
+				Response: map[string]interface{}{
+					"folder":  "Текущая папка",
+					"folders": "Вложенные папки",
+					"files":   "Файлы в папке",
+				},
+			},
+			"GET /folders/{id}": {
+				Method:      "GET",
+				Description: "Получить содержимое папки по идентификатору (root - корень)",
+			},
+			"PATCH /folders/{id}": {
+				Method:      "PATCH",
+				Description: "Переименовать или переместить папку (JSON)",
+				Parameters: map[string]string{
+					"name":        "Новое имя папки",
+					"parent_id":   "Идентификатор новой родительской папки (пустая строка - корень)",
+					"parent_path": "Путь новой родительской папки",
 				},
 			},
 			"GET /metadata/{id}": {
@@ -68,22 +233,137 @@ func (h *InfoHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
 					"id": "Уникальный идентификатор файла",
 				},
 				Response: map[string]interface{}{
-					"id":          "Уникальный идентификатор файла",
-					"filename":    "Оригинальное имя файла",
-					"size":        "Размер файла в байтах",
-					"uploaded_at": "Время загрузки файла в формате RFC3339",
-					"uploaded_by": "Имя пользователя или идентификатор загрузившего (если указано)",
+					"id":                    "Уникальный идентификатор файла",
+					"filename":              "Оригинальное имя файла",
+					"size":                  "Размер файла в байтах",
+					"uploaded_at":           "Время загрузки файла в формате RFC3339",
+					"uploaded_by":           "Имя пользователя или идентификатор загрузившего (если указано)",
+					"folder_id":             "Идентификатор папки (пусто для корня)",
+					"path":                  "Полный путь файла в дереве папок",
+					"tags":                  "Теги файла",
+					"meta":                  "Пользовательские метаданные",
+					"content_type":          "MIME-тип, определенный по первым байтам и расширению",
+					"declared_content_type": "MIME-тип, указанный клиентом при загрузке",
+					"charset":               "Кодировка текстового файла",
+					"scan_status":           "Результат антивирусной проверки: clean или infected",
+					"scan_signature":        "Найденная сигнатура (для зараженных файлов)",
+					"scanned_at":            "Время последней проверки",
+					"status":                "Статус обработки: pending, processing, ready или failed",
+					"processing":            "Результаты обработчиков, выполняемых после загрузки",
+					"attributes":            "Атрибуты по типу файла: width/height, pages/title, duration, entries, lines",
+					"revision":              "Номер ревизии метаданных (также возвращается в заголовке ETag)",
+					"updated_at":            "Время последнего изменения метаданных",
+					"downloads":             "Счетчики скачиваний: count, completed, aborted, bytes_sent",
+					"last_accessed":         "Время последнего скачивания",
+				},
+			},
+			"PATCH /metadata/{id}": {
+				Method:      "PATCH",
+				Description: "Изменить метаданные файла (JSON Merge Patch, RFC 7396). На основном порту - только владелец файла, на INTERNAL_PORT - любой аутентифицированный пользователь",
+				Parameters: map[string]string{
+					"filename":    "Новое имя файла (меняет Content-Disposition при скачивании)",
+					"uploaded_by": "Новый автор загрузки; null очищает",
+					"charset":     "Кодировка текстового файла (utf-8, windows-1251, koi8-r, ...); null - определить автоматически",
+					"tags":        "Новый список тегов (заменяет текущий); null очищает",
+					"meta":        "Ключи для изменения; null удаляет ключ",
+				},
+				Headers: map[string]string{
+					"If-Match":             "ETag ревизии, которую изменяет клиент (опционально); при несовпадении - 412",
+					"X-Authenticated-User": "Кто вносит изменение (обязателен, без него - 401; записывается в журнал)",
+				},
+			},
+			"GET /metadata/{id}/history": {
+				Method:      "GET",
+				Description: "Получить журнал изменений метаданных файла",
+			},
+			"GET /files": {
+				Method:      "GET",
+				Description: "Получить список файлов",
+				Parameters: map[string]string{
+					"tag":    "Фильтр по тегу, можно указать несколько раз (опционально)",
+					"format": "json (по умолчанию), csv или ndjson; также учитывается заголовок Accept",
+				},
+			},
+			"GET /export/metadata": {
+				Method:      "GET",
+				Description: "Выгрузить метаданные всех файлов потоком в формате NDJSON",
+				Parameters: map[string]string{
+					"tag": "Фильтр по тегу, можно указать несколько раз (опционально)",
 				},
 			},
 			"GET /analytics": {
 				Method:      "GET",
-				Description: "Получить статистику использования сервиса",
+				Description: "Получить статистику использования сервиса (по сохраненным агрегатам, с ?tag= - по метаданным файлов из индекса тегов, не более 1000 файлов, иначе 400)",
+				Parameters: map[string]string{
+					"tag":         "Учитывать только файлы с указанными тегами (опционально)",
+					"from":        "Начало временного ряда: RFC 3339 или YYYY-MM-DD (по умолчанию 30 дней назад)",
+					"to":          "Конец временного ряда: RFC 3339 или YYYY-MM-DD (по умолчанию сейчас)",
+					"granularity": "Интервал ряда: hour, day (по умолчанию), week или month",
+					"timezone":    "Часовой пояс IANA для границ интервалов (по умолчанию UTC)",
+					"format":      "json (по умолчанию), csv или ndjson - строки section, key и показатели",
+					"per_user":    "true - файлы каждого пользователя на конец каждого интервала ряда (user_periods)",
+				},
+				Response: map[string]interface{}{
+					"total_files":           "Общее количество файлов",
+					"total_size":            "Общий размер всех файлов в байтах",
+					"total_size_human":      "Общий размер в читаемом формате",
+					"average_file_size":     "Средний размер файла в байтах",
+					"files_by_extension":    "Количество и объем файлов по расширениям (none - без расширения)",
+					"files_by_content_type": "Количество и объем файлов по MIME-типу, определенному при загрузке",
+					"size_histogram":        "Гистограмма размеров: интервалы [min_size, max_size) с количеством и объемом файлов",
+					"periods":               "Загрузки, скачивания и исходящий трафик (egress_bytes) за последние день, неделю и месяц",
+					"top_users":             "10 пользователей с наибольшим объемом файлов",
+					"timeseries":            "Упорядоченный ряд загрузок: buckets со start, end, file_count и total_size",
+					"most_downloaded":       "10 файлов с наибольшим числом скачиваний",
+					"top_downloaders":       "10 пользователей (X-Authenticated-User) с наибольшим исходящим трафиком",
+					"user_periods":          "С per_user=true: user, start, end, file_count и total_size на конец интервала",
+				},
+			},
+			"GET /analytics/history": {
+				Method:      "GET",
+				Description: "Получить ежедневные снимки статистики, средний прирост и прогноз заполнения хранилища",
+				Parameters: map[string]string{
+					"from":        "Начальная дата: YYYY-MM-DD или RFC 3339 (по умолчанию 90 дней назад)",
+					"to":          "Конечная дата (по умолчанию сегодня)",
+					"granularity": "day (по умолчанию), week или month - последний снимок интервала",
+					"capacity":    "Объем хранилища в байтах для прогноза (опционально)",
+					"format":      "json (по умолчанию), csv или ndjson",
+				},
+				Response: map[string]interface{}{
+					"snapshots": "Снимки: date, taken_at, total_files, total_size, users, types",
+					"growth":    "Средний прирост за день: files_per_day, bytes_per_day",
+					"forecast":  "Прогноз: capacity, used, reached_at",
+				},
+			},
+			"GET /analytics/users": {
+				Method:      "GET",
+				Description: "Получить статистику по всем пользователям с пагинацией",
+				Parameters: map[string]string{
+					"limit":  "Размер страницы от 1 до 1000 (по умолчанию 50)",
+					"offset": "Смещение от начала списка (по умолчанию 0)",
+					"sort":   "size (по умолчанию), files, downloads или name",
+					"format": "json (по умолчанию), csv или ndjson",
+				},
 				Response: map[string]interface{}{
-					"total_files":        "Общее количество файлов",
-					"total_size":         "Общий размер всех файлов в байтах",
-					"total_size_human":   "Общий размер в читаемом формате",
-					"average_file_size":  "Средний размер файла в байтах",
-					"files_by_extension": "Распределение файлов по расширениям",
+					"total": "Общее количество пользователей",
+					"users": "Пользователи: user, file_count, total_size, downloads, egress_bytes",
+				},
+			},
+			"GET /analytics/users/{user}": {
+				Method:      "GET",
+				Description: "Получить подробную статистику по пользователю",
+				Parameters: map[string]string{
+					"user":        "Имя пользователя (anonymous - файлы без автора)",
+					"from":        "Начало временного ряда (как в /analytics)",
+					"to":          "Конец временного ряда (как в /analytics)",
+					"granularity": "Интервал ряда: hour, day (по умолчанию), week или month",
+					"timezone":    "Часовой пояс IANA (по умолчанию UTC)",
+					"largest":     "Количество самых больших файлов от 0 до 100 (по умолчанию 10)",
+				},
+				Response: map[string]interface{}{
+					"files_by_content_type": "Количество и объем файлов пользователя по MIME-типу",
+					"timeseries":            "Временной ряд загрузок пользователя",
+					"largest_files":         "Самые большие файлы со счетчиками скачиваний",
 				},
 			},
 			"GET /info": {
@@ -101,6 +381,11 @@ func (h *InfoHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
 				Description: "Проверка готовности сервиса (readiness probe)",
 				Response:    "Ready",
 			},
+			"GET /metrics": {
+				Method:      "GET",
+				Description: "Метрики сервиса в текстовом формате Prometheus (только на внутреннем порту INTERNAL_PORT)",
+				Response:    "Запросы по маршрутам, передачи файлов, запросы к S3, количество и объем файлов",
+			},
 		},
 	}
 
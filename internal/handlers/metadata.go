@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"file-agent/internal/charset"
+	"file-agent/internal/middleware"
+	"file-agent/internal/storage"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// errPreconditionFailed возвращается, если If-Match не совпадает с текущей ревизией
+	errPreconditionFailed = errors.New("precondition failed")
+	// errNotOwner возвращается, если метаданные изменяет не владелец файла
+	errNotOwner = errors.New("not the owner of the file")
+)
+
+// UpdateFileMetadata обрабатывает изменение метаданных файла. Тело запроса
+// интерпретируется как JSON Merge Patch (RFC 7396) над редактируемыми полями:
+// filename, uploaded_by, charset, tags и meta. Заголовок If-Match проверяется
+// по ETag текущей ревизии. Изменять метаданные может аутентифицированный
+// пользователь: на внутреннем порту - любой, на основном - только владелец
+// файла (owner)
+func (fh *FileHandler) UpdateFileMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	user := middleware.AuthenticatedUser(r.Context())
+	if user == "" {
+		fh.writeError(w, "X-Authenticated-User header is required to edit metadata", http.StatusUnauthorized)
+		return
+	}
+	internal := middleware.ScopeFromContext(r.Context()) == middleware.ScopeInternal
+
+	fileID := mux.Vars(r)["id"]
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&patch); err != nil {
+		fh.writeError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	var changes map[string]storage.FieldChange
+	var previous storage.FileMetadata
+	ctx := context.Background()
+	metadata, err := fh.storage.UpdateMetadata(ctx, fileID, func(m *storage.FileMetadata) error {
+		if !internal && m.Owner != user {
+			return errNotOwner
+		}
+		if ifMatch != "" && ifMatch != "*" && !etagMatches(ifMatch, m.ETag()) {
+			w.Header().Set("ETag", m.ETag())
+			return errPreconditionFailed
+		}
+
+		previous = *m
+
+		var err error
+		changes, err = applyMetadataPatch(m, patch)
+		if err != nil {
+			return err
+		}
+
+		// Патч без изменений не меняет ревизию, чтобы If-Match других клиентов оставался верным
+		if len(changes) == 0 {
+			return storage.ErrUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errNotOwner):
+			fh.writeError(w, "Only the owner of the file can edit its metadata on this port", http.StatusForbidden)
+		case errors.Is(err, errPreconditionFailed):
+			fh.writeError(w, "Metadata was modified, reload and retry", http.StatusPreconditionFailed)
+		case errors.Is(err, storage.ErrInvalidMetadata):
+			fh.writeError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrFileNotFound):
+			fh.writeError(w, "File not found", http.StatusNotFound)
+		case errors.Is(err, storage.ErrFileExists):
+			fh.writeError(w, "A file with this name already exists in the folder", http.StatusConflict)
+		default:
+			log.Printf("Failed to update metadata of file %s: %v", fileID, err)
+			fh.writeError(w, "Failed to update metadata", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Имя файла и автор загрузки входят в статистику
+	if fh.aggregates != nil && (previous.Filename != metadata.Filename || previous.UploadedBy != metadata.UploadedBy) {
+		fh.aggregates.Replace(&previous, metadata)
+	}
+
+	// Записываем в журнал, кто и что изменил
+	if len(changes) > 0 {
+		record := storage.AuditRecord{
+			FileID:    metadata.ID,
+			Revision:  metadata.Revision,
+			ChangedBy: requestActor(r),
+			ChangedAt: *metadata.UpdatedAt,
+			Changes:   changes,
+		}
+		if err := fh.storage.SaveAuditRecord(ctx, record); err != nil {
+			log.Printf("Failed to save audit record for file %s: %v", metadata.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", metadata.ETag())
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// GetMetadataHistory обрабатывает получение журнала изменений метаданных файла
+func (fh *FileHandler) GetMetadataHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	fileID := mux.Vars(r)["id"]
+
+	ctx := context.Background()
+	_, err := fh.storage.GetFileMetadata(ctx, fileID)
+	if errors.Is(err, storage.ErrFileNotFound) {
+		fh.writeError(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load metadata of file %s: %v", fileID, err)
+		fh.writeError(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+
+	records, err := fh.storage.ListAuditRecords(ctx, fileID)
+	if err != nil {
+		fh.writeError(w, "Failed to load audit records", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+}
+
+// applyMetadataPatch применяет merge patch к метаданным и возвращает
+// список фактически изменившихся полей
+func applyMetadataPatch(m *storage.FileMetadata, patch map[string]json.RawMessage) (map[string]storage.FieldChange, error) {
+	changes := make(map[string]storage.FieldChange)
+
+	record := func(field string, oldValue, newValue interface{}) {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes[field] = storage.FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+
+	for field, raw := range patch {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch field {
+		case "filename":
+			var filename string
+			if isNull || json.Unmarshal(raw, &filename) != nil {
+				return nil, fmt.Errorf("%w: filename must be a string", storage.ErrInvalidMetadata)
+			}
+			if strings.ContainsAny(filename, "/\\") {
+				return nil, fmt.Errorf("%w: filename %q is not allowed", storage.ErrInvalidMetadata, filename)
+			}
+			filename = storage.SanitizeFilename(filename)
+			record(field, m.Filename, filename)
+			m.Filename = filename
+			m.Path = storage.JoinPath(path.Dir(m.Path), filename)
+
+		case "uploaded_by":
+			var uploadedBy string
+			if !isNull && json.Unmarshal(raw, &uploadedBy) != nil {
+				return nil, fmt.Errorf("%w: uploaded_by must be a string or null", storage.ErrInvalidMetadata)
+			}
+			record(field, m.UploadedBy, uploadedBy)
+			m.UploadedBy = uploadedBy
+
+		case "charset":
+			// Исправление неверно определенной кодировки текста
+			var name string
+			if !isNull && json.Unmarshal(raw, &name) != nil {
+				return nil, fmt.Errorf("%w: charset must be a string or null", storage.ErrInvalidMetadata)
+			}
+			if !isNull {
+				if name = charset.Normalize(name); name == "" {
+					return nil, fmt.Errorf("%w: unsupported charset", storage.ErrInvalidMetadata)
+				}
+			}
+			record(field, m.Charset, name)
+			m.Charset = name
+
+		case "tags":
+			var tags []string
+			if !isNull && json.Unmarshal(raw, &tags) != nil {
+				return nil, fmt.Errorf("%w: tags must be an array of strings or null", storage.ErrInvalidMetadata)
+			}
+			normalized, err := storage.NormalizeTags(tags)
+			if err != nil {
+				return nil, err
+			}
+			if len(normalized) == 0 {
+				normalized = nil
+			}
+			record(field, m.Tags, normalized)
+			m.Tags = normalized
+
+		case "meta":
+			var metaPatch map[string]*string
+			if !isNull && json.Unmarshal(raw, &metaPatch) != nil {
+				return nil, fmt.Errorf("%w: meta must be an object with string or null values", storage.ErrInvalidMetadata)
+			}
+
+			var meta map[string]string
+			if !isNull {
+				meta = make(map[string]string, len(m.Meta))
+				for key, value := range m.Meta {
+					meta[key] = value
+				}
+				for key, value := range metaPatch {
+					if value == nil {
+						delete(meta, key)
+					} else {
+						meta[key] = *value
+					}
+				}
+				if len(meta) == 0 {
+					meta = nil
+				}
+			}
+			if err := storage.ValidateMeta(meta); err != nil {
+				return nil, err
+			}
+			record(field, m.Meta, meta)
+			m.Meta = meta
+
+		default:
+			return nil, fmt.Errorf("%w: field %q is not editable", storage.ErrInvalidMetadata, field)
+		}
+	}
+
+	return changes, nil
+}
+
+// etagMatches проверяет значение If-Match, которое может содержать несколько ETag
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"file-agent/internal/storage"
+)
+
+func TestApplyMetadataPatch(t *testing.T) {
+	base := func() *storage.FileMetadata {
+		return &storage.FileMetadata{
+			Filename:   "a.txt",
+			Path:       "/docs/a.txt",
+			UploadedBy: "alice",
+			Tags:       []string{"x"},
+			Meta:       map[string]string{"k1": "v1", "k2": "v2"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		patch       string
+		wantChanges []string
+		wantErr     bool
+		check       func(t *testing.T, m *storage.FileMetadata)
+	}{
+		{
+			name:        "rename keeps folder",
+			patch:       `{"filename": " b.txt "}`,
+			wantChanges: []string{"filename"},
+			check: func(t *testing.T, m *storage.FileMetadata) {
+				if m.Filename != "b.txt" || m.Path != "/docs/b.txt" {
+					t.Errorf("filename = %q, path = %q", m.Filename, m.Path)
+				}
+			},
+		},
+		{name: "filename with separator", patch: `{"filename": "../b.txt"}`, wantErr: true},
+		{name: "filename null", patch: `{"filename": null}`, wantErr: true},
+		{
+			name:        "unchanged value is not a change",
+			patch:       `{"uploaded_by": "alice", "tags": ["X"]}`,
+			wantChanges: []string{},
+		},
+		{
+			name:        "null clears field",
+			patch:       `{"uploaded_by": null, "tags": null}`,
+			wantChanges: []string{"tags", "uploaded_by"},
+			check: func(t *testing.T, m *storage.FileMetadata) {
+				if m.UploadedBy != "" || m.Tags != nil {
+					t.Errorf("uploaded_by = %q, tags = %q", m.UploadedBy, m.Tags)
+				}
+			},
+		},
+		{
+			name:        "meta merge patch",
+			patch:       `{"meta": {"k1": null, "k3": "v3"}}`,
+			wantChanges: []string{"meta"},
+			check: func(t *testing.T, m *storage.FileMetadata) {
+				want := map[string]string{"k2": "v2", "k3": "v3"}
+				if !reflect.DeepEqual(m.Meta, want) {
+					t.Errorf("meta = %v, want %v", m.Meta, want)
+				}
+			},
+		},
+		{name: "invalid tag", patch: `{"tags": ["-x"]}`, wantErr: true},
+		{name: "invalid meta key", patch: `{"meta": {"Bad Key": "v"}}`, wantErr: true},
+		{name: "unsupported charset", patch: `{"charset": "klingon"}`, wantErr: true},
+		{name: "field not editable", patch: `{"owner": "mallory"}`, wantErr: true},
+		{name: "wrong type", patch: `{"tags": "x"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+
+			m := base()
+			changes, err := applyMetadataPatch(m, patch)
+			if tt.wantErr {
+				if !errors.Is(err, storage.ErrInvalidMetadata) {
+					t.Errorf("applyMetadataPatch() error = %v, want ErrInvalidMetadata", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyMetadataPatch() error = %v", err)
+			}
+
+			fields := []string{}
+			for field := range changes {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, tt.wantChanges) {
+				t.Errorf("changes = %q, want %q", fields, tt.wantChanges)
+			}
+			if tt.check != nil {
+				tt.check(t, m)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"1", "3"`, true},
+		{`"1","2"`, false},
+		{`3`, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifMatch, `"3"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifMatch, got, tt.want)
+		}
+	}
+}
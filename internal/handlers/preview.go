@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"file-agent/internal/charset"
+	"file-agent/internal/preview"
+	"file-agent/internal/storage"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// PreviewHandler содержит обработчик предпросмотра табличных и JSON-данных
+type PreviewHandler struct {
+	storage *storage.S3Storage
+}
+
+// NewPreviewHandler создает новый PreviewHandler
+func NewPreviewHandler(s3Storage *storage.S3Storage) *PreviewHandler {
+	return &PreviewHandler{
+		storage: s3Storage,
+	}
+}
+
+// PreviewResponse ответ предпросмотра
+type PreviewResponse struct {
+	ID string `json:"id"`
+	*preview.Result
+}
+
+// GetPreview возвращает начало CSV/TSV (заголовок и первые строки) или
+// JSON/NDJSON (сокращенная структура). Файл читается запросами с заголовком
+// Range только в нужном объеме
+func (h *PreviewHandler) GetPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	fileID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	opts := preview.Options{Rows: preview.DefaultRows}
+	if rowsStr := query.Get("rows"); rowsStr != "" {
+		rows, err := strconv.Atoi(rowsStr)
+		if err != nil || rows < 1 || rows > preview.MaxRows {
+			writeErrorResponse(w, fmt.Sprintf("rows must be between 1 and %d", preview.MaxRows), http.StatusBadRequest)
+			return
+		}
+		opts.Rows = rows
+	}
+	if delimiter := query.Get("delimiter"); delimiter != "" {
+		if delimiter == "tab" || delimiter == `\t` {
+			delimiter = "\t"
+		}
+		if utf8.RuneCountInString(delimiter) != 1 {
+			writeErrorResponse(w, "delimiter must be a single character", http.StatusBadRequest)
+			return
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	}
+
+	ctx := context.Background()
+	metadata, err := h.storage.GetFileMetadata(ctx, fileID)
+	if err != nil {
+		writeErrorResponse(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if message, status := unavailable(metadata); status != 0 {
+		writeErrorResponse(w, message, status)
+		return
+	}
+
+	format := preview.Format(metadata.ContentType)
+	if format == "" {
+		writeErrorResponse(w, fmt.Sprintf("Preview is not available for %s", metadata.ContentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Читаем файл блоками по мере разбора, перекодируя текст в UTF-8
+	var content io.Reader = io.NewSectionReader(h.storage.OpenFileAt(ctx, fileID, metadata.Size), 0, metadata.Size)
+	if metadata.Charset != "" {
+		if decoded, err := charset.NewReader(content, metadata.Charset); err == nil {
+			content = decoded
+		}
+	}
+
+	result, err := preview.Build(content, format, opts)
+	if err != nil {
+		if errors.Is(err, preview.ErrInvalid) {
+			writeErrorResponse(w, fmt.Sprintf("Failed to parse file: %v", err), http.StatusUnprocessableEntity)
+		} else {
+			log.Printf("Failed to build preview for %s: %v", fileID, err)
+			writeErrorResponse(w, "Failed to read file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PreviewResponse{ID: fileID, Result: result})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"file-agent/internal/middleware"
+	"file-agent/internal/quota"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// QuotaResponse квота пользователя и ее использование
+type QuotaResponse struct {
+	User     string       `json:"user"`
+	Limits   quota.Limits `json:"limits"` // Отсутствующий лимит не ограничен
+	Usage    quota.Usage  `json:"usage"`
+	ResetsAt time.Time    `json:"resets_at"` // Сброс суточного лимита загрузок
+}
+
+// GetQuota обрабатывает получение квоты и ее использования. Пользователь -
+// аутентифицированный пользователь запроса; квоту другого пользователя
+// (?user=) можно запросить только на внутреннем порту
+func (fh *FileHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if fh.quotas == nil {
+		writeErrorResponse(w, "Quotas are not enabled", http.StatusNotFound)
+		return
+	}
+
+	user := middleware.AuthenticatedUser(r.Context())
+	if requested := strings.TrimSpace(r.URL.Query().Get("user")); requested != "" && requested != user {
+		if middleware.ScopeFromContext(r.Context()) != middleware.ScopeInternal {
+			fh.writeError(w, "Quota of another user is only available on the internal port", http.StatusForbidden)
+			return
+		}
+		user = requested
+	}
+	if user == "" {
+		fh.writeError(w, "X-Authenticated-User header is required to get a quota", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	response := QuotaResponse{
+		User:     user,
+		Limits:   fh.quotas.Limits(user),
+		Usage:    fh.quotas.Usage(user, now),
+		ResetsAt: quota.ResetsAt(now),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
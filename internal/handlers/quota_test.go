@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"file-agent/internal/analytics"
+	"file-agent/internal/middleware"
+	"file-agent/internal/quota"
+	"file-agent/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// unreadBody тело запроса, которое не должно читаться
+type unreadBody struct {
+	t *testing.T
+}
+
+func (b unreadBody) Read([]byte) (int, error) {
+	b.t.Error("request body was read")
+	return 0, http.ErrBodyReadAfterClose
+}
+
+func (b unreadBody) Close() error {
+	return nil
+}
+
+func TestUploadQuotaPrecheck(t *testing.T) {
+	aggregates := analytics.NewStore(nil)
+	aggregates.AddUpload(&storage.FileMetadata{ID: "1", Filename: "a.bin", Size: 9 << 20, Owner: "alice", UploadedAt: time.Now()})
+
+	fh := &FileHandler{maxFileSize: 100 << 20}
+	fh.SetQuotas(quota.New(quota.Config{Default: quota.Limits{MaxBytes: 10 << 20}}, aggregates))
+	handler := middleware.IdentityMiddleware(1)(http.HandlerFunc(fh.UploadFile))
+
+	tests := []struct {
+		name          string
+		user          string
+		contentLength int64
+		wantStatus    int
+		wantReason    string
+	}{
+		{"anonymous upload", "", 1 << 10, http.StatusUnauthorized, ""},
+		{"content length above remaining quota", "alice", 3<<20 + maxFormOverhead, http.StatusInsufficientStorage, quota.ReasonMaxBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Body = unreadBody{t: t}
+			req.ContentLength = tt.contentLength
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+			if tt.user != "" {
+				req.Header.Set(AuthenticatedUserHeader, tt.user)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			var response QuotaExceededResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if response.Reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", response.Reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"file-agent/internal/middleware"
+	"file-agent/internal/scanner"
+	"io"
+	"net/http"
+)
+
+// ScanHandler содержит обработчики повторной антивирусной проверки
+type ScanHandler struct {
+	rescanner *scanner.Rescanner
+}
+
+// NewScanHandler создает новый ScanHandler. Без clamd rescanner равен nil
+func NewScanHandler(rescanner *scanner.Rescanner) *ScanHandler {
+	return &ScanHandler{
+		rescanner: rescanner,
+	}
+}
+
+// RescanRequest тело запроса на повторную проверку; без file_ids
+// проверяются все файлы
+type RescanRequest struct {
+	FileIDs []string `json:"file_ids,omitempty"`
+}
+
+// StartRescan запускает повторную проверку файлов в работающем сервисе.
+// Доступно только на внутреннем порту
+func (sh *ScanHandler) StartRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if !sh.available(w, r) {
+		return
+	}
+
+	var request RescanRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status, err := sh.rescanner.Start(request.FileIDs)
+	if errors.Is(err, scanner.ErrRescanRunning) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// GetRescan возвращает состояние последней повторной проверки
+func (sh *ScanHandler) GetRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+	if !sh.available(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sh.rescanner.Status())
+}
+
+// available проверяет, что проверка настроена и запрос пришел на внутренний порт
+func (sh *ScanHandler) available(w http.ResponseWriter, r *http.Request) bool {
+	if sh.rescanner == nil {
+		writeErrorResponse(w, "Antivirus scanning is not enabled", http.StatusNotFound)
+		return false
+	}
+	if middleware.ScopeFromContext(r.Context()) != middleware.ScopeInternal {
+		writeErrorResponse(w, "Rescan is only available on the internal port", http.StatusForbidden)
+		return false
+	}
+	return true
+}
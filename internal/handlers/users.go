@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"file-agent/internal/analytics"
+	"file-agent/internal/storage"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Параметры постраничного вывода пользователей
+const (
+	defaultUsersLimit   = 50
+	maxUsersLimit       = 1000
+	defaultLargestFiles = 10
+	maxLargestFiles     = 100
+)
+
+// Порядок сортировки пользователей (?sort=)
+const (
+	userSortSize      = "size"
+	userSortFiles     = "files"
+	userSortDownloads = "downloads"
+	userSortName      = "name"
+)
+
+// UserListResponse страница списка пользователей
+type UserListResponse struct {
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Users  []UserStats `json:"users"`
+}
+
+// UserFile файл пользователя со статистикой скачиваний
+type UserFile struct {
+	ID           string                     `json:"id"`
+	Filename     string                     `json:"filename"`
+	Path         string                     `json:"path"`
+	Size         int64                      `json:"size"`
+	UploadedAt   time.Time                  `json:"uploaded_at"`
+	Downloads    analytics.DownloadCounters `json:"downloads"`
+	LastAccessed *time.Time                 `json:"last_accessed"`
+}
+
+// UserDetailResponse подробная статистика по пользователю
+type UserDetailResponse struct {
+	UserStats
+	TotalSizeHuman     string                          `json:"total_size_human"`
+	AverageFileSize    int64                           `json:"average_file_size"`
+	FilesByContentType map[string]*analytics.Breakdown `json:"files_by_content_type"`
+	Timeseries         *analytics.Series               `json:"timeseries"`
+	LargestFiles       []UserFile                      `json:"largest_files"`
+}
+
+// ListUsers обрабатывает получение списка всех пользователей с пагинацией
+// (?limit=, ?offset=) и сортировкой (?sort=size|files|downloads|name)
+func (ah *AnalyticsHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	query := r.URL.Query()
+
+	format, err := responseFormat(r)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(query, "limit", defaultUsersLimit, 1, maxUsersLimit)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(query, "offset", 0, 0, -1)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortBy := query.Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = userSortSize
+	case userSortSize, userSortFiles, userSortDownloads, userSortName:
+	default:
+		writeErrorResponse(w, "sort must be size, files, downloads or name", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	summary, err := ah.summary(ctx, nil)
+	if err != nil {
+		writeErrorResponse(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+
+	users := sortedUsers(summary, sortBy)
+	response := UserListResponse{
+		Total:  len(users),
+		Limit:  limit,
+		Offset: offset,
+		Users:  make([]UserStats, 0),
+	}
+	if offset < len(users) {
+		end := offset + limit
+		if end > len(users) {
+			end = len(users)
+		}
+		response.Users = users[offset:end]
+	}
+
+	// Табличные форматы содержат только текущую страницу
+	if format != formatJSON {
+		records := make([]AnalyticsRecord, 0, len(response.Users))
+		for _, user := range response.Users {
+			records = append(records, userRecord(user))
+		}
+		writeAnalyticsRecords(w, format, "users."+format, records)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetUser обрабатывает получение подробной статистики по пользователю:
+// временной ряд загрузок (параметры как у /analytics), распределение по
+// типам и самые большие файлы (?largest=) со счетчиками скачиваний
+func (ah *AnalyticsHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	user := mux.Vars(r)["user"]
+
+	series, err := parseSeries(r)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	largest, err := queryInt(r.URL.Query(), "largest", defaultLargestFiles, 0, maxLargestFiles)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	summary, err := ah.summary(ctx, nil)
+	if err != nil {
+		writeErrorResponse(w, "Failed to load metadata", http.StatusInternalServerError)
+		return
+	}
+
+	stats, ok := summary.Users[user]
+	if !ok {
+		writeErrorResponse(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	stats.FillSeries(series)
+
+	response := UserDetailResponse{
+		UserStats:          userStats(user, stats),
+		TotalSizeHuman:     analytics.FormatSize(stats.TotalSize),
+		FilesByContentType: stats.Types,
+		Timeseries:         series,
+		LargestFiles:       make([]UserFile, 0),
+	}
+	if stats.FileCount > 0 {
+		response.AverageFileSize = stats.TotalSize / stats.FileCount
+	}
+
+	// Отдельные файлы в агрегатах не хранятся, поэтому берутся из метаданных
+	if largest > 0 {
+		allMetadata, err := ah.storage.ListAllMetadata(ctx)
+		if err != nil {
+			writeErrorResponse(w, "Failed to load metadata", http.StatusInternalServerError)
+			return
+		}
+		response.LargestFiles = largestFiles(allMetadata, user, ah.downloads, largest)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sortedUsers возвращает статистику всех пользователей в заданном порядке
+func sortedUsers(summary *analytics.Summary, sortBy string) []UserStats {
+	users := make([]UserStats, 0, len(summary.Users))
+	for user, stats := range summary.Users {
+		users = append(users, userStats(user, stats))
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		switch {
+		case sortBy == userSortFiles && a.FileCount != b.FileCount:
+			return a.FileCount > b.FileCount
+		case sortBy == userSortDownloads && a.Downloads != b.Downloads:
+			return a.Downloads > b.Downloads
+		case sortBy == userSortSize && a.TotalSize != b.TotalSize:
+			return a.TotalSize > b.TotalSize
+		}
+		return a.User < b.User
+	})
+
+	return users
+}
+
+// userStats формирует итоговую статистику пользователя
+func userStats(user string, stats *analytics.UserSummary) UserStats {
+	return UserStats{
+		User:        user,
+		FileCount:   stats.FileCount,
+		TotalSize:   stats.TotalSize,
+		Downloads:   stats.Downloads,
+		EgressBytes: stats.EgressBytes,
+	}
+}
+
+// largestFiles возвращает limit самых больших файлов пользователя
+func largestFiles(allMetadata []*storage.FileMetadata, user string, downloads func(string) (analytics.DownloadStats, bool), limit int) []UserFile {
+	var owned []*storage.FileMetadata
+	for _, meta := range allMetadata {
+		if analytics.Uploader(meta) == user {
+			owned = append(owned, meta)
+		}
+	}
+
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].Size > owned[j].Size
+	})
+	if len(owned) > limit {
+		owned = owned[:limit]
+	}
+
+	files := make([]UserFile, 0, len(owned))
+	for _, meta := range owned {
+		file := UserFile{
+			ID:         meta.ID,
+			Filename:   meta.Filename,
+			Path:       meta.Path,
+			Size:       meta.Size,
+			UploadedAt: meta.UploadedAt,
+		}
+		if stats, ok := downloads(meta.ID); ok {
+			file.Downloads = stats.DownloadCounters
+			file.LastAccessed = stats.LastAccessed
+		}
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// queryInt разбирает целочисленный параметр запроса в пределах [min, max];
+// max < 0 означает отсутствие верхней границы
+func queryInt(query url.Values, name string, def, min, max int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if max < 0 && (err != nil || n < min) {
+		return 0, fmt.Errorf("%s must be an integer not less than %d", name, min)
+	}
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return n, nil
+}
@@ -0,0 +1,129 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// Регистрируем декодеры поддерживаемых форматов
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels ограничение на размер декодируемого изображения (защита от
+// "бомб" с огромными размерами при маленьком файле)
+const MaxPixels = 50_000_000
+
+// Форматы вывода
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// ErrUnsupported возвращается для неподдерживаемых изображений
+var ErrUnsupported = errors.New("unsupported image")
+
+// supportedTypes MIME-типы, которые можно декодировать
+var supportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Supports проверяет, можно ли декодировать изображение данного типа
+func Supports(contentType string) bool {
+	return supportedTypes[contentType]
+}
+
+// Decode декодирует изображение, предварительно проверяя его размеры.
+// Ориентация из EXIF применяется к пикселям
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: dimensions %dx%d exceed limit", ErrUnsupported, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	return Orient(img, Orientation(data)), nil
+}
+
+// Fit уменьшает изображение так, чтобы оно помещалось в прямоугольник
+// maxWidth x maxHeight с сохранением пропорций. Изображение не увеличивается
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width <= maxWidth && height <= maxHeight {
+		return img
+	}
+
+	scale := float64(maxWidth) / float64(width)
+	if s := float64(maxHeight) / float64(height); s < scale {
+		scale = s
+	}
+
+	return Resize(img, max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5)))
+}
+
+// Resize масштабирует изображение до указанных размеров
+func Resize(img image.Image, width, height int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// HasAlpha проверяет, есть ли в изображении прозрачные пиксели
+func HasAlpha(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return true
+}
+
+// Encode кодирует изображение в указанном формате
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case FormatJPEG:
+		// JPEG не поддерживает прозрачность - накладываем на белый фон
+		if HasAlpha(img) {
+			img = flatten(img, color.White)
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	default:
+		return fmt.Errorf("%w: output format %q", ErrUnsupported, format)
+	}
+}
+
+// ContentType возвращает MIME-тип формата вывода
+func ContentType(format string) string {
+	if format == FormatPNG {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// flatten накладывает изображение на сплошной фон
+func flatten(img image.Image, background color.Color) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+	return dst
+}
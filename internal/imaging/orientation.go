@@ -0,0 +1,134 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// orientationTag тег EXIF с ориентацией изображения
+const orientationTag = 0x0112
+
+// Orientation возвращает ориентацию из EXIF (1-8). Если ее нет, возвращается 1
+func Orientation(data []byte) int {
+	tiff := exifData(data)
+	if tiff == nil {
+		return 1
+	}
+	if o := tiffOrientation(tiff); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// exifData находит TIFF-данные EXIF в JPEG, PNG или WebP
+func exifData(data []byte) []byte {
+	var payload []byte
+	switch {
+	case isJPEG(data):
+		walkJPEG(data, func(marker byte, segment []byte) bool {
+			if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+				payload = segment
+				return false
+			}
+			return true
+		})
+	case isPNG(data):
+		walkPNG(data, func(chunkType string, chunk []byte) bool {
+			if chunkType == "eXIf" {
+				payload = chunk
+				return false
+			}
+			return true
+		})
+	case isWebP(data):
+		walkWebP(data, func(fourCC string, chunk []byte) bool {
+			if fourCC == "EXIF" {
+				payload = chunk
+				return false
+			}
+			return true
+		})
+	}
+	return bytes.TrimPrefix(payload, exifHeader)
+}
+
+// tiffOrientation читает тег ориентации из первого IFD
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// Orient поворачивает и отражает изображение согласно ориентации EXIF
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Для ориентаций 5-8 ширина и высота меняются местами
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Отражение по горизонтали
+				sx, sy = w-1-x, y
+			case 3: // Поворот на 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // Отражение по вертикали
+				sx, sy = x, h-1-y
+			case 5: // Транспонирование
+				sx, sy = y, x
+			case 6: // Поворот на 90° по часовой стрелке
+				sx, sy = y, h-1-x
+			case 7: // Транспонирование с поворотом на 180°
+				sx, sy = w-1-y, h-1-x
+			case 8: // Поворот на 90° против часовой стрелки
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
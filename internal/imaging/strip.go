@@ -0,0 +1,452 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+// Виды удаляемых метаданных
+const (
+	MetadataEXIF    = "exif"
+	MetadataXMP     = "xmp"
+	MetadataIPTC    = "iptc"
+	MetadataComment = "comment"
+	MetadataText    = "text"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// ErrMalformed возвращается, если структуру изображения не удалось разобрать
+// до конца: такое изображение нельзя считать очищенным от метаданных
+var ErrMalformed = errors.New("malformed image")
+
+// StripResult результат удаления метаданных
+type StripResult struct {
+	Data     []byte   // Изображение без метаданных
+	Removed  []string // Виды удаленных метаданных
+	Oriented bool     // Ориентация из EXIF применена к пикселям
+}
+
+// CanStrip проверяет, поддерживается ли удаление метаданных для типа
+func CanStrip(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// StripMetadata удаляет EXIF, XMP, IPTC и комментарии из JPEG, PNG и WebP.
+// Если в EXIF указана ориентация, изображение JPEG или PNG поворачивается и
+// перекодируется, чтобы оно отображалось так же, как до удаления. WebP нельзя
+// перекодировать (в Go нет кодировщика), поэтому вместо исходного EXIF в нем
+// остается EXIF только с тегом ориентации. Если структуру файла не удалось
+// разобрать до конца, возвращается ErrMalformed
+func StripMetadata(data []byte) (*StripResult, error) {
+	orientation := Orientation(data)
+
+	var result *StripResult
+	var err error
+	switch {
+	case isJPEG(data):
+		result, err = stripJPEG(data)
+	case isPNG(data):
+		result, err = stripPNG(data)
+	case isWebP(data):
+		result, err = stripWebP(data, orientation)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if orientation == 1 || isWebP(data) {
+		return result, nil
+	}
+
+	// Применяем ориентацию: перекодированное изображение не содержит
+	// метаданных, поэтому сведения о цветах переносятся из исходного
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	format := FormatJPEG
+	if isPNG(data) {
+		format = FormatPNG
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, format, 92); err != nil {
+		return nil, err
+	}
+
+	if format == FormatPNG {
+		result.Data, err = insertPNGColor(buf.Bytes(), data, colorSpace(img))
+	} else {
+		result.Data, err = insertJPEGProfile(buf.Bytes(), data, colorSpace(img))
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Oriented = true
+	return result, nil
+}
+
+// stripJPEG удаляет сегменты APP1 (EXIF, XMP), APP13 (IPTC) и COM.
+// APP0, ICC-профиль (APP2) и APP14 сохраняются - они влияют на цвета
+func stripJPEG(data []byte) (*StripResult, error) {
+	result := &StripResult{}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	pos, err := walkJPEG(data, func(marker byte, segment []byte) bool {
+		kind := ""
+		switch marker {
+		case 0xE1:
+			kind = MetadataXMP
+			if bytes.HasPrefix(segment, exifHeader) {
+				kind = MetadataEXIF
+			}
+		case 0xED:
+			kind = MetadataIPTC
+		case 0xFE:
+			kind = MetadataComment
+		}
+
+		if kind != "" {
+			result.add(kind)
+		} else {
+			out = appendJPEGSegment(out, marker, segment)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Данные изображения после заголовков копируются как есть
+	result.Data = append(out, data[pos:]...)
+	return result, nil
+}
+
+// stripPNG удаляет чанки eXIf, tEXt, zTXt, iTXt (в том числе XMP) и tIME
+func stripPNG(data []byte) (*StripResult, error) {
+	result := &StripResult{}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngHeader...)
+
+	err := walkPNG(data, func(chunkType string, chunk []byte) bool {
+		switch chunkType {
+		case "eXIf":
+			result.add(MetadataEXIF)
+		case "tEXt", "zTXt", "iTXt":
+			result.add(MetadataText)
+		case "tIME":
+		default:
+			out = appendPNGChunk(out, chunkType, chunk)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Data = out
+	return result, nil
+}
+
+// stripWebP удаляет чанки EXIF и XMP и сбрасывает их флаги в VP8X. Если
+// ориентация отличается от 1, добавляется EXIF только с ориентацией
+func stripWebP(data []byte, orientation int) (*StripResult, error) {
+	result := &StripResult{}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+
+	keepOrientation := orientation != 1
+
+	err := walkWebP(data, func(fourCC string, chunk []byte) bool {
+		switch fourCC {
+		case "EXIF":
+			result.add(MetadataEXIF)
+			return true
+		case "XMP ":
+			result.add(MetadataXMP)
+			return true
+		case "VP8X":
+			if len(chunk) > 0 {
+				chunk = append([]byte(nil), chunk...)
+				chunk[0] &^= 0x08 | 0x04
+				if keepOrientation {
+					chunk[0] |= 0x08
+				}
+			}
+		}
+
+		out = appendWebPChunk(out, fourCC, chunk)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// EXIF в WebP допустим только в расширенном формате (VP8X), а ориентация
+	// есть только в EXIF, поэтому VP8X в таком файле уже есть
+	if keepOrientation {
+		out = appendWebPChunk(out, "EXIF", orientationEXIF(orientation))
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	result.Data = out
+	return result, nil
+}
+
+// appendWebPChunk добавляет чанк RIFF с выравниванием до четной длины
+func appendWebPChunk(out []byte, fourCC string, chunk []byte) []byte {
+	out = append(out, fourCC...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(chunk)))
+	out = append(out, chunk...)
+	if len(chunk)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// orientationEXIF создает TIFF-данные EXIF с единственным тегом ориентации
+func orientationEXIF(orientation int) []byte {
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8) // Смещение первого IFD
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1) // Число записей
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientationTag)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0)
+	return binary.LittleEndian.AppendUint32(tiff, 0) // Следующего IFD нет
+}
+
+// add добавляет вид метаданных без повторов
+func (r *StripResult) add(kind string) {
+	for _, existing := range r.Removed {
+		if existing == kind {
+			return
+		}
+	}
+	r.Removed = append(r.Removed, kind)
+}
+
+func isJPEG(data []byte) bool {
+	return len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8
+}
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngHeader)
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// walkJPEG перебирает сегменты заголовка JPEG до начала данных (SOS).
+// Возвращает смещение, с которого начинается остаток файла, или ErrMalformed,
+// если заголовок поврежден или обрывается до начала данных
+func walkJPEG(data []byte, fn func(marker byte, segment []byte) bool) (int, error) {
+	pos := 2
+	for pos+2 <= len(data) {
+		if data[pos] != 0xFF {
+			return pos, fmt.Errorf("%w: JPEG marker expected at offset %d", ErrMalformed, pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Заполняющий байт
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			return pos, nil
+		}
+
+		if pos+4 > len(data) {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return pos, fmt.Errorf("%w: JPEG segment %#x at offset %d has invalid length %d", ErrMalformed, marker, pos, length)
+		}
+		if !fn(marker, data[pos+4:pos+2+length]) {
+			return pos, nil
+		}
+		pos += 2 + length
+	}
+	return pos, fmt.Errorf("%w: JPEG header is truncated", ErrMalformed)
+}
+
+// appendJPEGSegment добавляет сегмент JPEG с маркером и длиной
+func appendJPEGSegment(out []byte, marker byte, segment []byte) []byte {
+	out = append(out, 0xFF, marker, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	return append(out, segment...)
+}
+
+// walkPNG перебирает чанки PNG до IEND. Возвращает ErrMalformed, если
+// чанк выходит за пределы файла или файл обрывается до IEND
+func walkPNG(data []byte, fn func(chunkType string, chunk []byte) bool) error {
+	pos := len(pngHeader)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return fmt.Errorf("%w: PNG chunk at offset %d has invalid length %d", ErrMalformed, pos, length)
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		if !fn(chunkType, data[pos+8:pos+8+length]) || chunkType == "IEND" {
+			return nil
+		}
+		pos += 12 + length
+	}
+	return fmt.Errorf("%w: PNG ends before IEND", ErrMalformed)
+}
+
+// appendPNGChunk добавляет чанк PNG с пересчитанной контрольной суммой
+func appendPNGChunk(out []byte, chunkType string, chunk []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(chunk)))
+	start := len(out)
+	out = append(out, chunkType...)
+	out = append(out, chunk...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
+
+// walkWebP перебирает чанки контейнера RIFF/WebP. Возвращает ErrMalformed,
+// если чанк выходит за пределы файла
+func walkWebP(data []byte, fn func(fourCC string, chunk []byte) bool) error {
+	pos := 12
+	for pos+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if length < 0 || pos+8+length > len(data) {
+			return fmt.Errorf("%w: WebP chunk at offset %d has invalid length %d", ErrMalformed, pos, length)
+		}
+		if !fn(string(data[pos:pos+4]), data[pos+8:pos+8+length]) {
+			return nil
+		}
+		pos += 8 + length + length%2
+	}
+	if pos < len(data) {
+		return fmt.Errorf("%w: WebP has %d trailing bytes", ErrMalformed, len(data)-pos)
+	}
+	return nil
+}
+
+// colorSpace возвращает цветовое пространство ICC (как в заголовке профиля),
+// в котором кодировщик сохранит изображение
+func colorSpace(img image.Image) string {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return "GRAY"
+	}
+	return "RGB "
+}
+
+// profileSpace возвращает цветовое пространство ICC-профиля
+func profileSpace(profile []byte) string {
+	if len(profile) < 20 {
+		return ""
+	}
+	return string(profile[16:20])
+}
+
+// insertJPEGProfile переносит ICC-профиль (сегменты APP2) из исходного JPEG
+// в перекодированный, если пространство профиля совпадает с пространством
+// результата. Профили CMYK не переносятся: пиксели перекодируются в RGB
+func insertJPEGProfile(encoded, original []byte, space string) ([]byte, error) {
+	var segments [][]byte
+	var profile []byte
+	_, err := walkJPEG(original, func(marker byte, segment []byte) bool {
+		if marker == 0xE2 && bytes.HasPrefix(segment, iccHeader) && len(segment) > len(iccHeader)+2 {
+			segments = append(segments, segment)
+			profile = append(profile, segment[len(iccHeader)+2:]...)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 || profileSpace(profile) != space {
+		return encoded, nil
+	}
+
+	// Сегменты вставляются сразу после SOI
+	out := make([]byte, 0, len(encoded)+len(profile)+len(segments)*(len(iccHeader)+6))
+	out = append(out, encoded[:2]...)
+	for _, segment := range segments {
+		out = appendJPEGSegment(out, 0xE2, segment)
+	}
+	return append(out, encoded[2:]...), nil
+}
+
+// insertPNGColor переносит чанки, влияющие на цвета (iCCP, sRGB, gAMA, cHRM),
+// из исходного PNG в перекодированный. iCCP переносится, только если
+// пространство профиля совпадает с пространством результата
+func insertPNGColor(encoded, original []byte, space string) ([]byte, error) {
+	var chunks [][2]string
+	err := walkPNG(original, func(chunkType string, chunk []byte) bool {
+		switch chunkType {
+		case "iCCP":
+			if iccpSpace(chunk) == space {
+				chunks = append(chunks, [2]string{chunkType, string(chunk)})
+			}
+		case "sRGB", "gAMA", "cHRM":
+			chunks = append(chunks, [2]string{chunkType, string(chunk)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return encoded, nil
+	}
+
+	// Чанки цвета должны предшествовать PLTE и IDAT, поэтому вставляются после IHDR
+	out := make([]byte, 0, len(encoded))
+	out = append(out, pngHeader...)
+	err = walkPNG(encoded, func(chunkType string, chunk []byte) bool {
+		out = appendPNGChunk(out, chunkType, chunk)
+		if chunkType == "IHDR" {
+			for _, c := range chunks {
+				out = appendPNGChunk(out, c[0], []byte(c[1]))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// iccpSpace возвращает цветовое пространство сжатого профиля из чанка iCCP
+func iccpSpace(chunk []byte) string {
+	// Имя профиля, нулевой байт и метод сжатия
+	i := bytes.IndexByte(chunk, 0)
+	if i < 0 || i+2 > len(chunk) {
+		return ""
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(chunk[i+2:]))
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return ""
+	}
+	return profileSpace(header)
+}
@@ -0,0 +1,301 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifSegment возвращает EXIF с ориентацией и посторонними данными, как у фото с GPS
+func exifSegment(orientation int) []byte {
+	return append(orientationEXIF(orientation), "GPS 55.7558 37.6173"...)
+}
+
+// testWebP собирает контейнер WebP с заданными чанками после VP8X
+func testWebP(flags byte, chunks ...[2]string) []byte {
+	out := []byte("RIFF\x00\x00\x00\x00WEBP")
+	out = appendWebPChunk(out, "VP8X", []byte{flags, 0, 0, 0, 1, 0, 0, 1, 0, 0})
+	for _, chunk := range chunks {
+		out = appendWebPChunk(out, chunk[0], []byte(chunk[1]))
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out
+}
+
+func TestStripWebPKeepsOrientation(t *testing.T) {
+	data := testWebP(0x08|0x04,
+		[2]string{"VP8L", "pixels"},
+		[2]string{"EXIF", string(exifSegment(6))},
+		[2]string{"XMP ", "<x:xmpmeta/>"},
+	)
+
+	result, err := StripMetadata(data)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if bytes.Contains(result.Data, []byte("GPS")) || bytes.Contains(result.Data, []byte("xmpmeta")) {
+		t.Errorf("stripped WebP still contains metadata")
+	}
+	if got := Orientation(result.Data); got != 6 {
+		t.Errorf("Orientation() after strip = %d, want 6", got)
+	}
+	if !bytes.Contains(result.Data, []byte("pixels")) {
+		t.Errorf("stripped WebP lost image data")
+	}
+
+	var flags byte
+	walkWebP(result.Data, func(fourCC string, chunk []byte) bool {
+		if fourCC == "VP8X" {
+			flags = chunk[0]
+		}
+		return true
+	})
+	if flags != 0x08 {
+		t.Errorf("VP8X flags = %#x, want EXIF flag only", flags)
+	}
+	if size := binary.LittleEndian.Uint32(result.Data[4:8]); int(size) != len(result.Data)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(result.Data)-8)
+	}
+}
+
+func TestStripWebPWithoutOrientation(t *testing.T) {
+	data := testWebP(0x08, [2]string{"VP8L", "pixels"}, [2]string{"EXIF", string(exifSegment(1))})
+
+	result, err := StripMetadata(data)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if exifData(result.Data) != nil {
+		t.Errorf("stripped WebP still contains EXIF")
+	}
+}
+
+func TestStripJPEGAppliesOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	segment := append([]byte("Exif\x00\x00"), exifSegment(6)...)
+	data := append([]byte{}, encoded[:2]...)
+	data = append(data, 0xFF, 0xE1, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	data = append(data, segment...)
+	data = append(data, encoded[2:]...)
+
+	result, err := StripMetadata(data)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if !result.Oriented {
+		t.Errorf("Oriented = false, want true")
+	}
+	if bytes.Contains(result.Data, []byte("GPS")) {
+		t.Errorf("stripped JPEG still contains metadata")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(result.Data))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	if cfg.Width != 2 || cfg.Height != 4 {
+		t.Errorf("stripped JPEG is %dx%d, want 2x4", cfg.Width, cfg.Height)
+	}
+}
+
+func TestStripUnsupported(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("GIF89a"), []byte("RIFF\x00\x00")} {
+		if _, err := StripMetadata(data); err != ErrUnsupported {
+			t.Errorf("StripMetadata(%q) error = %v, want ErrUnsupported", data, err)
+		}
+	}
+}
+
+// testJPEG кодирует JPEG 4x2 и вставляет сегменты после SOI
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	data := append([]byte{}, encoded[:2]...)
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, encoded[2:]...)
+}
+
+// jpegSegment формирует сегмент JPEG с маркером и длиной
+func jpegSegment(marker byte, payload []byte) []byte {
+	return appendJPEGSegment(nil, marker, payload)
+}
+
+// iccProfile возвращает условный ICC-профиль указанного цветового пространства
+func iccProfile(space string) []byte {
+	profile := make([]byte, 128)
+	copy(profile[16:], space)
+	copy(profile[36:], "acsp")
+	return profile
+}
+
+// iccSegment возвращает APP2 с профилем в одном сегменте
+func iccSegment(profile []byte) []byte {
+	payload := append(append([]byte{}, iccHeader...), 1, 1)
+	return jpegSegment(0xE2, append(payload, profile...))
+}
+
+func TestStripMalformed(t *testing.T) {
+	exif := jpegSegment(0xE1, append([]byte("Exif\x00\x00"), exifSegment(1)...))
+	valid := testJPEG(t, exif)
+
+	// Сегмент с длиной за пределами файла
+	badLength := append([]byte{0xFF, 0xD8}, exif...)
+	badLength = append(badLength, 0xFF, 0xE1, 0xFF, 0xF0, 'G', 'P', 'S')
+
+	// Мусор вместо маркера после EXIF
+	badMarker := append([]byte{0xFF, 0xD8}, exif...)
+	badMarker = append(badMarker, 0x00, 0x01, 0x02, 0x03)
+
+	png := appendPNGChunk(append([]byte{}, pngHeader...), "IHDR", make([]byte, 13))
+	png = appendPNGChunk(png, "tEXt", []byte("GPS\x0055.7558"))
+	pngBadChunk := append(append([]byte{}, png...), 0x00, 0x10, 0x00, 0x00, 'I', 'D', 'A', 'T')
+	pngNoEnd := append([]byte{}, png...)
+
+	webp := testWebP(0x08, [2]string{"VP8L", "pixels"})
+	webpBadChunk := append(append([]byte{}, webp...), "EXIF\xFF\xFF\x00\x00GPS"...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"JPEG segment length", badLength},
+		{"JPEG missing marker", badMarker},
+		{"JPEG truncated header", valid[:len(exif)+2]},
+		{"PNG chunk length", pngBadChunk},
+		{"PNG without IEND", pngNoEnd},
+		{"WebP chunk length", webpBadChunk},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := StripMetadata(tt.data)
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("StripMetadata() = %v, %v, want ErrMalformed", result, err)
+			}
+		})
+	}
+}
+
+func TestStripJPEGOrientationKeepsICC(t *testing.T) {
+	exif := jpegSegment(0xE1, append([]byte("Exif\x00\x00"), exifSegment(6)...))
+
+	tests := []struct {
+		name     string
+		space    string
+		wantICC  bool
+		wantSize string
+	}{
+		{"RGB profile", "RGB ", true, "2x4"},
+		{"CMYK profile", "CMYK", false, "2x4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := iccProfile(tt.space)
+			data := testJPEG(t, exif, iccSegment(profile))
+
+			result, err := StripMetadata(data)
+			if err != nil {
+				t.Fatalf("StripMetadata() error = %v", err)
+			}
+			if !result.Oriented {
+				t.Fatalf("Oriented = false, want true")
+			}
+
+			var found []byte
+			if _, err := walkJPEG(result.Data, func(marker byte, segment []byte) bool {
+				if marker == 0xE2 && bytes.HasPrefix(segment, iccHeader) {
+					found = segment[len(iccHeader)+2:]
+				}
+				return true
+			}); err != nil {
+				t.Fatalf("walkJPEG() error = %v", err)
+			}
+			if tt.wantICC != bytes.Equal(found, profile) {
+				t.Errorf("ICC profile kept = %v, want %v", found != nil, tt.wantICC)
+			}
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(result.Data))
+			if err != nil {
+				t.Fatalf("DecodeConfig() error = %v", err)
+			}
+			if got := fmt.Sprintf("%dx%d", cfg.Width, cfg.Height); got != tt.wantSize {
+				t.Errorf("stripped JPEG is %s, want %s", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestStripPNGOrientationKeepsColorChunks(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(iccProfile("RGB "))
+	zw.Close()
+	iccp := append([]byte("profile\x00\x00"), compressed.Bytes()...)
+
+	// eXIf и iCCP вставляются после IHDR
+	data := append([]byte{}, pngHeader...)
+	if err := walkPNG(buf.Bytes(), func(chunkType string, chunk []byte) bool {
+		data = appendPNGChunk(data, chunkType, chunk)
+		if chunkType == "IHDR" {
+			data = appendPNGChunk(data, "iCCP", iccp)
+			data = appendPNGChunk(data, "gAMA", []byte{0, 0, 0xB1, 0x8F})
+			data = appendPNGChunk(data, "eXIf", exifSegment(6))
+		}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := StripMetadata(data)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if !result.Oriented {
+		t.Fatalf("Oriented = false, want true")
+	}
+
+	chunks := map[string][]byte{}
+	if err := walkPNG(result.Data, func(chunkType string, chunk []byte) bool {
+		chunks[chunkType] = chunk
+		return true
+	}); err != nil {
+		t.Fatalf("walkPNG() error = %v", err)
+	}
+	if !bytes.Equal(chunks["iCCP"], iccp) || chunks["gAMA"] == nil {
+		t.Errorf("color chunks were not kept: %v", chunks)
+	}
+	if chunks["eXIf"] != nil {
+		t.Errorf("stripped PNG still contains EXIF")
+	}
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(result.Data))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	if cfg.Width != 2 || cfg.Height != 4 {
+		t.Errorf("stripped PNG is %dx%d, want 2x4", cfg.Width, cfg.Height)
+	}
+}
@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Режимы вписывания изображения в заданные размеры
+const (
+	FitContain = "contain" // Вписать целиком с сохранением пропорций
+	FitCover   = "cover"   // Заполнить с обрезкой по центру
+	FitFill    = "fill"    // Растянуть без сохранения пропорций
+)
+
+// Options параметры преобразования. Нулевая ширина или высота вычисляется
+// по пропорциям исходного изображения
+type Options struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// Validate проверяет параметры и ограничение на размеры результата
+func (o Options) Validate(maxDimension int) error {
+	if o.Width < 0 || o.Height < 0 {
+		return fmt.Errorf("width and height must be positive")
+	}
+	if o.Width == 0 && o.Height == 0 {
+		return fmt.Errorf("width or height is required")
+	}
+	if o.Width > maxDimension || o.Height > maxDimension {
+		return fmt.Errorf("width and height must not exceed %d", maxDimension)
+	}
+	switch o.Fit {
+	case FitContain, FitCover, FitFill:
+	default:
+		return fmt.Errorf("unknown fit %q", o.Fit)
+	}
+	switch o.Format {
+	case FormatJPEG, FormatPNG:
+	default:
+		return fmt.Errorf("unknown format %q", o.Format)
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	return nil
+}
+
+// MaxOutputPixels ограничение на количество пикселей результата преобразования
+const MaxOutputPixels = 16_000_000
+
+// OutputSize вычисляет размеры результата преобразования изображения
+// srcWidth x srcHeight: недостающая сторона считается по пропорциям, в режиме
+// contain размеры вписываются в заданные. Если результат превышает
+// maxDimension по одной из сторон или MaxOutputPixels, он уменьшается
+// с сохранением пропорций
+func (o Options) OutputSize(srcWidth, srcHeight, maxDimension int) (int, int) {
+	sw, sh := float64(max(1, srcWidth)), float64(max(1, srcHeight))
+	width, height := float64(o.Width), float64(o.Height)
+	if width == 0 {
+		width = sw * height / sh
+	}
+	if height == 0 {
+		height = sh * width / sw
+	}
+
+	if o.Fit != FitCover && o.Fit != FitFill {
+		scale := min(width/sw, height/sh)
+		width, height = sw*scale, sh*scale
+	}
+
+	width, height = max(1, width), max(1, height)
+	scale := min(1, float64(maxDimension)/width, float64(maxDimension)/height)
+	if pixels := width * height * scale * scale; pixels > MaxOutputPixels {
+		scale *= math.Sqrt(MaxOutputPixels / pixels)
+	}
+
+	return max(1, int(width*scale+0.5)), max(1, int(height*scale+0.5))
+}
+
+// Transform масштабирует и обрезает изображение согласно параметрам.
+// Размеры результата ограничены так же, как в OutputSize
+func Transform(img image.Image, opts Options, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := opts.OutputSize(srcWidth, srcHeight, maxDimension)
+
+	if opts.Fit != FitCover {
+		return Resize(img, width, height)
+	}
+
+	// Вырезаем из центра область с пропорциями результата
+	cropWidth, cropHeight := srcWidth, srcWidth*height/width
+	if cropHeight > srcHeight {
+		cropWidth, cropHeight = srcHeight*width/height, srcHeight
+	}
+	x := bounds.Min.X + (srcWidth-cropWidth)/2
+	y := bounds.Min.Y + (srcHeight-cropHeight)/2
+	crop := image.Rect(x, y, x+max(1, cropWidth), y+max(1, cropHeight))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
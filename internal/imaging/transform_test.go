@@ -0,0 +1,49 @@
+package imaging
+
+import (
+	"image"
+	"testing"
+)
+
+func TestOutputSize(t *testing.T) {
+	tests := []struct {
+		name                  string
+		opts                  Options
+		srcWidth, srcHeight   int
+		maxDimension          int
+		wantWidth, wantHeight int
+	}{
+		{"width only", Options{Width: 100, Fit: FitContain}, 400, 200, 2048, 100, 50},
+		{"height only", Options{Height: 100, Fit: FitContain}, 400, 200, 2048, 200, 100},
+		{"contain fits box", Options{Width: 100, Height: 100, Fit: FitContain}, 400, 200, 2048, 100, 50},
+		{"cover uses box", Options{Width: 100, Height: 100, Fit: FitCover}, 400, 200, 2048, 100, 100},
+		{"fill uses box", Options{Width: 100, Height: 30, Fit: FitFill}, 400, 200, 2048, 100, 30},
+		{"derived side clamped", Options{Width: 2048, Fit: FitContain}, 1, 10000, 2048, 1, 2048},
+		{"derived side clamped in fill", Options{Width: 2048, Fit: FitFill}, 1, 10000, 2048, 1, 2048},
+		{"contain upscale clamped", Options{Width: 2048, Height: 2048, Fit: FitContain}, 10, 1, 2048, 2048, 205},
+		{"pixel budget", Options{Width: 8000, Height: 8000, Fit: FitFill}, 100, 100, 10000, 4000, 4000},
+		{"tiny side", Options{Width: 10, Fit: FitContain}, 10000, 1, 2048, 10, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height := tt.opts.OutputSize(tt.srcWidth, tt.srcHeight, tt.maxDimension)
+			if width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("OutputSize() = %dx%d, want %dx%d", width, height, tt.wantWidth, tt.wantHeight)
+			}
+			if width > tt.maxDimension || height > tt.maxDimension || width*height > MaxOutputPixels {
+				t.Errorf("OutputSize() = %dx%d exceeds limits", width, height)
+			}
+		})
+	}
+}
+
+func TestTransformBoundsOutput(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 10000))
+	for _, fit := range []string{FitContain, FitCover, FitFill} {
+		dst := Transform(src, Options{Width: 2048, Fit: fit}, 2048)
+		if b := dst.Bounds(); b.Dx() > 2048 || b.Dy() > 2048 {
+			t.Errorf("Transform(fit=%s) = %dx%d, want at most 2048x2048", fit, b.Dx(), b.Dy())
+		}
+	}
+}
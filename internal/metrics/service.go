@@ -0,0 +1,43 @@
+package metrics
+
+// Направления передачи файлов
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Метрики сервиса
+var (
+	// HTTPRequests количество обработанных запросов по шаблону маршрута, методу и статусу
+	HTTPRequests = Default.NewCounter("file_agent_http_requests_total",
+		"Total number of HTTP requests.", "route", "method", "status")
+
+	// HTTPDuration длительность обработки запросов
+	HTTPDuration = Default.NewHistogram("file_agent_http_request_duration_seconds",
+		"HTTP request latency in seconds.", DefaultBuckets, "route", "method", "status")
+
+	// TransferBytes байты загруженных и отданных файлов
+	TransferBytes = Default.NewCounter("file_agent_transfer_bytes_total",
+		"File bytes received from uploads and sent to downloads.", "direction")
+
+	// TransfersInFlight выполняющиеся загрузки и скачивания
+	TransfersInFlight = Default.NewGauge("file_agent_transfers_in_flight",
+		"Uploads and downloads in progress.", "direction")
+
+	// S3Duration длительность запросов к S3 с учетом повторов
+	S3Duration = Default.NewHistogram("file_agent_s3_request_duration_seconds",
+		"S3 API call latency in seconds, including retries.", DefaultBuckets, "operation")
+
+	// S3Errors ошибки запросов к S3 по операции и коду ошибки
+	S3Errors = Default.NewCounter("file_agent_s3_errors_total",
+		"Failed S3 API calls.", "operation", "code")
+)
+
+// TrackTransfer отмечает начало передачи файла; возвращаемая функция
+// отмечает ее окончание
+func TrackTransfer(direction string) func() {
+	TransfersInFlight.Add(1, direction)
+	return func() {
+		TransfersInFlight.Add(-1, direction)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AuthenticatedUserHeader заголовок, в котором прокси аутентификации
+// передает идентификатор пользователя
+const AuthenticatedUserHeader = "X-Authenticated-User"
+
+type userKey struct{}
+
+type clientIPKey struct{}
+
+// IdentityMiddleware определяет аутентифицированного пользователя и адрес
+// клиента запроса. Заголовок X-Authenticated-User может подставить любой
+// клиент, поэтому он учитывается только на внутреннем порту или если перед
+// сервисом настроены доверенные прокси (trustedProxies > 0), которые сами
+// выставляют заголовок
+func IdentityMiddleware(trustedProxies int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var user string
+			if trustedProxies > 0 || ScopeFromContext(r.Context()) == ScopeInternal {
+				user = strings.TrimSpace(r.Header.Get(AuthenticatedUserHeader))
+			}
+
+			ctx := context.WithValue(r.Context(), userKey{}, user)
+			ctx = context.WithValue(ctx, clientIPKey{}, clientAddress(r, trustedProxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// clientAddress возвращает адрес клиента. Начало X-Forwarded-For задает сам
+// клиент, поэтому адрес берется справа: каждый из trustedProxies доверенных
+// прокси добавляет адрес, с которого к нему пришел запрос, а последний из них
+// виден как адрес соединения. Без доверенных прокси используется адрес
+// соединения
+func clientAddress(r *http.Request, trustedProxies int) string {
+	remote := remoteHost(r)
+	if trustedProxies <= 0 {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	hops = append(hops, remote)
+
+	// Цепочка короче числа прокси: самый дальний известный адрес
+	client := hops[max(len(hops)-1-trustedProxies, 0)]
+	if client == "" {
+		return remote
+	}
+	return client
+}
+
+// remoteHost возвращает адрес соединения без порта
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ClientIP возвращает адрес клиента, определенный IdentityMiddleware, или
+// адрес соединения, если middleware не применялся
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// AuthenticatedUser возвращает аутентифицированного пользователя запроса
+// или пустую строку, если заголовку нельзя доверять
+func AuthenticatedUser(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdentityMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		scope          string
+		trustedProxies int
+		header         string
+		want           string
+	}{
+		{"public without proxies ignores header", ScopePublic, 0, "alice", ""},
+		{"internal scope trusts header", ScopeInternal, 0, "alice", "alice"},
+		{"public behind trusted proxy trusts header", ScopePublic, 1, " alice ", "alice"},
+		{"no header", ScopeInternal, 1, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ScopeMiddleware(tt.scope)(IdentityMiddleware(tt.trustedProxies)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got = AuthenticatedUser(r.Context())
+				})))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set(AuthenticatedUserHeader, tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("AuthenticatedUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwarded      []string
+		want           string
+	}{
+		{"no proxies ignores forwarded", 0, []string{"203.0.113.7"}, "10.0.0.1"},
+		{"one proxy", 1, []string{"198.51.100.2"}, "198.51.100.2"},
+		{"one proxy ignores spoofed hops", 1, []string{"203.0.113.7, 198.51.100.2"}, "198.51.100.2"},
+		{"two proxies", 2, []string{"203.0.113.7, 198.51.100.2, 10.0.0.5"}, "198.51.100.2"},
+		{"multiple headers", 1, []string{"203.0.113.7", "198.51.100.2"}, "198.51.100.2"},
+		{"chain shorter than proxies", 3, []string{"198.51.100.2"}, "198.51.100.2"},
+		{"proxy without header", 1, nil, "10.0.0.1"},
+		{"empty hop", 1, []string{"203.0.113.7, "}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := IdentityMiddleware(tt.trustedProxies)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got = ClientIP(r)
+				}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:54321"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"file-agent/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute метка запросов, для которых не нашлось маршрута (404, 405)
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware учитывает количество и длительность запросов по шаблону
+// маршрута router (а не по фактическому пути, чтобы не плодить серии на
+// каждый файл). Оборачивает роутер целиком, поэтому учитываются и запросы
+// без маршрута - с меткой unmatched
+func MetricsMiddleware(router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := unmatchedRoute
+			var match mux.RouteMatch
+			if router.Match(r, &match) && match.MatchErr == nil && match.Route != nil {
+				if template, err := match.Route.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+
+			next.ServeHTTP(recorder, r)
+
+			status := strconv.Itoa(recorder.status)
+			metrics.HTTPRequests.Inc(route, r.Method, status)
+			metrics.HTTPDuration.Observe(time.Since(start).Seconds(), route, r.Method, status)
+		})
+	}
+}
+
+// statusRecorder запоминает код ответа
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(p)
+}
+
+// Flush поддерживает потоковые ответы (выгрузка метаданных)
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// Области, из которых поступают запросы
+const (
+	ScopePublic   = "public"
+	ScopeInternal = "internal"
+)
+
+type scopeKey struct{}
+
+// ScopeMiddleware помечает запросы областью (public или internal), чтобы
+// обработчики могли применять к ним разные правила
+func ScopeMiddleware(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), scopeKey{}, scope)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ScopeFromContext возвращает область запроса (по умолчанию public)
+func ScopeFromContext(ctx context.Context) string {
+	if scope, ok := ctx.Value(scopeKey{}).(string); ok {
+		return scope
+	}
+	return ScopePublic
+}
@@ -0,0 +1,242 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file-agent/internal/storage"
+)
+
+// Действия правил
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// Машиночитаемые причины отказа
+const (
+	ReasonTypeNotAllowed     = "type_not_allowed"
+	ReasonFileTooLarge       = "file_too_large"
+	ReasonUploaderNotAllowed = "uploader_not_allowed"
+)
+
+// Rule правило политики загрузки. Правило срабатывает, если файл подходит
+// под все заданные в нем условия (пустое условие подходит под любой файл).
+// ContentTypes и Extensions образуют одно условие на тип файла (см. matchType)
+type Rule struct {
+	Name string `json:"name"`
+
+	// Условия
+	Scopes       []string `json:"scopes,omitempty"`        // public, internal
+	ContentTypes []string `json:"content_types,omitempty"` // image/png, image/*
+	Extensions   []string `json:"extensions,omitempty"`    // exe, .msi
+	Uploaders    []string `json:"uploaders,omitempty"`     // аутентифицированный пользователь или anonymous
+	MinSize      int64    `json:"min_size,omitempty"`
+
+	// Действие: allow завершает проверку, deny отклоняет загрузку.
+	// Без действия правило только ограничивает размер (max_size)
+	Action  string `json:"action,omitempty"`
+	MaxSize int64  `json:"max_size,omitempty"`
+}
+
+// Policy набор правил, которые проверяются по порядку
+type Policy struct {
+	Default string `json:"default,omitempty"` // allow (по умолчанию) или deny
+	Rules   []Rule `json:"rules"`
+}
+
+// Upload описывает загружаемый файл
+type Upload struct {
+	Scope       string
+	Filename    string
+	ContentType string
+	Size        int64
+	Uploader    string
+}
+
+// Decision результат проверки политики
+type Decision struct {
+	Allowed bool
+	Status  int    // HTTP статус для отказа (413, 415, 403)
+	Reason  string // Машиночитаемая причина отказа
+	Rule    string // Имя сработавшего правила
+	Message string
+}
+
+// Load загружает политику из JSON-файла
+func Load(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Validate проверяет корректность политики
+func (p *Policy) Validate() error {
+	if p.Default != "" && p.Default != ActionAllow && p.Default != ActionDeny {
+		return fmt.Errorf("invalid default action %q", p.Default)
+	}
+
+	for i, rule := range p.Rules {
+		if rule.Action != "" && rule.Action != ActionAllow && rule.Action != ActionDeny {
+			return fmt.Errorf("rule %d (%s): invalid action %q", i, rule.Name, rule.Action)
+		}
+		if rule.Action == "" && rule.MaxSize <= 0 {
+			return fmt.Errorf("rule %d (%s): either action or max_size is required", i, rule.Name)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate проверяет загрузку по правилам политики. Пустая политика разрешает все
+func (p *Policy) Evaluate(upload Upload) Decision {
+	if p == nil {
+		return Decision{Allowed: true}
+	}
+
+	for _, rule := range p.Rules {
+		if !rule.matches(upload) {
+			continue
+		}
+
+		if rule.MaxSize > 0 && upload.Size > rule.MaxSize {
+			return Decision{
+				Status:  http.StatusRequestEntityTooLarge,
+				Reason:  ReasonFileTooLarge,
+				Rule:    rule.Name,
+				Message: fmt.Sprintf("File size (%d bytes) exceeds limit of rule %q (%d bytes)", upload.Size, rule.Name, rule.MaxSize),
+			}
+		}
+
+		switch rule.Action {
+		case ActionAllow:
+			return Decision{Allowed: true, Rule: rule.Name}
+		case ActionDeny:
+			return rule.deny(upload)
+		}
+	}
+
+	if p.Default == ActionDeny {
+		return Decision{
+			Status:  http.StatusUnsupportedMediaType,
+			Reason:  ReasonTypeNotAllowed,
+			Message: fmt.Sprintf("Files of type %s are not allowed", upload.ContentType),
+		}
+	}
+
+	return Decision{Allowed: true}
+}
+
+// deny формирует отказ в зависимости от условий правила
+func (r Rule) deny(upload Upload) Decision {
+	if len(r.ContentTypes) == 0 && len(r.Extensions) == 0 && len(r.Uploaders) > 0 {
+		return Decision{
+			Status:  http.StatusForbidden,
+			Reason:  ReasonUploaderNotAllowed,
+			Rule:    r.Name,
+			Message: fmt.Sprintf("Uploads from %q are not allowed", upload.Uploader),
+		}
+	}
+
+	return Decision{
+		Status:  http.StatusUnsupportedMediaType,
+		Reason:  ReasonTypeNotAllowed,
+		Rule:    r.Name,
+		Message: fmt.Sprintf("File %q of type %s is not allowed", upload.Filename, upload.ContentType),
+	}
+}
+
+// matches проверяет, подходит ли загрузка под условия правила
+func (r Rule) matches(upload Upload) bool {
+	if len(r.Scopes) > 0 && !containsFold(r.Scopes, upload.Scope) {
+		return false
+	}
+
+	if (len(r.ContentTypes) > 0 || len(r.Extensions) > 0) && !r.matchType(upload) {
+		return false
+	}
+
+	if len(r.Uploaders) > 0 && !containsFold(r.Uploaders, upload.Uploader) {
+		return false
+	}
+
+	return upload.Size >= r.MinSize
+}
+
+// matchType проверяет условие на тип файла. Запрещающим правилам и лимитам
+// достаточно совпадения MIME-типа или расширения, чтобы переименованный файл
+// не обходил их. Разрешающее правило требует совпадения MIME-типа, определенного
+// по содержимому, и расширения, если заданы оба списка. Правило только
+// с расширениями разрешает файл, если содержимое соответствует расширению
+func (r Rule) matchType(upload Upload) bool {
+	byType := matchContentType(r.ContentTypes, upload.ContentType)
+	byExt := matchExtension(r.Extensions, upload.Filename)
+
+	if r.Action != ActionAllow {
+		return byType || byExt
+	}
+
+	switch {
+	case len(r.ContentTypes) > 0 && len(r.Extensions) > 0:
+		return byType && byExt
+	case len(r.ContentTypes) > 0:
+		return byType
+	default:
+		return byExt && storage.GetContentType(upload.Filename) == upload.ContentType
+	}
+}
+
+// matchContentType сравнивает тип с шаблонами вида image/png, image/* или *
+func matchContentType(patterns []string, contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" || pattern == "*/*" || pattern == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExtension сравнивает расширение имени файла со списком (exe или .exe)
+func matchExtension(extensions []string, filename string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if ext == "" {
+		return false
+	}
+	for _, want := range extensions {
+		if strings.EqualFold(strings.TrimPrefix(want, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold проверяет наличие значения в списке без учета регистра
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"net/http"
+	"testing"
+)
+
+const exeType = "application/vnd.microsoft.portable-executable"
+
+func TestEvaluate(t *testing.T) {
+	denyExecutables := Rule{
+		Name:         "no-executables",
+		Scopes:       []string{"public"},
+		ContentTypes: []string{exeType},
+		Extensions:   []string{"exe"},
+		Action:       ActionDeny,
+	}
+	allowImages := Rule{Name: "images", ContentTypes: []string{"image/*"}, Action: ActionAllow}
+	allowJPEG := Rule{Name: "jpeg", Extensions: []string{".JPG"}, Action: ActionAllow}
+	allowPDF := Rule{Name: "pdf", ContentTypes: []string{"application/pdf"}, Extensions: []string{"pdf"}, Action: ActionAllow}
+	imageLimit := Rule{Name: "images-1kb", ContentTypes: []string{"image/*"}, MaxSize: 1024}
+	denyGuest := Rule{Name: "no-guest", Uploaders: []string{"Guest"}, Action: ActionDeny}
+
+	tests := []struct {
+		name       string
+		policy     *Policy
+		upload     Upload
+		wantStatus int // 0 - загрузка разрешена
+		wantRule   string
+	}{
+		{
+			name:   "nil policy allows",
+			upload: Upload{Filename: "a.exe", ContentType: exeType},
+		},
+		{
+			name:       "deny by content type",
+			policy:     &Policy{Rules: []Rule{denyExecutables}},
+			upload:     Upload{Scope: "public", Filename: "setup.bin", ContentType: exeType},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantRule:   "no-executables",
+		},
+		{
+			name:       "deny by extension",
+			policy:     &Policy{Rules: []Rule{denyExecutables}},
+			upload:     Upload{Scope: "public", Filename: "setup.exe", ContentType: "application/octet-stream"},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantRule:   "no-executables",
+		},
+		{
+			name:   "deny limited to scope",
+			policy: &Policy{Rules: []Rule{denyExecutables}},
+			upload: Upload{Scope: "internal", Filename: "setup.exe", ContentType: exeType},
+		},
+		{
+			name:     "first matching rule wins: allow before deny",
+			policy:   &Policy{Rules: []Rule{allowImages, {Name: "deny-all", Action: ActionDeny}}},
+			upload:   Upload{Filename: "a.png", ContentType: "image/png"},
+			wantRule: "images",
+		},
+		{
+			name:       "first matching rule wins: deny before allow",
+			policy:     &Policy{Rules: []Rule{denyExecutables, {Name: "allow-all", Action: ActionAllow}}},
+			upload:     Upload{Scope: "PUBLIC", Filename: "a.exe", ContentType: exeType},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantRule:   "no-executables",
+		},
+		{
+			name:       "renamed executable does not match allow by extension",
+			policy:     &Policy{Default: ActionDeny, Rules: []Rule{allowJPEG}},
+			upload:     Upload{Filename: "photo.jpg", ContentType: exeType},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "jpeg matches allow by extension",
+			policy:   &Policy{Default: ActionDeny, Rules: []Rule{allowJPEG}},
+			upload:   Upload{Filename: "photo.jpg", ContentType: "image/jpeg"},
+			wantRule: "jpeg",
+		},
+		{
+			name:       "renamed executable does not match allow by type",
+			policy:     &Policy{Default: ActionDeny, Rules: []Rule{allowImages}},
+			upload:     Upload{Filename: "photo.png", ContentType: exeType},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "allow with both lists requires extension",
+			policy:     &Policy{Default: ActionDeny, Rules: []Rule{allowPDF}},
+			upload:     Upload{Filename: "report.html", ContentType: "application/pdf"},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "allow with both lists requires type",
+			policy:     &Policy{Default: ActionDeny, Rules: []Rule{allowPDF}},
+			upload:     Upload{Filename: "report.pdf", ContentType: "text/html"},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "allow with both lists",
+			policy:   &Policy{Default: ActionDeny, Rules: []Rule{allowPDF}},
+			upload:   Upload{Filename: "report.pdf", ContentType: "application/pdf"},
+			wantRule: "pdf",
+		},
+		{
+			name:       "size limit before allow",
+			policy:     &Policy{Rules: []Rule{imageLimit, allowImages}},
+			upload:     Upload{Filename: "a.png", ContentType: "image/png", Size: 2048},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantRule:   "images-1kb",
+		},
+		{
+			name:       "size limit matches renamed file",
+			policy:     &Policy{Rules: []Rule{{Name: "png-1kb", Extensions: []string{"png"}, MaxSize: 1024}}},
+			upload:     Upload{Filename: "a.png", ContentType: exeType, Size: 2048},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantRule:   "png-1kb",
+		},
+		{
+			name:     "size limit passes to next rule",
+			policy:   &Policy{Default: ActionDeny, Rules: []Rule{imageLimit, allowImages}},
+			upload:   Upload{Filename: "a.png", ContentType: "image/png", Size: 512},
+			wantRule: "images",
+		},
+		{
+			name:       "deny uploader",
+			policy:     &Policy{Rules: []Rule{denyGuest}},
+			upload:     Upload{Filename: "a.txt", ContentType: "text/plain", Uploader: "guest"},
+			wantStatus: http.StatusForbidden,
+			wantRule:   "no-guest",
+		},
+		{
+			name:   "other uploader",
+			policy: &Policy{Rules: []Rule{denyGuest}},
+			upload: Upload{Filename: "a.txt", ContentType: "text/plain", Uploader: "alice"},
+		},
+		{
+			name:   "min size",
+			policy: &Policy{Rules: []Rule{{Name: "large", MinSize: 100, Action: ActionDeny}}},
+			upload: Upload{Filename: "a.txt", ContentType: "text/plain", Size: 99},
+		},
+		{
+			name:       "default deny",
+			policy:     &Policy{Default: ActionDeny, Rules: []Rule{allowImages}},
+			upload:     Upload{Filename: "a.txt", ContentType: "text/plain"},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := tt.policy.Evaluate(tt.upload)
+			if decision.Allowed != (tt.wantStatus == 0) || decision.Status != tt.wantStatus {
+				t.Errorf("Evaluate() = allowed %v, status %d, want status %d", decision.Allowed, decision.Status, tt.wantStatus)
+			}
+			if decision.Rule != tt.wantRule {
+				t.Errorf("Evaluate() rule = %q, want %q", decision.Rule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"empty", Policy{}, false},
+		{"valid", Policy{Default: ActionDeny, Rules: []Rule{{Action: ActionAllow}, {MaxSize: 1}}}, false},
+		{"invalid default", Policy{Default: "block"}, true},
+		{"invalid action", Policy{Rules: []Rule{{Action: "block"}}}, true},
+		{"rule without effect", Policy{Rules: []Rule{{Name: "noop"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); tt.wantErr != (err != nil) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxObjectKeys сколько ключей объекта показывается
+	maxObjectKeys = 100
+	// maxStringLength максимальная длина строкового значения в символах
+	maxStringLength = 200
+	// maxOutput ограничение на размер текста предпросмотра
+	maxOutput = 256 << 10
+	// truncationMarker обозначает пропущенные данные
+	truncationMarker = "…"
+)
+
+var (
+	// errTruncated прекращает разбор, когда предпросмотр заполнен
+	errTruncated = errors.New("preview truncated")
+	// errSkip пропускает оставшиеся элементы вложенного массива или объекта
+	errSkip = errors.New("skip container")
+)
+
+// frame открытый массив или объект
+type frame struct {
+	object    bool
+	count     int
+	expectKey bool
+}
+
+// printer печатает JSON с отступами по потоку токенов, не загружая
+// документ целиком. Массивы ограничиваются items элементами, объекты -
+// maxObjectKeys ключами. Лишние элементы вложенных контейнеров пропускаются,
+// а при заполнении контейнера верхнего уровня печать прекращается и открытые
+// скобки закрываются
+type printer struct {
+	out      bytes.Buffer
+	stack    []frame
+	items    int
+	topCount int  // Количество напечатанных элементов массива верхнего уровня
+	skipped  bool // Часть вложенных элементов пропущена
+}
+
+// buildJSON строит предпросмотр JSON-документа
+func buildJSON(reader *bufio.Reader, opts Options) (*Result, error) {
+	p := &printer{items: opts.Rows}
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+
+	err := p.value(decoder)
+	result := &Result{Format: FormatJSON, Records: 1}
+	switch {
+	case err == nil:
+	case errors.Is(err, errTruncated) || p.out.Len() > 0:
+		// Ограничение предпросмотра или обрыв на границе прочитанного объема
+		p.closeAll()
+		result.Truncated = true
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	result.Preview = p.out.String()
+	result.Truncated = result.Truncated || p.skipped
+	if strings.HasPrefix(result.Preview, "[") {
+		result.Records = p.topCount
+	}
+	return result, nil
+}
+
+// buildNDJSON строит предпросмотр первых записей NDJSON в виде массива
+func buildNDJSON(reader *bufio.Reader, opts Options) (*Result, error) {
+	p := &printer{items: opts.Rows}
+	p.open(false)
+
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+
+	result := &Result{Format: FormatNDJSON}
+	for {
+		if p.stack[0].count == opts.Rows {
+			// Проверяем, есть ли следующая запись
+			if decoder.More() {
+				result.Truncated = true
+			}
+			break
+		}
+		if !decoder.More() {
+			break
+		}
+		if err := p.value(decoder); err != nil {
+			if !errors.Is(err, errTruncated) && p.stack[0].count == 0 {
+				return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+			}
+			result.Truncated = true
+			break
+		}
+	}
+
+	result.Records = p.stack[0].count
+	if result.Truncated {
+		// Есть следующие записи или последняя запись оборвана
+		p.closeAll()
+	} else {
+		p.close()
+	}
+	result.Truncated = result.Truncated || p.skipped
+	result.Preview = p.out.String()
+	return result, nil
+}
+
+// value печатает одно значение (со всеми вложенными)
+func (p *printer) value(decoder *json.Decoder) error {
+	depth := len(p.stack)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			p.close()
+		} else if err := p.token(token); errors.Is(err, errSkip) {
+			if err := p.skipRest(decoder, token); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if len(p.stack) == depth {
+			return nil
+		}
+		if p.out.Len() > maxOutput {
+			return errTruncated
+		}
+	}
+}
+
+// token печатает открывающую скобку, ключ или скалярное значение
+func (p *printer) token(token json.Token) error {
+	if n := len(p.stack); n > 0 && p.stack[n-1].object && p.stack[n-1].expectKey {
+		key, _ := token.(string)
+		if err := p.item(); err != nil {
+			return err
+		}
+		p.writeString(key)
+		p.out.WriteString(": ")
+		p.stack[n-1].expectKey = false
+		return nil
+	}
+
+	if err := p.item(); err != nil {
+		return err
+	}
+
+	switch v := token.(type) {
+	case json.Delim:
+		p.open(v == '{')
+		return nil
+	case string:
+		p.writeString(truncateString(v))
+	case json.Number:
+		p.out.WriteString(v.String())
+	case bool:
+		fmt.Fprint(&p.out, v)
+	case nil:
+		p.out.WriteString("null")
+	}
+	p.valueDone()
+	return nil
+}
+
+// item начинает новый элемент массива или ключ объекта. Для значения после
+// ключа ничего не печатается
+func (p *printer) item() error {
+	n := len(p.stack)
+	if n == 0 {
+		return nil
+	}
+	top := &p.stack[n-1]
+	if top.object && !top.expectKey {
+		return nil
+	}
+
+	limit := p.items
+	if top.object {
+		limit = maxObjectKeys
+	}
+	if top.count == limit {
+		if n == 1 {
+			return errTruncated
+		}
+		return errSkip
+	}
+
+	if top.count > 0 {
+		p.out.WriteByte(',')
+	}
+	p.newline(n)
+	top.count++
+	return nil
+}
+
+// open открывает массив или объект
+func (p *printer) open(object bool) {
+	if object {
+		p.out.WriteByte('{')
+	} else {
+		p.out.WriteByte('[')
+	}
+	p.stack = append(p.stack, frame{object: object, expectKey: object})
+}
+
+// close закрывает текущий массив или объект
+func (p *printer) close() {
+	n := len(p.stack)
+	top := p.stack[n-1]
+	p.stack = p.stack[:n-1]
+	if n == 1 && !top.object && p.topCount == 0 {
+		p.topCount = top.count
+	}
+
+	if top.count > 0 {
+		p.newline(n - 1)
+	}
+	if top.object {
+		p.out.WriteByte('}')
+	} else {
+		p.out.WriteByte(']')
+	}
+	p.valueDone()
+}
+
+// skipRest пропускает оставшиеся элементы текущего контейнера, начиная с
+// уже прочитанного токена, и закрывает контейнер с отметкой о пропуске
+func (p *printer) skipRest(decoder *json.Decoder, token json.Token) error {
+	depth := 0
+	if delim, ok := token.(json.Delim); ok && (delim == '{' || delim == '[') {
+		depth = 1
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			if depth == 0 {
+				p.skipped = true
+				p.mark()
+				p.close()
+				return nil
+			}
+			depth--
+		}
+	}
+}
+
+// closeAll закрывает все открытые скобки, отмечая пропуск данных
+func (p *printer) closeAll() {
+	for len(p.stack) > 0 {
+		p.mark()
+		p.close()
+	}
+}
+
+// mark добавляет в текущий контейнер отметку о пропущенных данных
+func (p *printer) mark() {
+	n := len(p.stack)
+	top := &p.stack[n-1]
+	if top.object && !top.expectKey {
+		// Оборван после ключа
+		p.writeString(truncationMarker)
+		top.expectKey = true
+		return
+	}
+
+	if n == 1 && !top.object {
+		p.topCount = top.count
+	}
+	if top.count > 0 {
+		p.out.WriteByte(',')
+	}
+	p.newline(n)
+	p.writeString(truncationMarker)
+	if top.object {
+		p.out.WriteString(": ")
+		p.writeString(truncationMarker)
+	}
+	top.count++
+}
+
+// valueDone отмечает, что значение после ключа объекта напечатано
+func (p *printer) valueDone() {
+	if n := len(p.stack); n > 0 && p.stack[n-1].object {
+		p.stack[n-1].expectKey = true
+	}
+}
+
+// newline переводит строку с отступом
+func (p *printer) newline(depth int) {
+	p.out.WriteByte('\n')
+	p.out.WriteString(strings.Repeat("  ", depth))
+}
+
+// writeString печатает строку в JSON-формате
+func (p *printer) writeString(s string) {
+	data, _ := json.Marshal(s)
+	p.out.Write(data)
+}
+
+// truncateString обрезает длинную строку
+func truncateString(s string) string {
+	if utf8.RuneCountInString(s) <= maxStringLength {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxStringLength]) + truncationMarker
+}
@@ -0,0 +1,189 @@
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Форматы предпросмотра
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+const (
+	// DefaultRows количество строк (элементов) по умолчанию
+	DefaultRows = 20
+	// MaxRows максимальное количество строк (элементов)
+	MaxRows = 1000
+	// MaxInput сколько байт файла может быть прочитано для предпросмотра
+	MaxInput = 8 << 20
+)
+
+// ErrInvalid возвращается, если начало файла не удалось разобрать
+var ErrInvalid = errors.New("invalid data")
+
+// Result результат предпросмотра
+type Result struct {
+	Format    string     `json:"format"`
+	Delimiter string     `json:"delimiter,omitempty"`
+	Header    []string   `json:"header,omitempty"`
+	Rows      [][]string `json:"rows,omitempty"`
+	Preview   string     `json:"preview,omitempty"`
+	Records   int        `json:"records"`
+	Truncated bool       `json:"truncated"`
+}
+
+// Format возвращает формат предпросмотра по MIME-типу или пустую строку
+func Format(contentType string) string {
+	switch contentType {
+	case "text/csv", "text/tab-separated-values":
+		return FormatCSV
+	case "application/json":
+		return FormatJSON
+	case "application/x-ndjson":
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// Options параметры предпросмотра
+type Options struct {
+	Rows      int  // Количество строк или элементов
+	Delimiter rune // Разделитель CSV; 0 - определить автоматически
+}
+
+// Build читает начало файла и строит предпросмотр. Читается только то,
+// что нужно для первых строк, но не больше MaxInput байт
+func Build(r io.Reader, format string, opts Options) (*Result, error) {
+	if opts.Rows <= 0 {
+		opts.Rows = DefaultRows
+	}
+	opts.Rows = min(opts.Rows, MaxRows)
+
+	reader := bufio.NewReaderSize(io.LimitReader(r, MaxInput), 64<<10)
+	skipBOM(reader)
+
+	switch format {
+	case FormatCSV:
+		return buildCSV(reader, opts)
+	case FormatJSON:
+		return buildJSON(reader, opts)
+	case FormatNDJSON:
+		return buildNDJSON(reader, opts)
+	}
+	return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalid, format)
+}
+
+// buildCSV возвращает заголовок и первые строки CSV/TSV
+func buildCSV(reader *bufio.Reader, opts Options) (*Result, error) {
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		sample, _ := reader.Peek(64 << 10)
+		delimiter = DetectDelimiter(sample)
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = delimiter
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	csvReader.ReuseRecord = false
+
+	result := &Result{Format: FormatCSV, Delimiter: string(delimiter), Rows: [][]string{}}
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	result.Header = header
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Обрыв на границе прочитанного объема
+			result.Truncated = true
+			break
+		}
+		if len(result.Rows) == opts.Rows {
+			result.Truncated = true
+			break
+		}
+		result.Rows = append(result.Rows, record)
+	}
+
+	result.Records = len(result.Rows)
+	return result, nil
+}
+
+// delimiterCandidates разделители, которые проверяются при определении
+var delimiterCandidates = []rune{',', ';', '\t', '|'}
+
+// DetectDelimiter определяет разделитель CSV по первым строкам: выбирается
+// символ, который встречается во всех строках одинаковое число раз
+func DetectDelimiter(sample []byte) rune {
+	lines := strings.Split(strings.ReplaceAll(string(sample), "\r\n", "\n"), "\n")
+	if len(lines) > 1 {
+		// Последняя строка образца может быть обрезана
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+
+	best, bestScore := ',', 0
+	for _, candidate := range delimiterCandidates {
+		counts := map[int]int{}
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			counts[countOutsideQuotes(line, candidate)]++
+		}
+
+		// Оценка: сколько строк имеют самое частое ненулевое число разделителей
+		score := 0
+		for count, lines := range counts {
+			if count > 0 && lines*100+count > score {
+				score = lines*100 + count
+			}
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// countOutsideQuotes считает символ вне кавычек
+func countOutsideQuotes(line string, c rune) int {
+	count := 0
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == c && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// skipBOM пропускает метку порядка байтов UTF-8
+func skipBOM(reader *bufio.Reader) {
+	if head, err := reader.Peek(3); err == nil && bytes.Equal(head, []byte{0xEF, 0xBB, 0xBF}) {
+		reader.Discard(3)
+	}
+}
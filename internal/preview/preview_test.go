@@ -0,0 +1,237 @@
+package preview
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildCSV(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		opts          Options
+		wantDelimiter string
+		wantHeader    []string
+		wantRows      [][]string
+		wantTruncated bool
+	}{
+		{
+			name:          "comma",
+			input:         "a,b\n1,2\n3,4\n",
+			wantDelimiter: ",",
+			wantHeader:    []string{"a", "b"},
+			wantRows:      [][]string{{"1", "2"}, {"3", "4"}},
+		},
+		{
+			name:          "semicolon with bom",
+			input:         "\xEF\xBB\xBFname;price\nмолоко;\"1,5\"\n",
+			wantDelimiter: ";",
+			wantHeader:    []string{"name", "price"},
+			wantRows:      [][]string{{"молоко", "1,5"}},
+		},
+		{
+			name:          "row limit",
+			input:         "a\tb\n1\t2\n3\t4\n5\t6\n",
+			opts:          Options{Rows: 2},
+			wantDelimiter: "\t",
+			wantHeader:    []string{"a", "b"},
+			wantRows:      [][]string{{"1", "2"}, {"3", "4"}},
+			wantTruncated: true,
+		},
+		{
+			name:          "explicit delimiter",
+			input:         "a|b,c\n1|2,3\n",
+			opts:          Options{Delimiter: ','},
+			wantDelimiter: ",",
+			wantHeader:    []string{"a|b", "c"},
+			wantRows:      [][]string{{"1|2", "3"}},
+		},
+		{
+			name:          "ragged rows",
+			input:         "a,b,c\n1\n2,3,4,5\n",
+			wantDelimiter: ",",
+			wantHeader:    []string{"a", "b", "c"},
+			wantRows:      [][]string{{"1"}, {"2", "3", "4", "5"}},
+		},
+		{
+			// Незакрытая кавычка в режиме LazyQuotes продолжается до конца ввода
+			name:          "unterminated quote",
+			input:         "a,b\n\"1,2\n",
+			wantDelimiter: ",",
+			wantHeader:    []string{"a", "b"},
+			wantRows:      [][]string{{"1,2\n"}},
+		},
+		{name: "empty", input: "", wantDelimiter: ",", wantRows: [][]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Build(strings.NewReader(tt.input), FormatCSV, tt.opts)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result.Delimiter != tt.wantDelimiter {
+				t.Errorf("Delimiter = %q, want %q", result.Delimiter, tt.wantDelimiter)
+			}
+			if !reflect.DeepEqual(result.Header, tt.wantHeader) || !reflect.DeepEqual(result.Rows, tt.wantRows) {
+				t.Errorf("Build() = %q %q, want %q %q", result.Header, result.Rows, tt.wantHeader, tt.wantRows)
+			}
+			if result.Truncated != tt.wantTruncated || result.Records != len(tt.wantRows) {
+				t.Errorf("Truncated = %v, Records = %d, want %v, %d", result.Truncated, result.Records, tt.wantTruncated, len(tt.wantRows))
+			}
+		})
+	}
+}
+
+func TestBuildJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		opts          Options
+		want          string
+		wantRecords   int
+		wantTruncated bool
+		wantErr       bool
+	}{
+		{
+			name:        "object",
+			input:       `{"a": 1, "b": [true, null]}`,
+			want:        "{\n  \"a\": 1,\n  \"b\": [\n    true,\n    null\n  ]\n}",
+			wantRecords: 1,
+		},
+		{
+			name:          "array limit",
+			input:         `[1, 2, 3]`,
+			opts:          Options{Rows: 2},
+			want:          "[\n  1,\n  2,\n  \"…\"\n]",
+			wantRecords:   2,
+			wantTruncated: true,
+		},
+		{
+			name:          "nested array limit",
+			input:         `[[1, 2, 3]]`,
+			opts:          Options{Rows: 2},
+			want:          "[\n  [\n    1,\n    2,\n    \"…\"\n  ]\n]",
+			wantRecords:   1,
+			wantTruncated: true,
+		},
+		{
+			name:          "truncated document",
+			input:         `{"a": [1, 2`,
+			want:          "{\n  \"a\": [\n    1,\n    2,\n    \"…\"\n  ],\n  \"…\": \"…\"\n}",
+			wantRecords:   1,
+			wantTruncated: true,
+		},
+		{
+			name:          "cut after key",
+			input:         `{"a": `,
+			want:          "{\n  \"a\": \"…\"\n}",
+			wantRecords:   1,
+			wantTruncated: true,
+		},
+		{name: "not json", input: `hello`, wantErr: true},
+		{name: "empty", input: ``, wantErr: true},
+		{name: "unbalanced", input: `]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Build(strings.NewReader(tt.input), FormatJSON, tt.opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Build() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result.Preview != tt.want {
+				t.Errorf("Preview = %q, want %q", result.Preview, tt.want)
+			}
+			if result.Records != tt.wantRecords || result.Truncated != tt.wantTruncated {
+				t.Errorf("Records = %d, Truncated = %v, want %d, %v", result.Records, result.Truncated, tt.wantRecords, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestBuildNDJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		opts          Options
+		want          string
+		wantRecords   int
+		wantTruncated bool
+		wantErr       bool
+	}{
+		{
+			name:        "records",
+			input:       "{\"a\":1}\n{\"a\":2}\n",
+			want:        "[\n  {\n    \"a\": 1\n  },\n  {\n    \"a\": 2\n  }\n]",
+			wantRecords: 2,
+		},
+		{
+			name:          "row limit",
+			input:         "1\n2\n3\n",
+			opts:          Options{Rows: 2},
+			want:          "[\n  1,\n  2,\n  \"…\"\n]",
+			wantRecords:   2,
+			wantTruncated: true,
+		},
+		{
+			name:          "broken last record",
+			input:         "1\n{\"a\":",
+			want:          "[\n  1,\n  {\n    \"a\": \"…\"\n  },\n  \"…\"\n]",
+			wantRecords:   2,
+			wantTruncated: true,
+		},
+		{name: "not json", input: "hello\n", wantErr: true},
+		{name: "empty", input: "", want: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Build(strings.NewReader(tt.input), FormatNDJSON, tt.opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Build() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if result.Preview != tt.want {
+				t.Errorf("Preview = %q, want %q", result.Preview, tt.want)
+			}
+			if result.Records != tt.wantRecords || result.Truncated != tt.wantTruncated {
+				t.Errorf("Records = %d, Truncated = %v, want %d, %v", result.Records, result.Truncated, tt.wantRecords, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+// TestBuildTruncated проверяет, что оборванный на любом байте ввод не приводит к панике
+func TestBuildTruncated(t *testing.T) {
+	inputs := map[string]string{
+		FormatJSON:   `{"users": [{"name": "Иван", "tags": ["a", "b"], "age": 30}, {"name": "Ann\"a", "x": null}], "n": -1.5e3}`,
+		FormatNDJSON: "{\"a\": [1, {\"b\": 2}]}\n[1, 2]\n\"str\"\n",
+		FormatCSV:    "a;\"b\"\"c\";d\n1;\"2\n3\";4\n",
+	}
+	for format, input := range inputs {
+		for n := 0; n <= len(input); n++ {
+			Build(strings.NewReader(input[:n]), format, Options{Rows: 1})
+			Build(strings.NewReader(input[:n]), format, Options{})
+		}
+	}
+}
+
+func TestBuildUnsupported(t *testing.T) {
+	if _, err := Build(strings.NewReader("x"), "xml", Options{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Build() error = %v, want ErrInvalid", err)
+	}
+}
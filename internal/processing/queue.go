@@ -0,0 +1,490 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"file-agent/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAttempts количество попыток для одного обработчика
+	maxAttempts = 3
+	// retryDelay задержка перед повторной попыткой
+	retryDelay = 30 * time.Second
+	// processTimeout максимальное время работы одного обработчика
+	processTimeout = 10 * time.Minute
+	// queueSize размер буфера очереди в памяти
+	queueSize = 1024
+	// leaseDuration время, на которое задача закрепляется за экземпляром;
+	// продлевается перед каждым обработчиком
+	leaseDuration = processTimeout + 5*time.Minute
+	// claimSettle пауза перед проверкой захвата задачи
+	claimSettle = time.Second
+)
+
+// errRetryScheduled возвращается, если обработчик будет повторен позже
+var errRetryScheduled = errors.New("retry scheduled")
+
+// Processor обработчик, который выполняется после загрузки файла
+type Processor interface {
+	// Name уникальное имя обработчика, используется в метаданных и состоянии задач
+	Name() string
+	// Supports проверяет, нужно ли обрабатывать файл
+	Supports(file *storage.FileMetadata) bool
+	// Process обрабатывает файл и возвращает данные для метаданных
+	Process(ctx context.Context, file *storage.FileMetadata) (map[string]interface{}, error)
+}
+
+// Job состояние задачи обработки, сохраняется в jobs/{fileID}.json,
+// чтобы работа продолжилась после перезапуска
+type Job struct {
+	FileID    string    `json:"file_id"`
+	Pending   []string  `json:"pending"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Экземпляр сервиса, выполняющий задачу, и срок, до которого другие
+	// экземпляры ее не берут. Если экземпляр остановится, задачу возьмет
+	// другой после истечения срока
+	Owner      string     `json:"owner,omitempty"`
+	LeaseUntil *time.Time `json:"lease_until,omitempty"`
+}
+
+// Queue очередь задач обработки с пулом воркеров
+type Queue struct {
+	store      *storage.S3Storage
+	processors []Processor
+	workers    int
+	jobs       chan string
+	owner      string // Идентификатор экземпляра для аренды задач
+
+	mu      sync.Mutex
+	running map[string]bool // Задачи, выполняющиеся в этом экземпляре
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewQueue создает очередь обработки
+func NewQueue(store *storage.S3Storage, workers int, processors ...Processor) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	hostname, _ := os.Hostname()
+
+	return &Queue{
+		store:      store,
+		processors: processors,
+		workers:    workers,
+		jobs:       make(chan string, queueSize),
+		owner:      hostname + "-" + uuid.New().String()[:8],
+		running:    make(map[string]bool),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Start запускает воркеров и возобновляет незавершенные задачи
+func (q *Queue) Start() error {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+
+	keys, err := q.store.ListKeys(q.ctx, "jobs/")
+	if err != nil {
+		return fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+
+	for _, key := range keys {
+		fileID := strings.TrimSuffix(strings.TrimPrefix(key, "jobs/"), ".json")
+		q.schedule(fileID)
+	}
+
+	if len(keys) > 0 {
+		log.Printf("Resumed %d processing jobs", len(keys))
+	}
+
+	return nil
+}
+
+// Stop останавливает воркеров. Прерванные задачи продолжатся после перезапуска
+func (q *Queue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Plan возвращает имена обработчиков, которые нужно выполнить для файла,
+// и подготавливает для них записи в метаданных
+func (q *Queue) Plan(file *storage.FileMetadata) []string {
+	var names []string
+	for _, p := range q.processors {
+		if !p.Supports(file) {
+			continue
+		}
+		names = append(names, p.Name())
+	}
+
+	if len(names) == 0 {
+		file.Status = storage.StatusReady
+		return nil
+	}
+
+	file.Status = storage.StatusPending
+	file.Processing = make(map[string]*storage.ProcessorResult, len(names))
+	for _, name := range names {
+		file.Processing[name] = &storage.ProcessorResult{Status: storage.StatusPending}
+	}
+
+	return names
+}
+
+// Enqueue сохраняет задачу и ставит ее в очередь
+func (q *Queue) Enqueue(ctx context.Context, fileID string, processors []string) error {
+	if len(processors) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		FileID:    fileID,
+		Pending:   processors,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Owner:     q.owner,
+	}
+
+	if err := q.saveJob(ctx, job); err != nil {
+		return err
+	}
+
+	q.schedule(fileID)
+	return nil
+}
+
+// schedule ставит задачу в очередь без блокировки вызывающего
+func (q *Queue) schedule(fileID string) {
+	select {
+	case q.jobs <- fileID:
+	default:
+		go func() {
+			select {
+			case q.jobs <- fileID:
+			case <-q.ctx.Done():
+			}
+		}()
+	}
+}
+
+// worker обрабатывает задачи из очереди
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case fileID := <-q.jobs:
+			if !q.begin(fileID) {
+				// Задача уже выполняется другим воркером
+				continue
+			}
+			if err := q.runSafe(fileID); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("Processing job for file %s failed: %v", fileID, err)
+			}
+			q.end(fileID)
+		}
+	}
+}
+
+// begin отмечает задачу выполняющейся; false, если она уже выполняется
+func (q *Queue) begin(fileID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running[fileID] {
+		return false
+	}
+	q.running[fileID] = true
+	return true
+}
+
+// end снимает отметку о выполнении задачи
+func (q *Queue) end(fileID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, fileID)
+}
+
+// runSafe выполняет задачу; паника не останавливает сервис, задача
+// повторяется позже
+func (q *Queue) runSafe(fileID string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Processing job for file %s panicked: %v\n%s", fileID, r, debug.Stack())
+			q.retryLater(fileID)
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return q.run(fileID)
+}
+
+// run выполняет оставшиеся обработчики задачи
+func (q *Queue) run(fileID string) error {
+	job, err := q.claim(fileID)
+	if err != nil || job == nil {
+		return err
+	}
+
+	for len(job.Pending) > 0 {
+		name := job.Pending[0]
+
+		processor := q.processor(name)
+		if processor == nil {
+			log.Printf("Unknown processor %s for file %s, skipping", name, fileID)
+			err = q.setResult(fileID, name, &storage.ProcessorResult{Status: storage.StatusFailed, Error: "processor is not configured"})
+		} else {
+			err = q.runProcessor(job, processor)
+		}
+		if err != nil {
+			return q.interrupt(job, err)
+		}
+
+		job.Pending = job.Pending[1:]
+		job.Attempts = 0
+		job.UpdatedAt = time.Now().UTC()
+		if err := q.saveJob(q.ctx, job); err != nil {
+			return q.interrupt(job, err)
+		}
+	}
+
+	// Итоговый статус файла
+	_, err = q.store.UpdateSystemMetadata(q.ctx, fileID, func(m *storage.FileMetadata) error {
+		m.Status = storage.StatusReady
+		for _, result := range m.Processing {
+			if result.Status == storage.StatusFailed {
+				m.Status = storage.StatusFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return q.interrupt(job, err)
+	}
+
+	return q.store.DeleteObject(q.ctx, jobKey(fileID))
+}
+
+// interrupt обрабатывает прерывание задачи: удаляет задачу удаленного файла,
+// освобождает ее при остановке сервиса и откладывает при временных ошибках S3
+func (q *Queue) interrupt(job *Job, err error) error {
+	switch {
+	case errors.Is(err, errRetryScheduled):
+		return nil
+	case errors.Is(err, storage.ErrFileNotFound):
+		// Файл удален - задача больше не нужна
+		return q.store.DeleteObject(q.ctx, jobKey(job.FileID))
+	case q.ctx.Err() != nil:
+		// Остановка сервиса: задача продолжится после перезапуска
+		q.release(job)
+		return nil
+	default:
+		q.retryLater(job.FileID)
+		return err
+	}
+}
+
+// claim загружает задачу и закрепляет ее за экземпляром. Возвращает nil,
+// если задачи нет или ее выполняет другой экземпляр. S3 не поддерживает
+// условную запись, поэтому одновременный захват определяется повторным
+// чтением: задачу выполняет тот, чья запись сохранилась последней
+func (q *Queue) claim(fileID string) (*Job, error) {
+	var job Job
+	if err := q.store.GetJSON(q.ctx, jobKey(fileID), &job); err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if job.Owner != "" && job.Owner != q.owner && job.LeaseUntil != nil && job.LeaseUntil.After(now) {
+		// Проверяем задачу снова, когда аренда истечет
+		time.AfterFunc(job.LeaseUntil.Sub(now)+time.Second, func() { q.schedule(fileID) })
+		return nil, nil
+	}
+
+	job.Owner = q.owner
+	if err := q.saveJob(q.ctx, &job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-time.After(claimSettle):
+	case <-q.ctx.Done():
+		return nil, q.ctx.Err()
+	}
+
+	var current Job
+	if err := q.store.GetJSON(q.ctx, jobKey(fileID), &current); err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if current.Owner != q.owner {
+		log.Printf("Processing job for file %s was claimed by %s", fileID, current.Owner)
+		return nil, nil
+	}
+
+	return &job, nil
+}
+
+// release снимает аренду задачи, чтобы ее сразу мог взять другой экземпляр
+func (q *Queue) release(job *Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job.Owner = ""
+	if err := q.saveJob(ctx, job); err != nil {
+		log.Printf("Failed to release job for file %s: %v", job.FileID, err)
+	}
+}
+
+// retryLater ставит задачу в очередь повторно через retryDelay
+func (q *Queue) retryLater(fileID string) {
+	time.AfterFunc(retryDelay, func() { q.schedule(fileID) })
+}
+
+// runProcessor выполняет один обработчик. Возвращает errRetryScheduled,
+// если обработчик завершился ошибкой и будет повторен, storage.ErrFileNotFound,
+// если файл удален, и ошибки S3 при чтении и сохранении метаданных
+func (q *Queue) runProcessor(job *Job, processor Processor) error {
+	name := processor.Name()
+	started := time.Now().UTC()
+
+	// Продлеваем аренду на время работы обработчика
+	if err := q.saveJob(q.ctx, job); err != nil {
+		return err
+	}
+
+	file, err := q.store.UpdateSystemMetadata(q.ctx, job.FileID, func(m *storage.FileMetadata) error {
+		m.Status = storage.StatusProcessing
+		setResult(m, name, &storage.ProcessorResult{
+			Status:    storage.StatusProcessing,
+			Attempts:  job.Attempts + 1,
+			StartedAt: &started,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load file for processor %s: %w", name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, processTimeout)
+	output, err := process(ctx, processor, file)
+	cancel()
+
+	if q.ctx.Err() != nil {
+		return q.ctx.Err()
+	}
+
+	finished := time.Now().UTC()
+	result := &storage.ProcessorResult{
+		Status:     storage.StatusReady,
+		Output:     output,
+		Attempts:   job.Attempts + 1,
+		StartedAt:  &started,
+		FinishedAt: &finished,
+	}
+
+	if err != nil {
+		job.Attempts++
+		if job.Attempts < maxAttempts {
+			log.Printf("Processor %s failed for file %s (attempt %d), retrying: %v", name, job.FileID, job.Attempts, err)
+			job.UpdatedAt = finished
+			if err := q.saveJob(q.ctx, job); err != nil {
+				log.Printf("Failed to save job for file %s: %v", job.FileID, err)
+			}
+			q.retryLater(job.FileID)
+			return errRetryScheduled
+		}
+
+		log.Printf("Processor %s failed for file %s: %v", name, job.FileID, err)
+		result.Status = storage.StatusFailed
+		result.Error = err.Error()
+	}
+
+	return q.setResult(job.FileID, name, result)
+}
+
+// process вызывает обработчик; паника считается ошибкой обработчика
+func process(ctx context.Context, processor Processor, file *storage.FileMetadata) (output map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Processor %s panicked on file %s: %v\n%s", processor.Name(), file.ID, r, debug.Stack())
+			err = fmt.Errorf("processor panicked: %v", r)
+		}
+	}()
+	return processor.Process(ctx, file)
+}
+
+// setResult сохраняет результат обработчика в метаданных файла
+func (q *Queue) setResult(fileID, name string, result *storage.ProcessorResult) error {
+	_, err := q.store.UpdateSystemMetadata(q.ctx, fileID, func(m *storage.FileMetadata) error {
+		setResult(m, name, result)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save result of processor %s: %w", name, err)
+	}
+	return nil
+}
+
+// processor ищет обработчик по имени
+func (q *Queue) processor(name string) Processor {
+	for _, p := range q.processors {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// saveJob сохраняет состояние задачи. Задача с владельцем закрепляется за
+// ним на leaseDuration
+func (q *Queue) saveJob(ctx context.Context, job *Job) error {
+	job.LeaseUntil = nil
+	if job.Owner != "" {
+		lease := time.Now().UTC().Add(leaseDuration)
+		job.LeaseUntil = &lease
+	}
+	return q.store.PutJSON(ctx, jobKey(job.FileID), job)
+}
+
+// setResult записывает результат обработчика в метаданные
+func setResult(m *storage.FileMetadata, name string, result *storage.ProcessorResult) {
+	if m.Processing == nil {
+		m.Processing = make(map[string]*storage.ProcessorResult)
+	}
+	m.Processing[name] = result
+}
+
+// jobKey возвращает ключ состояния задачи
+func jobKey(fileID string) string {
+	return fmt.Sprintf("jobs/%s.json", fileID)
+}
@@ -0,0 +1,71 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"file-agent/internal/storage"
+)
+
+// fakeProcessor обработчик с заданным поведением
+type fakeProcessor struct {
+	name     string
+	supports bool
+	process  func() (map[string]interface{}, error)
+}
+
+func (p *fakeProcessor) Name() string                        { return p.name }
+func (p *fakeProcessor) Supports(*storage.FileMetadata) bool { return p.supports }
+func (p *fakeProcessor) Process(context.Context, *storage.FileMetadata) (map[string]interface{}, error) {
+	return p.process()
+}
+
+func TestProcessRecoversPanic(t *testing.T) {
+	processor := &fakeProcessor{name: "broken", process: func() (map[string]interface{}, error) {
+		var m map[string]int
+		m["crash"]++ // Запись в nil map
+		return nil, nil
+	}}
+
+	output, err := process(context.Background(), processor, &storage.FileMetadata{ID: "file"})
+	if err == nil {
+		t.Fatal("process() expected error after panic")
+	}
+	if output != nil {
+		t.Errorf("process() output = %v, want nil", output)
+	}
+}
+
+func TestProcessReturnsResult(t *testing.T) {
+	want := errors.New("failed")
+	processor := &fakeProcessor{name: "ok", process: func() (map[string]interface{}, error) {
+		return map[string]interface{}{"pages": 3}, want
+	}}
+
+	output, err := process(context.Background(), processor, &storage.FileMetadata{ID: "file"})
+	if !errors.Is(err, want) || output["pages"] != 3 {
+		t.Errorf("process() = %v, %v", output, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	q := NewQueue(nil, 1,
+		&fakeProcessor{name: "thumbnails", supports: true},
+		&fakeProcessor{name: "scan", supports: false},
+	)
+
+	file := &storage.FileMetadata{ID: "file"}
+	names := q.Plan(file)
+	if len(names) != 1 || names[0] != "thumbnails" {
+		t.Fatalf("Plan() = %v, want [thumbnails]", names)
+	}
+	if file.Status != storage.StatusPending || file.Processing["thumbnails"].Status != storage.StatusPending {
+		t.Errorf("Plan() did not mark file pending: %+v", file)
+	}
+
+	empty := &storage.FileMetadata{ID: "other"}
+	if names := NewQueue(nil, 1).Plan(empty); names != nil || empty.Status != storage.StatusReady {
+		t.Errorf("Plan() without processors = %v, status %q", names, empty.Status)
+	}
+}
@@ -0,0 +1,243 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"file-agent/internal/analytics"
+)
+
+// Машиночитаемые причины отказа
+const (
+	ReasonMaxBytes         = "max_bytes"
+	ReasonMaxFiles         = "max_files"
+	ReasonMaxUploadsPerDay = "max_uploads_per_day"
+)
+
+// Limits ограничения для автора загрузок; 0 - без ограничения
+type Limits struct {
+	MaxBytes         int64 `json:"max_bytes,omitempty"`
+	MaxFiles         int64 `json:"max_files,omitempty"`
+	MaxUploadsPerDay int64 `json:"max_uploads_per_day,omitempty"`
+}
+
+// Config квоты по умолчанию и для отдельных пользователей. Квота
+// пользователя полностью заменяет квоту по умолчанию
+type Config struct {
+	Default Limits            `json:"default"`
+	Users   map[string]Limits `json:"users,omitempty"`
+}
+
+// Usage использование квоты пользователем
+type Usage struct {
+	Bytes        int64 `json:"bytes"`
+	Files        int64 `json:"files"`
+	UploadsToday int64 `json:"uploads_today"` // Загрузки с начала суток UTC
+}
+
+// Decision результат проверки квоты
+type Decision struct {
+	Allowed    bool
+	Status     int    // HTTP статус для отказа (507, 429)
+	Reason     string // Машиночитаемая причина отказа
+	Limit      int64
+	Used       int64
+	RetryAfter time.Duration // Для суточного лимита - время до начала следующих суток
+	Message    string
+}
+
+// Quotas проверяет квоты загрузок. Использование берется из статистики
+// по пользователю, загрузившему файлы (owner), а не по редактируемому полю
+// uploaded_by; суточный лимит считается по принятым загрузкам, поэтому
+// удаление файла его не сбрасывает. Загрузки, которые еще сохраняются,
+// резервируют квоту, чтобы параллельные запросы не превысили ее
+type Quotas struct {
+	config     Config
+	aggregates *analytics.Store
+
+	mu      sync.Mutex
+	pending map[string]Usage
+}
+
+// Load загружает квоты из JSON-файла
+func Load(filename string) (Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read quota file: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse quota file: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// Validate проверяет корректность квот
+func (c Config) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default quota: %w", err)
+	}
+	for user, limits := range c.Users {
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("quota of %q: %w", user, err)
+		}
+	}
+	return nil
+}
+
+func (l Limits) validate() error {
+	if l.MaxBytes < 0 || l.MaxFiles < 0 || l.MaxUploadsPerDay < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// New создает проверку квот с использованием из aggregates
+func New(config Config, aggregates *analytics.Store) *Quotas {
+	return &Quotas{
+		config:     config,
+		aggregates: aggregates,
+		pending:    make(map[string]Usage),
+	}
+}
+
+// Limits возвращает квоту пользователя
+func (q *Quotas) Limits(user string) Limits {
+	if limits, ok := q.config.Users[key(user)]; ok {
+		return limits
+	}
+	return q.config.Default
+}
+
+// Usage возвращает использование квоты файлами пользователя и принятыми
+// за сутки загрузками
+func (q *Quotas) Usage(user string, now time.Time) Usage {
+	stored, uploads := q.aggregates.OwnerUsage(key(user), dayStart(now))
+	return Usage{
+		Bytes:        stored.TotalSize,
+		Files:        stored.FileCount,
+		UploadsToday: uploads,
+	}
+}
+
+// Check проверяет, что загрузка файла размером size не превысит квоту
+// пользователя, не резервируя ее. Используется до чтения тела запроса
+func (q *Quotas) Check(user string, size int64, now time.Time) Decision {
+	user = key(user)
+	limits := q.Limits(user)
+	usage := q.Usage(user, now)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.decide(user, limits, usage, size, now)
+}
+
+// Reserve проверяет, что загрузка файла размером size не превысит квоту
+// пользователя, и резервирует ее. Возвращаемая функция снимает резерв и
+// вызывается после сохранения файла в статистике или при ошибке загрузки
+func (q *Quotas) Reserve(user string, size int64, now time.Time) (Decision, func()) {
+	user = key(user)
+	limits := q.Limits(user)
+	usage := q.Usage(user, now)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	decision := q.decide(user, limits, usage, size, now)
+	if !decision.Allowed {
+		return decision, func() {}
+	}
+
+	reserved := Usage{Bytes: size, Files: 1, UploadsToday: 1}
+	q.add(user, reserved, 1)
+
+	var once sync.Once
+	return decision, func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.add(user, reserved, -1)
+		})
+	}
+}
+
+// decide сравнивает использование вместе с резервом с лимитами; вызывается под mu
+func (q *Quotas) decide(user string, limits Limits, usage Usage, size int64, now time.Time) Decision {
+	pending := q.pending[user]
+	usage.Bytes += pending.Bytes
+	usage.Files += pending.Files
+	usage.UploadsToday += pending.UploadsToday
+
+	if limits.MaxBytes > 0 && usage.Bytes+size > limits.MaxBytes {
+		return Decision{
+			Status:  http.StatusInsufficientStorage,
+			Reason:  ReasonMaxBytes,
+			Limit:   limits.MaxBytes,
+			Used:    usage.Bytes,
+			Message: fmt.Sprintf("Storage quota exceeded: %d of %d bytes used, file size is %d bytes", usage.Bytes, limits.MaxBytes, size),
+		}
+	}
+	if limits.MaxFiles > 0 && usage.Files+1 > limits.MaxFiles {
+		return Decision{
+			Status:  http.StatusInsufficientStorage,
+			Reason:  ReasonMaxFiles,
+			Limit:   limits.MaxFiles,
+			Used:    usage.Files,
+			Message: fmt.Sprintf("File count quota exceeded: %d of %d files", usage.Files, limits.MaxFiles),
+		}
+	}
+	if limits.MaxUploadsPerDay > 0 && usage.UploadsToday+1 > limits.MaxUploadsPerDay {
+		return Decision{
+			Status:     http.StatusTooManyRequests,
+			Reason:     ReasonMaxUploadsPerDay,
+			Limit:      limits.MaxUploadsPerDay,
+			Used:       usage.UploadsToday,
+			RetryAfter: ResetsAt(now).Sub(now),
+			Message:    fmt.Sprintf("Daily upload quota exceeded: %d of %d uploads today", usage.UploadsToday, limits.MaxUploadsPerDay),
+		}
+	}
+
+	return Decision{Allowed: true}
+}
+
+// add изменяет резерв пользователя; вызывается под mu
+func (q *Quotas) add(user string, usage Usage, sign int64) {
+	pending := q.pending[user]
+	pending.Bytes += sign * usage.Bytes
+	pending.Files += sign * usage.Files
+	pending.UploadsToday += sign * usage.UploadsToday
+	if pending.Files <= 0 {
+		delete(q.pending, user)
+		return
+	}
+	q.pending[user] = pending
+}
+
+// ResetsAt возвращает начало следующих суток UTC, когда сбрасывается суточный лимит
+func ResetsAt(now time.Time) time.Time {
+	return dayStart(now).AddDate(0, 0, 1)
+}
+
+// dayStart возвращает начало суток UTC
+func dayStart(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// key возвращает автора загрузки так же, как он учитывается в статистике
+func key(user string) string {
+	if user == "" {
+		return "anonymous"
+	}
+	return user
+}
@@ -0,0 +1,124 @@
+package quota
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"file-agent/internal/analytics"
+	"file-agent/internal/storage"
+)
+
+func TestCheckCountsByOwner(t *testing.T) {
+	now := time.Now()
+	aggregates := analytics.NewStore(nil)
+	// Файл загрузил alice, но автором в uploaded_by указан bob
+	aggregates.AddUpload(&storage.FileMetadata{ID: "1", Filename: "a.bin", Size: 600, UploadedBy: "bob", Owner: "alice", UploadedAt: now})
+
+	quotas := New(Config{Default: Limits{MaxBytes: 1000}}, aggregates)
+
+	decision := quotas.Check("alice", 500, now)
+	if decision.Allowed || decision.Status != http.StatusInsufficientStorage || decision.Reason != ReasonMaxBytes || decision.Used != 600 {
+		t.Errorf("Check(alice) = %+v, want 507 max_bytes with 600 bytes used", decision)
+	}
+	if decision := quotas.Check("bob", 500, now); !decision.Allowed {
+		t.Errorf("Check(bob) = %+v, want allowed: files are counted by owner, not uploaded_by", decision)
+	}
+	if usage := quotas.Usage("bob", now); usage != (Usage{}) {
+		t.Errorf("Usage(bob) = %+v, want empty", usage)
+	}
+}
+
+func TestUserLimitsReplaceDefault(t *testing.T) {
+	quotas := New(Config{
+		Default: Limits{MaxBytes: 1000, MaxFiles: 10},
+		Users:   map[string]Limits{"backup-bot": {MaxBytes: 5000}},
+	}, analytics.NewStore(nil))
+
+	if limits := quotas.Limits("backup-bot"); limits != (Limits{MaxBytes: 5000}) {
+		t.Errorf("Limits(backup-bot) = %+v, want only max_bytes 5000", limits)
+	}
+	if limits := quotas.Limits("alice"); limits != (Limits{MaxBytes: 1000, MaxFiles: 10}) {
+		t.Errorf("Limits(alice) = %+v, want default", limits)
+	}
+}
+
+func TestDailyLimitCountsAcceptedUploads(t *testing.T) {
+	now := time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)
+	aggregates := analytics.NewStore(nil)
+	quotas := New(Config{Default: Limits{MaxUploadsPerDay: 2}}, aggregates)
+
+	// Неудачная загрузка снимает резерв и не расходует лимит
+	decision, release := quotas.Reserve("alice", 100, now)
+	if !decision.Allowed {
+		t.Fatalf("Reserve() = %+v, want allowed", decision)
+	}
+	release()
+	release()
+	if usage := quotas.Usage("alice", now); usage.UploadsToday != 0 {
+		t.Errorf("uploads today after a failed upload = %d, want 0", usage.UploadsToday)
+	}
+
+	// Принятые загрузки расходуют лимит, удаление файла его не возвращает
+	for i, id := range []string{"1", "2"} {
+		decision, release := quotas.Reserve("alice", 100, now)
+		if !decision.Allowed {
+			t.Fatalf("upload %d: Reserve() = %+v, want allowed", i+1, decision)
+		}
+		file := &storage.FileMetadata{ID: id, Filename: id + ".txt", Size: 100, Owner: "alice", UploadedAt: now}
+		aggregates.AddUpload(file)
+		release()
+		if id == "1" {
+			aggregates.Remove(file)
+		}
+	}
+
+	decision, _ = quotas.Reserve("alice", 100, now)
+	if decision.Allowed || decision.Status != http.StatusTooManyRequests || decision.Reason != ReasonMaxUploadsPerDay || decision.Used != 2 {
+		t.Errorf("third upload: Reserve() = %+v, want 429 max_uploads_per_day with 2 used", decision)
+	}
+	if decision.RetryAfter != 6*time.Hour {
+		t.Errorf("RetryAfter = %v, want 6h until the next UTC day", decision.RetryAfter)
+	}
+
+	// Следующие сутки начинаются с нуля
+	if decision := quotas.Check("alice", 100, now.Add(7*time.Hour)); !decision.Allowed {
+		t.Errorf("next day: Check() = %+v, want allowed", decision)
+	}
+}
+
+func TestReserveHoldsPendingUploads(t *testing.T) {
+	now := time.Now()
+	quotas := New(Config{Default: Limits{MaxBytes: 1000, MaxFiles: 1}}, analytics.NewStore(nil))
+
+	first, release := quotas.Reserve("alice", 600, now)
+	if !first.Allowed {
+		t.Fatalf("first Reserve() = %+v, want allowed", first)
+	}
+
+	// Параллельная загрузка видит резерв первой
+	second, _ := quotas.Reserve("alice", 600, now)
+	if second.Allowed || second.Reason != ReasonMaxBytes || second.Used != 600 {
+		t.Errorf("second Reserve() = %+v, want max_bytes with 600 bytes reserved", second)
+	}
+	if decision := quotas.Check("alice", 10, now); decision.Allowed || decision.Reason != ReasonMaxFiles {
+		t.Errorf("Check() = %+v, want max_files", decision)
+	}
+
+	release()
+	if decision := quotas.Check("alice", 600, now); !decision.Allowed {
+		t.Errorf("Check() after release = %+v, want allowed", decision)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{Default: Limits{MaxBytes: -1}}).Validate(); err == nil {
+		t.Error("negative default limit was accepted")
+	}
+	if err := (Config{Users: map[string]Limits{"alice": {MaxUploadsPerDay: -5}}}).Validate(); err == nil {
+		t.Error("negative user limit was accepted")
+	}
+	if err := (Config{Default: Limits{MaxBytes: 1 << 30}}).Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
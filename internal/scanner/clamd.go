@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"file-agent/internal/storage"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Режимы обработки зараженных файлов
+const (
+	ModeReject     = "reject"
+	ModeQuarantine = "quarantine"
+	ModeAsync      = "async" // Проверка после загрузки в очереди обработки
+)
+
+// chunkSize размер блока данных в команде INSTREAM
+const chunkSize = 64 << 10
+
+var (
+	// ErrScanFailed возвращается, если clamd не смог проверить файл
+	ErrScanFailed = errors.New("scan failed")
+	// ErrStreamTooLarge возвращается, если файл больше StreamMaxLength в настройках clamd
+	ErrStreamTooLarge = errors.New("file exceeds clamd stream size limit")
+)
+
+// Result результат проверки
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Status возвращает статус проверки для сохранения в метаданных
+func (r Result) Status() string {
+	if r.Infected {
+		return storage.ScanStatusInfected
+	}
+	return storage.ScanStatusClean
+}
+
+// Client клиент демона clamd
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClient создает клиента clamd. Адрес задается как tcp://host:3310,
+// unix:///run/clamav/clamd.sock, host:port или путь к сокету
+func NewClient(address string, timeout time.Duration) (*Client, error) {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		network = "unix"
+		address = strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "/"):
+		network = "unix"
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("clamd address is empty")
+	}
+
+	return &Client{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}, nil
+}
+
+// Ping проверяет доступность clamd
+func (c *Client) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: unexpected reply %q", ErrScanFailed, reply)
+	}
+	return nil
+}
+
+// Scan передает содержимое в clamd командой INSTREAM
+func (c *Client) Scan(ctx context.Context, content io.Reader) (Result, error) {
+	reply, err := c.command(ctx, "zINSTREAM\x00", content)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Ответ имеет вид "stream: OK", "stream: <signature> FOUND" или "<message> ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		// Повторная попытка не поможет, пока не увеличен StreamMaxLength
+		return Result{}, fmt.Errorf("%w: %s", ErrStreamTooLarge, reply)
+	default:
+		return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
+
+// command отправляет команду clamd и читает ответ. Если передан stream,
+// он отправляется блоками в формате INSTREAM
+func (c *Client) command(ctx context.Context, cmd string, stream io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to connect to clamd: %v", ErrScanFailed, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", fmt.Errorf("%w: failed to send command: %v", ErrScanFailed, err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	if stream != nil {
+		if err := writeChunks(conn, stream); err != nil {
+			// clamd закрывает соединение при превышении StreamMaxLength,
+			// но перед этим отправляет ответ с причиной
+			if errors.Is(err, ErrScanFailed) {
+				if reply, _ := reader.ReadString(0); reply != "" {
+					return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+				}
+			}
+			return "", err
+		}
+	}
+
+	reply, err := reader.ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return "", fmt.Errorf("%w: failed to read reply: %v", ErrScanFailed, err)
+	}
+
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// writeChunks отправляет данные блоками <длина uint32 big-endian><данные>
+// и завершает поток блоком нулевой длины
+func writeChunks(w io.Writer, r io.Reader) error {
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := w.Write(size[:]); err != nil {
+				return fmt.Errorf("%w: failed to send chunk: %v", ErrScanFailed, err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				// clamd закрывает соединение при превышении StreamMaxLength
+				return fmt.Errorf("%w: failed to send chunk: %v", ErrScanFailed, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read content: %w", readErr)
+		}
+	}
+
+	if _, err := w.Write(bytes.Repeat([]byte{0}, 4)); err != nil {
+		return fmt.Errorf("%w: failed to finish stream: %v", ErrScanFailed, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClamd локальный сервер, разбирающий команды clamd так же, как демон
+type fakeClamd struct {
+	listener net.Listener
+	reply    func(data []byte) string // Ответ на INSTREAM по полученным данным
+
+	mu     sync.Mutex
+	chunks []int  // Размеры блоков последнего INSTREAM
+	data   []byte // Данные последнего INSTREAM
+}
+
+func newFakeClamd(t *testing.T, reply func(data []byte) string) *fakeClamd {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	f := &fakeClamd{listener: listener, reply: reply}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeClamd) client(t *testing.T) *Client {
+	t.Helper()
+	client, err := NewClient("tcp://"+f.listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	cmd, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch cmd {
+	case "zPING\x00":
+		io.WriteString(conn, "PONG\x00")
+
+	case "zINSTREAM\x00":
+		var chunks []int
+		var data []byte
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(reader, size[:]); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size[:])
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(reader, chunk); err != nil {
+				return
+			}
+			chunks = append(chunks, int(n))
+			data = append(data, chunk...)
+		}
+
+		f.mu.Lock()
+		f.chunks, f.data = chunks, data
+		f.mu.Unlock()
+
+		io.WriteString(conn, f.reply(data)+"\x00")
+
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+// eicar тестовая сигнатура антивирусов
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// signatureReply отвечает как clamd с базой, содержащей только EICAR
+func signatureReply(data []byte) string {
+	if bytes.Contains(data, []byte(eicar)) {
+		return "stream: Eicar-Test-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name          string
+		reply         func([]byte) string
+		content       string
+		wantInfected  bool
+		wantSignature string
+		wantErr       error
+	}{
+		{name: "clean", reply: signatureReply, content: "hello world"},
+		{name: "empty", reply: signatureReply, content: ""},
+		{name: "infected", reply: signatureReply, content: eicar, wantInfected: true, wantSignature: "Eicar-Test-Signature"},
+		{
+			name:    "size limit error",
+			reply:   func([]byte) string { return "INSTREAM size limit exceeded. ERROR" },
+			content: "data",
+			wantErr: ErrStreamTooLarge,
+		},
+		{
+			name:    "unexpected reply",
+			reply:   func([]byte) string { return "stream: something else" },
+			content: "data",
+			wantErr: ErrScanFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clamd := newFakeClamd(t, tt.reply)
+
+			result, err := clamd.client(t).Scan(context.Background(), strings.NewReader(tt.content))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Scan() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if result.Infected != tt.wantInfected || result.Signature != tt.wantSignature {
+				t.Errorf("Scan() = %+v, want infected=%v signature=%q", result, tt.wantInfected, tt.wantSignature)
+			}
+		})
+	}
+}
+
+func TestScanChunking(t *testing.T) {
+	clamd := newFakeClamd(t, signatureReply)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*chunkSize+100)/16+1)
+	if _, err := clamd.client(t).Scan(context.Background(), bytes.NewReader(content)); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	clamd.mu.Lock()
+	defer clamd.mu.Unlock()
+
+	if !bytes.Equal(clamd.data, content) {
+		t.Fatalf("clamd received %d bytes, want %d", len(clamd.data), len(content))
+	}
+	if len(clamd.chunks) < 3 {
+		t.Errorf("content was sent in %d chunks, want at least 3", len(clamd.chunks))
+	}
+	for _, size := range clamd.chunks {
+		if size > chunkSize {
+			t.Errorf("chunk of %d bytes exceeds %d", size, chunkSize)
+		}
+	}
+}
+
+func TestScanSignatureAcrossChunks(t *testing.T) {
+	clamd := newFakeClamd(t, signatureReply)
+
+	// Сигнатура на границе блоков должна быть найдена после сборки потока
+	content := append(bytes.Repeat([]byte{'a'}, chunkSize-10), []byte(eicar)...)
+	result, err := clamd.client(t).Scan(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if !result.Infected {
+		t.Errorf("Scan() = %+v, want infected", result)
+	}
+}
+
+func TestPing(t *testing.T) {
+	clamd := newFakeClamd(t, signatureReply)
+	if err := clamd.client(t).Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+}
+
+func TestScanUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	client, err := NewClient(address, time.Second)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := client.Scan(context.Background(), strings.NewReader("data")); !errors.Is(err, ErrScanFailed) {
+		t.Fatalf("Scan() error = %v, want ErrScanFailed", err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		address     string
+		wantNetwork string
+		wantAddress string
+		wantErr     bool
+	}{
+		{"tcp://clamav:3310", "tcp", "clamav:3310", false},
+		{"clamav:3310", "tcp", "clamav:3310", false},
+		{"unix:///run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl", false},
+		{"/run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl", false},
+		{"tcp://", "", "", true},
+	}
+
+	for _, tt := range tests {
+		client, err := NewClient(tt.address, time.Second)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewClient(%q) expected error", tt.address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewClient(%q) error = %v", tt.address, err)
+			continue
+		}
+		if client.network != tt.wantNetwork || client.address != tt.wantAddress {
+			t.Errorf("NewClient(%q) = %s %s, want %s %s", tt.address, client.network, client.address, tt.wantNetwork, tt.wantAddress)
+		}
+	}
+}
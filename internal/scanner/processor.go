@@ -0,0 +1,59 @@
+package scanner
+
+import (
+	"context"
+	"file-agent/internal/storage"
+	"fmt"
+)
+
+// ProcessorName имя обработчика антивирусной проверки
+const ProcessorName = "antivirus"
+
+// Processor выполняет антивирусную проверку после загрузки (SCAN_MODE=async)
+type Processor struct {
+	store  *storage.S3Storage
+	client *Client
+}
+
+// NewProcessor создает обработчик антивирусной проверки
+func NewProcessor(store *storage.S3Storage, client *Client) *Processor {
+	return &Processor{
+		store:  store,
+		client: client,
+	}
+}
+
+// Name возвращает имя обработчика
+func (p *Processor) Name() string {
+	return ProcessorName
+}
+
+// Supports проверяет, нужно ли проверять файл
+func (p *Processor) Supports(file *storage.FileMetadata) bool {
+	return true
+}
+
+// Process проверяет файл и помещает зараженный файл в карантин
+func (p *Processor) Process(ctx context.Context, file *storage.FileMetadata) (map[string]interface{}, error) {
+	result, err := scanStored(ctx, p.store, p.client, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan file: %w", err)
+	}
+
+	_, err = p.store.UpdateSystemMetadata(ctx, file.ID, func(m *storage.FileMetadata) error {
+		ApplyResult(m, result)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save scan result: %w", err)
+	}
+
+	output := map[string]interface{}{
+		"scan_status": result.Status(),
+	}
+	if result.Infected {
+		output["signature"] = result.Signature
+	}
+
+	return output, nil
+}
@@ -0,0 +1,171 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"file-agent/internal/storage"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrRescanRunning возвращается, если повторная проверка уже выполняется
+var ErrRescanRunning = errors.New("rescan is already running")
+
+// RescanSummary итоги повторной проверки
+type RescanSummary struct {
+	Scanned  int `json:"scanned"`
+	Infected int `json:"infected"`
+	Failed   int `json:"failed"`
+}
+
+// RescanStatus состояние последней повторной проверки
+type RescanStatus struct {
+	Running    bool       `json:"running"`
+	Files      int        `json:"files,omitempty"` // Количество запрошенных файлов, 0 - все файлы
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	RescanSummary
+}
+
+// Rescanner выполняет повторную проверку внутри работающего сервиса, чтобы
+// обновления метаданных не конкурировали с запросами и очередью обработки
+type Rescanner struct {
+	store  *storage.S3Storage
+	client *Client
+
+	mu     sync.Mutex
+	status RescanStatus
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRescanner создает исполнителя повторных проверок
+func NewRescanner(store *storage.S3Storage, client *Client) *Rescanner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Rescanner{
+		store:  store,
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start запускает повторную проверку в фоне. Одновременно выполняется
+// только одна проверка
+func (r *Rescanner) Start(fileIDs []string) (RescanStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status.Running {
+		return r.status, ErrRescanRunning
+	}
+
+	now := time.Now().UTC()
+	r.status = RescanStatus{Running: true, Files: len(fileIDs), StartedAt: &now}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		summary, err := Rescan(r.ctx, r.store, r.client, fileIDs)
+		if err != nil {
+			log.Printf("Rescan failed: %v", err)
+		} else {
+			log.Printf("Rescan completed: %d scanned, %d infected, %d failed", summary.Scanned, summary.Infected, summary.Failed)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		finished := time.Now().UTC()
+		r.status.Running = false
+		r.status.FinishedAt = &finished
+		r.status.RescanSummary = summary
+		if err != nil {
+			r.status.Error = err.Error()
+		}
+	}()
+
+	return r.status, nil
+}
+
+// Status возвращает состояние последней проверки
+func (r *Rescanner) Status() RescanStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Stop прерывает выполняющуюся проверку
+func (r *Rescanner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Rescan повторно проверяет файлы (например, после обновления сигнатур) и
+// обновляет статус в метаданных. Если fileIDs пуст, проверяются все файлы
+func Rescan(ctx context.Context, store *storage.S3Storage, client *Client, fileIDs []string) (RescanSummary, error) {
+	var summary RescanSummary
+
+	if len(fileIDs) == 0 {
+		allMetadata, err := store.ListAllMetadata(ctx)
+		if err != nil {
+			return summary, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, meta := range allMetadata {
+			fileIDs = append(fileIDs, meta.ID)
+		}
+	}
+
+	for _, fileID := range fileIDs {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		result, err := scanStored(ctx, store, client, fileID)
+		if err != nil {
+			log.Printf("Failed to rescan file %s: %v", fileID, err)
+			summary.Failed++
+			continue
+		}
+
+		summary.Scanned++
+		if result.Infected {
+			summary.Infected++
+			log.Printf("File %s is infected: %s", fileID, result.Signature)
+		}
+
+		_, err = store.UpdateSystemMetadata(ctx, fileID, func(m *storage.FileMetadata) error {
+			ApplyResult(m, result)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to update scan status of file %s: %v", fileID, err)
+		}
+	}
+
+	return summary, nil
+}
+
+// ApplyResult записывает результат проверки в метаданные
+func ApplyResult(m *storage.FileMetadata, result Result) {
+	now := time.Now().UTC()
+	m.ScanStatus = result.Status()
+	m.ScanSignature = result.Signature
+	m.ScannedAt = &now
+}
+
+// scanStored проверяет файл, уже сохраненный в хранилище
+func scanStored(ctx context.Context, store *storage.S3Storage, client *Client, fileID string) (Result, error) {
+	reader, _, err := store.GetFile(ctx, fileID)
+	if err != nil {
+		return Result{}, err
+	}
+	defer reader.Close()
+
+	return client.Scan(ctx, reader)
+}
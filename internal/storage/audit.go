@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// FieldChange описывает изменение одного поля метаданных
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditRecord запись журнала изменений метаданных файла
+type AuditRecord struct {
+	FileID    string                 `json:"file_id"`
+	Revision  int64                  `json:"revision"`
+	ChangedBy string                 `json:"changed_by"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// SaveAuditRecord сохраняет запись журнала изменений в audit/{fileID}/
+func (s *S3Storage) SaveAuditRecord(ctx context.Context, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	// Ревизия с ведущими нулями сохраняет хронологический порядок ключей
+	auditKey := fmt.Sprintf("audit/%s/%010d.json", record.FileID, record.Revision)
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(auditKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save audit record to S3: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuditRecords возвращает журнал изменений метаданных файла
+func (s *S3Storage) ListAuditRecords(ctx context.Context, fileID string) ([]*AuditRecord, error) {
+	listInput := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(fmt.Sprintf("audit/%s/", fileID)),
+	}
+
+	records := make([]*AuditRecord, 0)
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, listInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit records: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			if obj.Key == nil {
+				continue
+			}
+
+			record, err := s.loadAuditRecord(ctx, *obj.Key)
+			if err != nil {
+				log.Printf("Failed to load audit record %s: %v", *obj.Key, err)
+				continue
+			}
+
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Revision < records[j].Revision
+	})
+
+	return records, nil
+}
+
+// loadAuditRecord загружает запись журнала по ключу
+func (s *S3Storage) loadAuditRecord(ctx context.Context, key string) (*AuditRecord, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit record from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit record: %w", err)
+	}
+
+	var record AuditRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit record: %w", err)
+	}
+
+	return &record, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxFilenameLength максимальная длина имени файла в байтах
+const MaxFilenameLength = 255
+
+// DefaultFilename имя, используемое, если после очистки имя оказалось пустым
+const DefaultFilename = "file"
+
+// SanitizeFilename приводит имя файла к безопасному виду: отбрасывает путь,
+// заменяет управляющие символы и разделители каталогов, обрезает пробелы
+// и точки по краям и ограничивает длину
+func SanitizeFilename(name string) string {
+	// Некоторые клиенты передают полный путь, в том числе с обратными слешами
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.ToValidUTF8(name, "_")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r), r == unicode.ReplacementChar:
+			return '_'
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, name)
+
+	name = strings.Trim(name, " .")
+
+	if len(name) > MaxFilenameLength {
+		name = truncateFilename(name, MaxFilenameLength)
+	}
+
+	if name == "" {
+		return DefaultFilename
+	}
+
+	return name
+}
+
+// truncateFilename обрезает имя по границе символа, сохраняя расширение
+func truncateFilename(name string, limit int) string {
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i <= 16 {
+		ext = name[i:]
+		name = name[:i]
+	}
+
+	limit -= len(ext)
+	for len(name) > limit {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return strings.TrimRight(name, " .") + ext
+}
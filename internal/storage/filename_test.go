@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"unix path", "../../etc/passwd", "passwd"},
+		{"windows path", `C:\Users\me\report.pdf`, "report.pdf"},
+		{"trailing slash", "dir/", DefaultFilename},
+		{"control characters", "a\tb\nc.txt", "a_b_c.txt"},
+		{"invalid utf-8", "a\xffb.txt", "a_b.txt"},
+		{"unicode spaces", "\u00a0отчет\u20032024.txt", "отчет 2024.txt"},
+		{"dots and spaces trimmed", "  .hidden. ", "hidden"},
+		{"only dots", "...", DefaultFilename},
+		{"empty", "", DefaultFilename},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFilename(tt.input); got != tt.want {
+				t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameTruncates(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantExt string
+	}{
+		{"ascii", strings.Repeat("a", 300) + ".txt", ".txt"},
+		{"multibyte runes", strings.Repeat("я", 200) + ".txt", ".txt"},
+		{"long extension dropped", "name." + strings.Repeat("x", 300), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeFilename(tt.input)
+			if len(got) > MaxFilenameLength {
+				t.Errorf("len = %d, want <= %d", len(got), MaxFilenameLength)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("result %q is not valid UTF-8", got)
+			}
+			if tt.wantExt != "" && !strings.HasSuffix(got, tt.wantExt) {
+				t.Errorf("result %q lost extension %q", got, tt.wantExt)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrFolderNotFound возвращается, если папка не найдена
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrFolderExists возвращается, если папка с таким именем уже существует
+	ErrFolderExists = errors.New("folder already exists")
+	// ErrInvalidPath возвращается для некорректных путей и имен папок
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrFileNotFound возвращается, если файл по пути не найден
+	ErrFileNotFound = errors.New("file not found")
+)
+
+// folderMu сериализует изменения дерева папок внутри процесса
+var folderMu sync.Mutex
+
+// Folder описывает виртуальную папку. Папки существуют только в метаданных,
+// сами файлы по-прежнему хранятся под ключами files/{id}
+type Folder struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  string    `json:"parent_id,omitempty"` // Пусто для папок верхнего уровня
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RootFolder возвращает корневую папку дерева
+func RootFolder() *Folder {
+	return &Folder{Path: "/"}
+}
+
+// CleanPath нормализует путь вида /projects/alpha и проверяет его корректность
+func CleanPath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "/", nil
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "." || segment == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+	return path.Clean("/" + p), nil
+}
+
+// JoinPath соединяет путь папки и имя элемента
+func JoinPath(dir, name string) string {
+	if dir == "" || dir == "/" {
+		return "/" + name
+	}
+	return dir + "/" + name
+}
+
+// validateFolderName проверяет имя папки
+func validateFolderName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return ErrInvalidPath
+	}
+	return nil
+}
+
+// ListFolders получает все папки
+func (s *S3Storage) ListFolders(ctx context.Context) ([]*Folder, error) {
+	listInput := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String("folders/"),
+	}
+
+	var folders []*Folder
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, listInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list folder objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			if obj.Key == nil || !strings.HasSuffix(*obj.Key, ".json") {
+				continue
+			}
+
+			folderID := strings.TrimSuffix(strings.TrimPrefix(*obj.Key, "folders/"), ".json")
+			folder, err := s.GetFolder(ctx, folderID)
+			if err != nil {
+				log.Printf("Failed to load folder %s: %v", folderID, err)
+				continue
+			}
+
+			folders = append(folders, folder)
+		}
+	}
+
+	return folders, nil
+}
+
+// GetFolder загружает папку по идентификатору
+func (s *S3Storage) GetFolder(ctx context.Context, folderID string) (*Folder, error) {
+	if folderID == "" {
+		return RootFolder(), nil
+	}
+
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(fmt.Sprintf("folders/%s.json", folderID)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFolderNotFound, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read folder: %w", err)
+	}
+
+	var folder Folder
+	if err := json.Unmarshal(data, &folder); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal folder: %w", err)
+	}
+
+	return &folder, nil
+}
+
+// saveFolder сохраняет папку в S3
+func (s *S3Storage) saveFolder(ctx context.Context, folder *Folder) error {
+	data, err := json.Marshal(folder)
+	if err != nil {
+		return fmt.Errorf("failed to marshal folder: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(fmt.Sprintf("folders/%s.json", folder.ID)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save folder to S3: %w", err)
+	}
+
+	return nil
+}
+
+// FindFolderByPath ищет папку по полному пути
+func (s *S3Storage) FindFolderByPath(ctx context.Context, folderPath string) (*Folder, error) {
+	cleaned, err := CleanPath(folderPath)
+	if err != nil {
+		return nil, err
+	}
+	if cleaned == "/" {
+		return RootFolder(), nil
+	}
+
+	folders, err := s.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folder := range folders {
+		if folder.Path == cleaned {
+			return folder, nil
+		}
+	}
+
+	return nil, ErrFolderNotFound
+}
+
+// CreateFolder создает папку с указанным именем внутри родительской папки
+func (s *S3Storage) CreateFolder(ctx context.Context, parentID, name string) (*Folder, error) {
+	folderMu.Lock()
+	defer folderMu.Unlock()
+
+	folders, err := s.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createFolder(ctx, folders, parentID, name)
+}
+
+// createFolder создает папку, используя уже загруженный список папок
+func (s *S3Storage) createFolder(ctx context.Context, folders []*Folder, parentID, name string) (*Folder, error) {
+	name = strings.TrimSpace(name)
+	if err := validateFolderName(name); err != nil {
+		return nil, err
+	}
+
+	parent := RootFolder()
+	if parentID != "" {
+		parent = findFolder(folders, parentID)
+		if parent == nil {
+			return nil, ErrFolderNotFound
+		}
+	}
+
+	for _, folder := range folders {
+		if folder.ParentID == parentID && folder.Name == name {
+			return nil, ErrFolderExists
+		}
+	}
+
+	folder := &Folder{
+		ID:        uuid.New().String(),
+		Name:      name,
+		ParentID:  parentID,
+		Path:      JoinPath(parent.Path, name),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.saveFolder(ctx, folder); err != nil {
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+// EnsureFolderPath возвращает папку по пути, создавая недостающие уровни
+func (s *S3Storage) EnsureFolderPath(ctx context.Context, folderPath string) (*Folder, error) {
+	cleaned, err := CleanPath(folderPath)
+	if err != nil {
+		return nil, err
+	}
+	if cleaned == "/" {
+		return RootFolder(), nil
+	}
+
+	folderMu.Lock()
+	defer folderMu.Unlock()
+
+	folders, err := s.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := RootFolder()
+	for _, name := range strings.Split(strings.TrimPrefix(cleaned, "/"), "/") {
+		var next *Folder
+		for _, folder := range folders {
+			if folder.ParentID == current.ID && folder.Name == name {
+				next = folder
+				break
+			}
+		}
+
+		if next == nil {
+			next, err = s.createFolder(ctx, folders, current.ID, name)
+			if err != nil {
+				return nil, err
+			}
+			folders = append(folders, next)
+		}
+
+		current = next
+	}
+
+	return current, nil
+}
+
+// UpdateFolder переименовывает и/или перемещает папку. Пути вложенных папок
+// и файлов пересчитываются
+func (s *S3Storage) UpdateFolder(ctx context.Context, folderID string, newName, newParentID *string) (*Folder, error) {
+	folderMu.Lock()
+	defer folderMu.Unlock()
+
+	folders, err := s.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := findFolder(folders, folderID)
+	if folder == nil {
+		return nil, ErrFolderNotFound
+	}
+
+	name := folder.Name
+	if newName != nil {
+		name = strings.TrimSpace(*newName)
+		if err := validateFolderName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	parentID := folder.ParentID
+	if newParentID != nil {
+		parentID = *newParentID
+	}
+
+	parent := RootFolder()
+	if parentID != "" {
+		parent = findFolder(folders, parentID)
+		if parent == nil {
+			return nil, ErrFolderNotFound
+		}
+		// Нельзя переместить папку внутрь самой себя
+		if parent.ID == folder.ID || strings.HasPrefix(parent.Path+"/", folder.Path+"/") {
+			return nil, ErrInvalidPath
+		}
+	}
+
+	for _, other := range folders {
+		if other.ID != folder.ID && other.ParentID == parentID && other.Name == name {
+			return nil, ErrFolderExists
+		}
+	}
+
+	oldPath := folder.Path
+	folder.Name = name
+	folder.ParentID = parentID
+	folder.Path = JoinPath(parent.Path, name)
+
+	if err := s.saveFolder(ctx, folder); err != nil {
+		return nil, err
+	}
+
+	if oldPath == folder.Path {
+		return folder, nil
+	}
+
+	// Обновляем пути вложенных папок
+	moved := []*Folder{folder}
+	for _, other := range folders {
+		if strings.HasPrefix(other.Path, oldPath+"/") {
+			other.Path = folder.Path + strings.TrimPrefix(other.Path, oldPath)
+			if err := s.saveFolder(ctx, other); err != nil {
+				log.Printf("Failed to update path of folder %s: %v", other.ID, err)
+			}
+			moved = append(moved, other)
+		}
+	}
+
+	// Обновляем пути файлов перемещенных папок. Метаданные изменяются так же,
+	// как при PATCH, чтобы не потерять параллельные изменения
+	for _, dir := range moved {
+		fileIDs, err := s.filesInFolder(ctx, dir.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, fileID := range fileIDs {
+			_, err := s.UpdateMetadata(ctx, fileID, func(m *FileMetadata) error {
+				filePath := JoinPath(dir.Path, m.Filename)
+				if m.Path == filePath {
+					return ErrUnchanged
+				}
+				m.Path = filePath
+				return nil
+			})
+			if err != nil && !errors.Is(err, ErrFileNotFound) {
+				log.Printf("Failed to update path of file %s: %v", fileID, err)
+			}
+		}
+	}
+
+	return folder, nil
+}
+
+// ListFolderChildren возвращает вложенные папки и файлы папки
+func (s *S3Storage) ListFolderChildren(ctx context.Context, folderID string) ([]*Folder, []*FileMetadata, error) {
+	folders, err := s.ListFolders(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	childFolders := make([]*Folder, 0)
+	for _, folder := range folders {
+		if folder.ParentID == folderID {
+			childFolders = append(childFolders, folder)
+		}
+	}
+	sort.Slice(childFolders, func(i, j int) bool {
+		return childFolders[i].Name < childFolders[j].Name
+	})
+
+	fileIDs, err := s.filesInFolder(ctx, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := s.loadFiles(ctx, fileIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Запись индекса могла устареть, если ее не удалось удалить при переименовании
+	files = slices.DeleteFunc(files, func(m *FileMetadata) bool {
+		return m.FolderID != folderID
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Filename < files[j].Filename
+	})
+
+	return childFolders, files, nil
+}
+
+// FindFileByPath ищет файл по полному пути через индекс путей. Если в папке
+// несколько файлов с одинаковым именем (загруженных до запрета дубликатов),
+// возвращается самый свежий
+func (s *S3Storage) FindFileByPath(ctx context.Context, filePath string) (*FileMetadata, error) {
+	cleaned, err := CleanPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if cleaned == "/" {
+		return nil, ErrFileNotFound
+	}
+
+	dir, name := path.Split(cleaned)
+	folder, err := s.FindFolderByPath(ctx, dir)
+	if errors.Is(err, ErrFolderNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, cleaned)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fileIDs, err := s.filesByName(ctx, folder.ID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.loadFiles(ctx, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *FileMetadata
+	for _, meta := range files {
+		if meta.Path != cleaned {
+			continue
+		}
+		if found == nil || meta.UploadedAt.After(found.UploadedAt) {
+			found = meta
+		}
+	}
+
+	if found == nil {
+		return nil, ErrFileNotFound
+	}
+
+	return found, nil
+}
+
+// loadFiles загружает метаданные файлов из индекса. Файлы, удаленные после
+// чтения индекса, пропускаются
+func (s *S3Storage) loadFiles(ctx context.Context, fileIDs []string) ([]*FileMetadata, error) {
+	files := make([]*FileMetadata, 0, len(fileIDs))
+	for _, fileID := range fileIDs {
+		meta, err := s.loadMetadata(ctx, fileID)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, meta)
+	}
+	return files, nil
+}
+
+// findFolder ищет папку в списке по идентификатору
+func findFolder(folders []*Folder, folderID string) *Folder {
+	for _, folder := range folders {
+		if folder.ID == folderID {
+			return folder
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "/", false},
+		{"  ", "/", false},
+		{"/", "/", false},
+		{"projects/alpha", "/projects/alpha", false},
+		{" /projects/alpha/ ", "/projects/alpha", false},
+		{"//projects///alpha", "/projects/alpha", false},
+		{"/projects/../etc", "", true},
+		{"./projects", "", true},
+		{"/projects/..", "", true},
+		{"/projects/..hidden", "/projects/..hidden", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := CleanPath(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Errorf("CleanPath(%q) error = %v, want ErrInvalidPath", tt.input, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("CleanPath(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		dir, name, want string
+	}{
+		{"", "a.txt", "/a.txt"},
+		{"/", "a.txt", "/a.txt"},
+		{"/projects", "a.txt", "/projects/a.txt"},
+	}
+
+	for _, tt := range tests {
+		if got := JoinPath(tt.dir, tt.name); got != tt.want {
+			t.Errorf("JoinPath(%q, %q) = %q, want %q", tt.dir, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFolderName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"projects", false},
+		{"отчеты 2024", false},
+		{"..hidden", false},
+		{"", true},
+		{".", true},
+		{"..", true},
+		{"a/b", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateFolderName(tt.name); tt.wantErr != (err != nil) {
+			t.Errorf("validateFolderName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIndexKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"root folder", pathIndexKey(&FileMetadata{ID: "f1", Filename: "a.txt"}), "index/paths/root/a.txt/f1"},
+		{"nested folder", pathIndexKey(&FileMetadata{ID: "f1", FolderID: "d1", Filename: "a.txt"}), "index/paths/d1/a.txt/f1"},
+		{"escaped name", pathIndexDir("d1", "my report/2024?.txt"), "index/paths/d1/my%20report%2F2024%3F.txt/"},
+		{"escaped tag", tagIndexKey("a/b c", "f1"), "index/tags/a%2Fb%20c/f1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("key = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// pathIndexPrefix индекс имен файлов по папкам: ключ
+	// index/paths/{id папки или root}/{имя}/{id файла}. Позволяет найти файл по
+	// пути и получить содержимое папки одним листингом, не загружая метаданные
+	// всех файлов
+	pathIndexPrefix = "index/paths/"
+	// tagIndexPrefix индекс файлов по тегам: ключ index/tags/{тег}/{id файла}.
+	// Позволяет отфильтровать файлы по тегу, не загружая метаданные всех файлов
+	tagIndexPrefix = "index/tags/"
+	// indexMarker отметка о построении индексов для файлов, загруженных до
+	// их появления
+	indexMarker = "index/built.json"
+	// rootIndexName имя корневой папки в ключах индекса
+	rootIndexName = "root"
+)
+
+var (
+	// ErrFileExists возвращается, если в папке уже есть файл с таким именем
+	ErrFileExists = errors.New("file already exists")
+	// ErrTooManyFiles возвращается, если фильтру соответствует больше файлов,
+	// чем разрешено
+	ErrTooManyFiles = errors.New("too many files match the filter")
+)
+
+// pathMu сериализует проверку и резервирование имен файлов внутри процесса
+var pathMu sync.Mutex
+
+// indexMarkerData содержимое отметки о построении индексов
+type indexMarkerData struct {
+	BuiltAt time.Time `json:"built_at"`
+}
+
+// pathIndexDir возвращает префикс индекса для имени файла в папке
+func pathIndexDir(folderID, filename string) string {
+	if folderID == "" {
+		folderID = rootIndexName
+	}
+	return pathIndexPrefix + folderID + "/" + url.PathEscape(filename) + "/"
+}
+
+// pathIndexKey возвращает ключ индекса для файла
+func pathIndexKey(m *FileMetadata) string {
+	return pathIndexDir(m.FolderID, m.Filename) + m.ID
+}
+
+// folderIndexPrefix возвращает префикс индекса для всех файлов папки
+func folderIndexPrefix(folderID string) string {
+	if folderID == "" {
+		folderID = rootIndexName
+	}
+	return pathIndexPrefix + folderID + "/"
+}
+
+// filesByName возвращает идентификаторы файлов с именем filename в папке
+func (s *S3Storage) filesByName(ctx context.Context, folderID, filename string) ([]string, error) {
+	keys, err := s.ListKeys(ctx, pathIndexDir(folderID, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, path.Base(key))
+	}
+	return ids, nil
+}
+
+// filesInFolder возвращает идентификаторы файлов папки
+func (s *S3Storage) filesInFolder(ctx context.Context, folderID string) ([]string, error) {
+	keys, err := s.ListKeys(ctx, folderIndexPrefix(folderID))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, path.Base(key))
+	}
+	return ids, nil
+}
+
+// reservePath проверяет, что в папке нет другого файла с тем же именем,
+// и записывает файл в индекс. Если имя занято, возвращается ErrFileExists
+func (s *S3Storage) reservePath(ctx context.Context, m *FileMetadata) error {
+	pathMu.Lock()
+	defer pathMu.Unlock()
+
+	ids, err := s.filesByName(ctx, m.FolderID, m.Filename)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id != m.ID {
+			return fmt.Errorf("%w: %s", ErrFileExists, m.Path)
+		}
+	}
+
+	return s.PutObject(ctx, pathIndexKey(m), nil, "application/octet-stream")
+}
+
+// releasePath удаляет файл из индекса
+func (s *S3Storage) releasePath(ctx context.Context, m *FileMetadata) {
+	if err := s.DeleteObject(ctx, pathIndexKey(m)); err != nil {
+		log.Printf("Failed to remove file %s from path index: %v", m.ID, err)
+	}
+}
+
+// tagIndexKey возвращает ключ индекса тегов для файла
+func tagIndexKey(tag, fileID string) string {
+	return tagIndexPrefix + url.PathEscape(tag) + "/" + fileID
+}
+
+// indexTags добавляет файл в индекс тегов
+func (s *S3Storage) indexTags(ctx context.Context, fileID string, tags []string) error {
+	for _, tag := range tags {
+		if err := s.PutObject(ctx, tagIndexKey(tag, fileID), nil, "application/octet-stream"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateTagIndex приводит индекс тегов файла в соответствие с его новыми тегами
+func (s *S3Storage) updateTagIndex(ctx context.Context, fileID string, previous, current []string) {
+	for _, tag := range current {
+		if !slices.Contains(previous, tag) {
+			if err := s.indexTags(ctx, fileID, []string{tag}); err != nil {
+				log.Printf("Failed to add file %s to tag index: %v", fileID, err)
+			}
+		}
+	}
+	for _, tag := range previous {
+		if !slices.Contains(current, tag) {
+			if err := s.DeleteObject(ctx, tagIndexKey(tag, fileID)); err != nil {
+				log.Printf("Failed to remove file %s from tag index: %v", fileID, err)
+			}
+		}
+	}
+}
+
+// FindFilesByTags возвращает файлы, имеющие все указанные теги, по индексу
+// тегов. Если limit больше нуля и файлов больше limit, возвращается
+// ErrTooManyFiles без загрузки метаданных
+func (s *S3Storage) FindFilesByTags(ctx context.Context, tags []string, limit int) ([]*FileMetadata, error) {
+	var fileIDs []string
+	for i, tag := range tags {
+		keys, err := s.ListKeys(ctx, tagIndexPrefix+url.PathEscape(tag)+"/")
+		if err != nil {
+			return nil, err
+		}
+
+		tagged := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			tagged[path.Base(key)] = true
+		}
+		if i == 0 {
+			for fileID := range tagged {
+				fileIDs = append(fileIDs, fileID)
+			}
+			continue
+		}
+		fileIDs = slices.DeleteFunc(fileIDs, func(fileID string) bool {
+			return !tagged[fileID]
+		})
+	}
+
+	if limit > 0 && len(fileIDs) > limit {
+		return nil, fmt.Errorf("%w: %d files, the limit is %d", ErrTooManyFiles, len(fileIDs), limit)
+	}
+
+	files, err := s.loadFiles(ctx, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	// Запись индекса могла устареть, если ее не удалось удалить при изменении тегов
+	return FilterByTags(files, tags), nil
+}
+
+// EnsureIndexes строит индексы путей и тегов для файлов, загруженных до их
+// появления. Выполняется один раз: новые файлы попадают в индексы при загрузке
+func (s *S3Storage) EnsureIndexes(ctx context.Context) error {
+	var marker indexMarkerData
+	err := s.GetJSON(ctx, indexMarker, &marker)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+
+	log.Printf("Building file path and tag indexes")
+	count := 0
+	err = s.WalkMetadata(ctx, func(m *FileMetadata) error {
+		count++
+		if err := s.PutObject(ctx, pathIndexKey(m), nil, "application/octet-stream"); err != nil {
+			return err
+		}
+		return s.indexTags(ctx, m.ID, m.Tags)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build indexes: %w", err)
+	}
+	log.Printf("File indexes built for %d files", count)
+
+	return s.PutJSON(ctx, indexMarker, indexMarkerData{BuiltAt: time.Now().UTC()})
+}
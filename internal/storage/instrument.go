@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"file-agent/internal/metrics"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// instrumentS3 добавляет в стек запросов S3 учет длительности и ошибок
+// по операциям (PutObject, GetObject, ListObjectsV2 и т.д.)
+func instrumentS3(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FileAgentMetrics",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			operation := awsmiddleware.GetOperationName(ctx)
+			start := time.Now()
+
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			metrics.S3Duration.Observe(time.Since(start).Seconds(), operation)
+			if err != nil {
+				metrics.S3Errors.Inc(operation, errorCode(err))
+			}
+			return out, metadata, err
+		}), middleware.After)
+}
+
+// errorCode возвращает код ошибки S3 (NoSuchKey, SlowDown и т.п.)
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.ErrorCode()
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "Canceled"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SniffLength количество первых байт файла, используемых для определения типа
+const SniffLength = 512
+
+// DefaultContentType тип по умолчанию для неизвестных файлов
+const DefaultContentType = "application/octet-stream"
+
+var (
+	contentTypesMu sync.RWMutex
+
+	// contentTypes таблица MIME-типов по расширениям (без точки, в нижнем регистре)
+	contentTypes = map[string]string{
+		// Изображения
+		"jpg": "image/jpeg", "jpeg": "image/jpeg", "jpe": "image/jpeg",
+		"png": "image/png", "gif": "image/gif", "webp": "image/webp",
+		"bmp": "image/bmp", "ico": "image/vnd.microsoft.icon", "svg": "image/svg+xml",
+		"tif": "image/tiff", "tiff": "image/tiff", "heic": "image/heic", "heif": "image/heif",
+		"avif": "image/avif", "psd": "image/vnd.adobe.photoshop",
+
+		// Документы
+		"pdf":  "application/pdf",
+		"doc":  "application/msword",
+		"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"xls":  "application/vnd.ms-excel",
+		"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"ppt":  "application/vnd.ms-powerpoint",
+		"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"odt":  "application/vnd.oasis.opendocument.text",
+		"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+		"odp":  "application/vnd.oasis.opendocument.presentation",
+		"rtf":  "application/rtf",
+		"epub": "application/epub+zip",
+
+		// Текст и данные
+		"txt": "text/plain", "log": "text/plain", "md": "text/markdown",
+		"csv": "text/csv", "tsv": "text/tab-separated-values",
+		"json": "application/json", "ndjson": "application/x-ndjson", "jsonl": "application/x-ndjson",
+		"xml": "application/xml", "yaml": "application/yaml", "yml": "application/yaml",
+		"toml": "application/toml", "ini": "text/plain", "sql": "application/sql",
+		"html": "text/html", "htm": "text/html", "css": "text/css",
+		"js": "application/javascript", "mjs": "application/javascript",
+		"ics": "text/calendar", "vcf": "text/vcard",
+
+		// Архивы
+		"zip": "application/zip", "gz": "application/gzip", "tgz": "application/gzip",
+		"tar": "application/x-tar", "bz2": "application/x-bzip2", "xz": "application/x-xz",
+		"7z": "application/x-7z-compressed", "rar": "application/vnd.rar", "zst": "application/zstd",
+
+		// Аудио
+		"mp3": "audio/mpeg", "wav": "audio/wav", "ogg": "audio/ogg", "oga": "audio/ogg",
+		"flac": "audio/flac", "m4a": "audio/mp4", "aac": "audio/aac", "opus": "audio/opus",
+		"mid": "audio/midi", "midi": "audio/midi",
+
+		// Видео
+		"mp4": "video/mp4", "m4v": "video/mp4", "mov": "video/quicktime", "webm": "video/webm",
+		"mkv": "video/x-matroska", "avi": "video/x-msvideo", "ogv": "video/ogg",
+		"mpeg": "video/mpeg", "mpg": "video/mpeg", "3gp": "video/3gpp",
+
+		// Шрифты
+		"ttf": "font/ttf", "otf": "font/otf", "woff": "font/woff", "woff2": "font/woff2",
+
+		// Исполняемые файлы и пакеты
+		"exe": "application/vnd.microsoft.portable-executable",
+		"dll": "application/vnd.microsoft.portable-executable",
+		"msi": "application/x-msi", "apk": "application/vnd.android.package-archive",
+		"jar": "application/java-archive", "deb": "application/vnd.debian.binary-package",
+		"rpm": "application/x-rpm", "dmg": "application/x-apple-diskimage",
+		"iso": "application/x-iso9660-image", "wasm": "application/wasm",
+		"sh": "application/x-sh", "bat": "application/x-bat", "ps1": "text/plain",
+		"sqlite": "application/vnd.sqlite3", "db": "application/vnd.sqlite3",
+	}
+)
+
+// magicSignature описывает сигнатуру формата, которую не распознает http.DetectContentType
+type magicSignature struct {
+	offset      int
+	magic       []byte
+	contentType string
+}
+
+var magicSignatures = []magicSignature{
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\xFD7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xB5\x2F\xFD"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{0, []byte("{\\rtf"), "application/rtf"},
+	{0, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "application/x-ole-storage"},
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{0, []byte("\x7FELF"), "application/x-executable"},
+	{0, []byte("\xCF\xFA\xED\xFE"), "application/x-mach-binary"},
+	{0, []byte("\xCA\xFE\xBA\xBE"), "application/java-vm"},
+	{0, []byte("\x1A\x45\xDF\xA3"), "video/x-matroska"},
+}
+
+// ftypBrands сопоставляет бренд ISO BMFF контейнера (ftyp) с MIME-типом
+var ftypBrands = map[string]string{
+	"heic": "image/heic", "heix": "image/heic", "mif1": "image/heif", "msf1": "image/heif",
+	"avif": "image/avif", "M4A ": "audio/mp4", "M4B ": "audio/mp4",
+	"qt  ": "video/quicktime", "3gp4": "video/3gpp", "3gp5": "video/3gpp",
+}
+
+// zipBasedTypes форматы, которые хранятся в ZIP-контейнере
+var zipBasedTypes = map[string]bool{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+	"application/epub+zip":                    true,
+	"application/java-archive":                true,
+	"application/vnd.android.package-archive": true,
+}
+
+// oleBasedTypes форматы, которые хранятся в OLE2-контейнере
+var oleBasedTypes = map[string]bool{
+	"application/msword":            true,
+	"application/vnd.ms-excel":      true,
+	"application/vnd.ms-powerpoint": true,
+	"application/x-msi":             true,
+}
+
+// RegisterContentType добавляет или переопределяет MIME-тип для расширения
+func RegisterContentType(ext, contentType string) {
+	ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+	if ext == "" || contentType == "" {
+		return
+	}
+
+	contentTypesMu.Lock()
+	defer contentTypesMu.Unlock()
+	contentTypes[ext] = contentType
+}
+
+// LoadContentTypes загружает дополнительные типы из строки вида
+// "ext=type,ext=type" (переменная окружения MIME_TYPES)
+func LoadContentTypes(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ext, contentType, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid MIME type mapping %q", pair)
+		}
+		RegisterContentType(ext, strings.TrimSpace(contentType))
+	}
+	return nil
+}
+
+// LoadContentTypesFile загружает типы из файла в формате mime.types:
+// "type ext1 ext2 ...", строки с # игнорируются
+func LoadContentTypesFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open MIME types file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for _, ext := range fields[1:] {
+			RegisterContentType(ext, fields[0])
+		}
+	}
+
+	return scanner.Err()
+}
+
+// GetContentType определяет content type файла по расширению
+func GetContentType(filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if ext == "" {
+		return DefaultContentType
+	}
+
+	contentTypesMu.RLock()
+	contentType, ok := contentTypes[ext]
+	contentTypesMu.RUnlock()
+	if ok {
+		return contentType
+	}
+
+	// Системная таблица (/etc/mime.types и встроенные типы Go)
+	if contentType := mime.TypeByExtension("." + ext); contentType != "" {
+		return mediaType(contentType)
+	}
+
+	return DefaultContentType
+}
+
+// DetectContentType определяет тип по первым байтам файла (сигнатуры
+// и http.DetectContentType), уточняя общие типы по расширению имени
+func DetectContentType(head []byte, filename string) string {
+	detected := sniffContentType(head)
+
+	byExt := GetContentType(filename)
+	if byExt != DefaultContentType && refinesTo(detected, byExt) {
+		return byExt
+	}
+
+	return detected
+}
+
+// refinesTo проверяет, можно ли уточнить тип, определенный по содержимому,
+// типом из расширения. Текстовые форматы различаются только расширением,
+// а контейнеры (zip, ole) уточняются до форматов на их основе (docx, xls и т.п.).
+// Расширение не может выдать один формат за другой, например zip за pdf
+func refinesTo(detected, byExt string) bool {
+	switch detected {
+	case DefaultContentType:
+		return true
+	case "text/plain", "application/xml", "text/xml":
+		return IsTextual(byExt)
+	case "application/zip":
+		return zipBasedTypes[byExt]
+	case "application/x-ole-storage":
+		return oleBasedTypes[byExt]
+	}
+	return false
+}
+
+// sniffContentType определяет тип только по содержимому
+func sniffContentType(head []byte) string {
+	if len(head) == 0 {
+		return DefaultContentType
+	}
+
+	for _, sig := range magicSignatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.contentType
+		}
+	}
+
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if contentType, ok := ftypBrands[string(head[8:12])]; ok {
+			return contentType
+		}
+	}
+
+	return mediaType(http.DetectContentType(head))
+}
+
+// IsTextual проверяет, что тип представляет текстовые данные
+func IsTextual(contentType string) bool {
+	if strings.HasPrefix(contentType, "text/") {
+		return true
+	}
+	switch contentType {
+	case "application/json", "application/x-ndjson", "application/xml", "application/yaml",
+		"application/toml", "application/sql", "application/javascript", "image/svg+xml",
+		"application/x-sh", "application/x-bat":
+		return true
+	}
+	return false
+}
+
+// mediaType убирает параметры (например charset) из content type
+func mediaType(contentType string) string {
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		return parsed
+	}
+	return contentType
+}
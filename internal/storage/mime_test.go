@@ -0,0 +1,104 @@
+package storage
+
+import "testing"
+
+func TestDetectContentType(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+
+	tests := []struct {
+		name     string
+		head     []byte
+		filename string
+		want     string
+	}{
+		{"png by content", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image.png", "image/png"},
+		{"exe renamed to jpg", []byte("MZ\x90\x00\x03\x00\x00\x00"), "photo.jpg", "application/vnd.microsoft.portable-executable"},
+		{"zip renamed to pdf", []byte("PK\x03\x04\x14\x00\x00\x00"), "report.pdf", "application/zip"},
+		{"zip refined to docx", []byte("PK\x03\x04\x14\x00\x00\x00"), "report.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"ole refined to xls", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "sheet.xls", "application/vnd.ms-excel"},
+		{"ole not refined to docx", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "sheet.docx", "application/x-ole-storage"},
+		{"text refined to csv", []byte("a,b\n1,2\n"), "data.csv", "text/csv"},
+		{"text refined to json", []byte(`{"a": 1}`), "data.json", "application/json"},
+		{"xml refined to svg", []byte(`<?xml version="1.0"?><svg></svg>`), "logo.svg", "image/svg+xml"},
+		{"html not downgraded to txt", []byte("<html><body>hi</body></html>"), "page.txt", "text/html"},
+		{"text not upgraded to binary", []byte("hello world"), "hello.exe", "text/plain"},
+		{"empty file by extension", nil, "notes.txt", "text/plain"},
+		{"unknown binary by extension", []byte("\x00\x01\x02\x03"), "archive.rar", "application/vnd.rar"},
+		{"unknown binary without extension", []byte("\x00\x01\x02\x03"), "blob", DefaultContentType},
+		{"tar at offset", tar, "backup", "application/x-tar"},
+		{"heic brand", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "IMG_0001", "image/heic"},
+		{"7z signature", []byte("7z\xBC\xAF\x27\x1C\x00\x04"), "data.bin", "application/x-7z-compressed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentType(tt.head, tt.filename); got != tt.want {
+				t.Errorf("DetectContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefinesTo(t *testing.T) {
+	tests := []struct {
+		detected, byExt string
+		want            bool
+	}{
+		{DefaultContentType, "application/pdf", true},
+		{"text/plain", "text/markdown", true},
+		{"text/plain", "application/yaml", true},
+		{"text/plain", "application/pdf", false},
+		{"text/xml", "image/svg+xml", true},
+		{"application/zip", "application/epub+zip", true},
+		{"application/zip", "application/pdf", false},
+		{"application/x-ole-storage", "application/msword", true},
+		{"image/png", "image/jpeg", false},
+		{"text/html", "text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.detected+"->"+tt.byExt, func(t *testing.T) {
+			if got := refinesTo(tt.detected, tt.byExt); got != tt.want {
+				t.Errorf("refinesTo(%q, %q) = %v, want %v", tt.detected, tt.byExt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetContentType(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"photo.jpg", "image/jpeg"},
+		{"PHOTO.JPG", "image/jpeg"},
+		{"archive.tar.gz", "application/gzip"},
+		{"README", DefaultContentType},
+		{"dir.d/file", DefaultContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := GetContentType(tt.filename); got != tt.want {
+				t.Errorf("GetContentType(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadContentTypes(t *testing.T) {
+	if err := LoadContentTypes(" .Testa = application/x-test-a ,testb=text/x-test-b,"); err != nil {
+		t.Fatalf("LoadContentTypes() error = %v", err)
+	}
+	if got := GetContentType("file.TESTA"); got != "application/x-test-a" {
+		t.Errorf("GetContentType(file.TESTA) = %q", got)
+	}
+	if got := GetContentType("file.testb"); got != "text/x-test-b" {
+		t.Errorf("GetContentType(file.testb) = %q", got)
+	}
+
+	if err := LoadContentTypes("testc"); err == nil {
+		t.Error("LoadContentTypes() accepted a mapping without a type")
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrObjectNotFound возвращается, если объекта нет в бакете
+var ErrObjectNotFound = errors.New("object not found")
+
+// PutJSON сохраняет значение в бакет как JSON-объект
+func (s *S3Storage) PutJSON(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save %s to S3: %w", key, err)
+	}
+
+	return nil
+}
+
+// GetJSON загружает JSON-объект из бакета в value
+func (s *S3Storage) GetJSON(ctx context.Context, key string, value interface{}) error {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return fmt.Errorf("failed to get %s from S3: %w", key, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// ObjectInfo сведения об объекте в бакете (миниатюры, кэш, статистика)
+type ObjectInfo struct {
+	ContentType string
+	Size        int64
+	ETag        string
+}
+
+// PutObject сохраняет производный объект с указанным типом
+func (s *S3Storage) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save %s to S3: %w", key, err)
+	}
+	return nil
+}
+
+// GetObject открывает объект из бакета
+func (s *S3Storage) GetObject(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return nil, nil, fmt.Errorf("failed to get %s from S3: %w", key, err)
+	}
+
+	info := &ObjectInfo{
+		ContentType: aws.ToString(result.ContentType),
+		Size:        aws.ToInt64(result.ContentLength),
+	}
+
+	return result.Body, info, nil
+}
+
+// StatObject возвращает сведения об объекте без загрузки содержимого
+func (s *S3Storage) StatObject(ctx context.Context, key string) (*ObjectInfo, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to stat %s in S3: %w", key, err)
+	}
+
+	return &ObjectInfo{
+		ContentType: aws.ToString(result.ContentType),
+		Size:        aws.ToInt64(result.ContentLength),
+		ETag:        aws.ToString(result.ETag),
+	}, nil
+}
+
+// DeleteObject удаляет объект из бакета
+func (s *S3Storage) DeleteObject(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from S3: %w", key, err)
+	}
+	return nil
+}
+
+// ListKeys возвращает ключи всех объектов с указанным префиксом
+func (s *S3Storage) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	return s.ListKeysAfter(ctx, prefix, "")
+}
+
+// ListKeysAfter возвращает ключи объектов с указанным префиксом, следующие
+// за startAfter в лексикографическом порядке (пустой startAfter - все ключи)
+func (s *S3Storage) ListKeysAfter(ctx context.Context, prefix, startAfter string) ([]string, error) {
+	listInput := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+	if startAfter != "" {
+		listInput.StartAfter = aws.String(startAfter)
+	}
+
+	var keys []string
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, listInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects with prefix %s: %w", prefix, err)
+		}
+
+		for _, obj := range page.Contents {
+			if obj.Key != nil {
+				keys = append(keys, *obj.Key)
+			}
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// rangeBlockSize размер блока, читаемого одним запросом с заголовком Range
+	rangeBlockSize = 1 << 20
+	// rangeCacheBlocks сколько последних блоков хранится в памяти
+	rangeCacheBlocks = 8
+)
+
+// FileReaderAt читает файл из бакета блоками через HTTP Range, не скачивая
+// его целиком. Последние прочитанные блоки кэшируются, поэтому мелкие
+// последовательные чтения (центральный каталог ZIP, заголовки TAR) не
+// порождают отдельный запрос на каждое
+type FileReaderAt struct {
+	storage *S3Storage
+	ctx     context.Context
+	key     string
+	size    int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+// OpenFileAt открывает файл для чтения с произвольной позиции
+func (s *S3Storage) OpenFileAt(ctx context.Context, fileID string, size int64) *FileReaderAt {
+	return &FileReaderAt{
+		storage: s,
+		ctx:     ctx,
+		key:     fmt.Sprintf("files/%s", fileID),
+		size:    size,
+		blocks:  make(map[int64][]byte),
+	}
+}
+
+// Size возвращает размер файла
+func (f *FileReaderAt) Size() int64 {
+	return f.size
+}
+
+// ReadAt реализует io.ReaderAt
+func (f *FileReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= f.size {
+			return n, io.EOF
+		}
+
+		index := pos / rangeBlockSize
+		block, err := f.block(index)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos-index*rangeBlockSize:])
+	}
+
+	return n, nil
+}
+
+// block возвращает блок из кэша или загружает его
+func (f *FileReaderAt) block(index int64) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if block, ok := f.blocks[index]; ok {
+		return block, nil
+	}
+
+	start := index * rangeBlockSize
+	end := min(start+rangeBlockSize, f.size) - 1
+
+	result, err := f.storage.client.GetObject(f.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(f.storage.bucket),
+		Key:    aws.String(f.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read range of %s: %w", f.key, err)
+	}
+	defer result.Body.Close()
+
+	block := make([]byte, end-start+1)
+	if _, err := io.ReadFull(result.Body, block); err != nil {
+		return nil, fmt.Errorf("failed to read range of %s: %w", f.key, err)
+	}
+
+	// Вытесняем самый старый блок
+	if len(f.order) >= rangeCacheBlocks {
+		delete(f.blocks, f.order[0])
+		f.order = f.order[1:]
+	}
+	f.blocks[index] = block
+	f.order = append(f.order, index)
+
+	return block, nil
+}
@@ -4,16 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Storage представляет S3-совместимое хранилище
@@ -22,6 +25,15 @@ type S3Storage struct {
 	bucket string
 }
 
+// metadataMu сериализует изменения метаданных внутри процесса. Между
+// экземплярами сервиса изменения не синхронизируются, поэтому проверка
+// ревизии (If-Match) надежна только при одном экземпляре
+var metadataMu sync.Mutex
+
+// ErrUnchanged возвращается функцией обновления метаданных, если изменять
+// нечего: метаданные не сохраняются, ревизия не увеличивается
+var ErrUnchanged = errors.New("metadata unchanged")
+
 // FileMetadata содержит метаданные загруженного файла
 type FileMetadata struct {
 	ID         string    `json:"id"`
@@ -29,6 +41,48 @@ type FileMetadata struct {
 	Size       int64     `json:"size"`
 	UploadedAt time.Time `json:"uploaded_at"`
 	UploadedBy string    `json:"uploaded_by,omitempty"` // Информация о том, кто загрузил (опционально)
+	Owner      string    `json:"owner,omitempty"`       // Пользователь, загрузивший файл; по нему считаются квоты, не изменяется
+	FolderID   string    `json:"folder_id,omitempty"`   // Идентификатор папки (пусто для корня)
+	Path       string    `json:"path,omitempty"`        // Полный путь файла в виртуальном дереве
+
+	ContentType         string `json:"content_type,omitempty"`          // Тип, определенный по содержимому и расширению
+	DeclaredContentType string `json:"declared_content_type,omitempty"` // Тип, указанный клиентом при загрузке
+	Charset             string `json:"charset,omitempty"`               // Кодировка текстового файла
+
+	ScanStatus    string     `json:"scan_status,omitempty"`    // Результат антивирусной проверки
+	ScanSignature string     `json:"scan_signature,omitempty"` // Найденная сигнатура
+	ScannedAt     *time.Time `json:"scanned_at,omitempty"`     // Время последней проверки
+
+	Status     string                      `json:"status,omitempty"`     // Статус обработки: pending, processing, ready, failed
+	Processing map[string]*ProcessorResult `json:"processing,omitempty"` // Результаты обработчиков
+
+	Attributes map[string]interface{} `json:"attributes,omitempty"` // Атрибуты по типу файла: размеры, страницы, длительность и т.п.
+
+	MetadataStripped bool     `json:"metadata_stripped,omitempty"` // Метаданные изображения удалены при загрузке
+	StrippedMetadata []string `json:"stripped_metadata,omitempty"` // Виды удаленных метаданных: exif, xmp, iptc, comment, text
+	OrientationFixed bool     `json:"orientation_fixed,omitempty"` // Ориентация из EXIF применена к пикселям
+
+	Tags []string          `json:"tags,omitempty"` // Теги для поиска и фильтрации
+	Meta map[string]string `json:"meta,omitempty"` // Пользовательские метаданные (meta.* поля формы)
+
+	Revision  int64      `json:"revision"`             // Номер ревизии, увеличивается при каждом изменении
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // Время последнего изменения метаданных
+}
+
+// Статусы антивирусной проверки
+const (
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+)
+
+// Quarantined проверяет, помещен ли файл в карантин
+func (m *FileMetadata) Quarantined() bool {
+	return m.ScanStatus == ScanStatusInfected
+}
+
+// ETag возвращает ETag метаданных, основанный на номере ревизии
+func (m *FileMetadata) ETag() string {
+	return fmt.Sprintf("\"%d\"", m.Revision)
 }
 
 // NewS3Storage создает новый S3Storage
@@ -56,6 +110,7 @@ func NewS3Storage(endpoint, accessKey, secretKey, bucket string) (*S3Storage, er
 
 	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
 		o.UsePathStyle = true // Важно для Minio
+		o.APIOptions = append(o.APIOptions, instrumentS3)
 	})
 
 	storage := &S3Storage{
@@ -79,39 +134,53 @@ func (s *S3Storage) checkBucket(ctx context.Context) error {
 	return err
 }
 
-// SaveFile сохраняет файл в S3
-func (s *S3Storage) SaveFile(ctx context.Context, fileID, filename string, content io.Reader, size int64, uploadedBy string) error {
+// SaveFile сохраняет файл в S3. Метаданные дополняются временем загрузки
+// и путем в виртуальном дереве папок. Если в папке уже есть файл с таким
+// именем, возвращается ErrFileExists
+func (s *S3Storage) SaveFile(ctx context.Context, metadata *FileMetadata, content io.Reader) error {
+	if metadata.Path == "" {
+		metadata.Path = JoinPath("/", metadata.Filename)
+	}
+
+	// Имя резервируется до загрузки содержимого
+	if err := s.reservePath(ctx, metadata); err != nil {
+		return err
+	}
+
 	// Определяем ключ для файла
-	fileKey := fmt.Sprintf("files/%s", fileID)
+	fileKey := fmt.Sprintf("files/%s", metadata.ID)
 
 	// Загружаем файл в S3
 	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:        aws.String(s.bucket),
 		Key:           aws.String(fileKey),
 		Body:          content,
-		ContentLength: aws.Int64(size),
+		ContentLength: aws.Int64(metadata.Size),
+		ContentType:   aws.String(metadata.ContentType),
 		Metadata: map[string]string{
-			"original-filename": filename,
+			"original-filename": metadata.Filename,
 		},
 	})
 
 	if err != nil {
+		s.releasePath(ctx, metadata)
 		return fmt.Errorf("failed to upload file to S3: %w", err)
 	}
 
 	// Сохраняем метаданные отдельно
-	metadata := FileMetadata{
-		ID:         fileID,
-		Filename:   filename,
-		Size:       size,
-		UploadedAt: time.Now().UTC(),
-		UploadedBy: uploadedBy,
+	metadata.UploadedAt = time.Now().UTC()
+	metadata.Revision = 1
+	if metadata.Status == "" {
+		metadata.Status = StatusReady
 	}
 
-	if err := s.saveMetadata(ctx, metadata); err != nil {
-		log.Printf("Failed to save metadata for file %s: %v", fileID, err)
+	if err := s.saveMetadata(ctx, *metadata); err != nil {
+		log.Printf("Failed to save metadata for file %s: %v", metadata.ID, err)
 		// Не возвращаем ошибку, так как файл уже загружен
 	}
+	if err := s.indexTags(ctx, metadata.ID, metadata.Tags); err != nil {
+		log.Printf("Failed to add file %s to tag index: %v", metadata.ID, err)
+	}
 
 	return nil
 }
@@ -173,6 +242,10 @@ func (s *S3Storage) loadMetadata(ctx context.Context, fileID string) (*FileMetad
 	})
 
 	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, fileID)
+		}
 		return nil, fmt.Errorf("failed to get metadata from S3: %w", err)
 	}
 	defer result.Body.Close()
@@ -187,9 +260,134 @@ func (s *S3Storage) loadMetadata(ctx context.Context, fileID string) (*FileMetad
 		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
 	}
 
+	// Файлы, загруженные до появления папок, находятся в корне
+	if metadata.Path == "" {
+		metadata.Path = JoinPath("/", metadata.Filename)
+	}
+
+	// Файлы, загруженные до появления обработки, считаются готовыми
+	if metadata.Status == "" {
+		metadata.Status = StatusReady
+	}
+
+	// Для старых файлов тип определяется по расширению
+	if metadata.ContentType == "" {
+		metadata.ContentType = GetContentType(metadata.Filename)
+	}
+
 	return &metadata, nil
 }
 
+// UpdateMetadata загружает метаданные файла, применяет к ним update и сохраняет
+// результат с новым номером ревизии. Обновления одного процесса выполняются
+// последовательно, поэтому update может проверять текущую ревизию. Если update
+// возвращает ErrUnchanged, метаданные возвращаются без сохранения. Отсутствие
+// файла возвращается как ErrFileNotFound, переименование в занятое имя - как
+// ErrFileExists, остальные ошибки S3 - как есть
+func (s *S3Storage) UpdateMetadata(ctx context.Context, fileID string, update func(*FileMetadata) error) (*FileMetadata, error) {
+	return s.updateMetadata(ctx, fileID, update, true)
+}
+
+// UpdateSystemMetadata изменяет служебные поля метаданных (статус и
+// результаты обработки, антивирусной проверки) так же, как UpdateMetadata,
+// но без новой ревизии: ETag, полученный клиентом для If-Match, остается верным
+func (s *S3Storage) UpdateSystemMetadata(ctx context.Context, fileID string, update func(*FileMetadata) error) (*FileMetadata, error) {
+	return s.updateMetadata(ctx, fileID, update, false)
+}
+
+// updateMetadata загружает, изменяет и сохраняет метаданные под metadataMu.
+// revise задает, увеличивается ли номер ревизии
+func (s *S3Storage) updateMetadata(ctx context.Context, fileID string, update func(*FileMetadata) error, revise bool) (*FileMetadata, error) {
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+
+	metadata, err := s.loadMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	previous := *metadata
+
+	if err := update(metadata); err != nil {
+		if errors.Is(err, ErrUnchanged) {
+			return metadata, nil
+		}
+		return nil, err
+	}
+
+	// Новое имя резервируется в индексе путей до сохранения метаданных
+	renamed := previous.FolderID != metadata.FolderID || previous.Filename != metadata.Filename
+	if renamed {
+		if err := s.reservePath(ctx, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	if revise {
+		now := time.Now().UTC()
+		metadata.Revision++
+		metadata.UpdatedAt = &now
+	}
+
+	if err := s.saveMetadata(ctx, *metadata); err != nil {
+		if renamed {
+			s.releasePath(ctx, metadata)
+		}
+		return nil, err
+	}
+	if renamed {
+		s.releasePath(ctx, &previous)
+	}
+	s.updateTagIndex(ctx, fileID, previous.Tags, metadata.Tags)
+
+	return metadata, nil
+}
+
+// DeleteFile удаляет файл, его метаданные и производные объекты (миниатюры,
+// кэш, задачи обработки). Журнал изменений сохраняется. Возвращает
+// метаданные удаленного файла
+func (s *S3Storage) DeleteFile(ctx context.Context, fileID string) (*FileMetadata, error) {
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+
+	metadata, err := s.loadMetadata(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сначала метаданные, чтобы файл сразу исчез из списков
+	if err := s.DeleteObject(ctx, fmt.Sprintf("metadata/%s.json", fileID)); err != nil {
+		return nil, err
+	}
+	if err := s.DeleteObject(ctx, fmt.Sprintf("files/%s", fileID)); err != nil {
+		return nil, err
+	}
+
+	// Производные объекты можно пересоздать, ошибки только логируются
+	keys := []string{fmt.Sprintf("jobs/%s.json", fileID), pathIndexKey(metadata)}
+	for _, tag := range metadata.Tags {
+		keys = append(keys, tagIndexKey(tag, fileID))
+	}
+	for _, prefix := range []string{
+		fmt.Sprintf("files/%s.thumbnails/", fileID),
+		fmt.Sprintf("cache/images/%s/", fileID),
+		fmt.Sprintf("cache/archives/%s/", fileID),
+	} {
+		derived, err := s.ListKeys(ctx, prefix)
+		if err != nil {
+			log.Printf("Failed to list derived objects of file %s: %v", fileID, err)
+			continue
+		}
+		keys = append(keys, derived...)
+	}
+	for _, key := range keys {
+		if err := s.DeleteObject(ctx, key); err != nil {
+			log.Printf("Failed to delete %s: %v", key, err)
+		}
+	}
+
+	return metadata, nil
+}
+
 // FileExists проверяет существование файла в S3
 func (s *S3Storage) FileExists(ctx context.Context, fileID string) bool {
 	fileKey := fmt.Sprintf("files/%s", fileID)
@@ -209,20 +407,34 @@ func (s *S3Storage) GetFileMetadata(ctx context.Context, fileID string) (*FileMe
 
 // ListAllMetadata получает метаданные всех файлов для аналитики
 func (s *S3Storage) ListAllMetadata(ctx context.Context) ([]*FileMetadata, error) {
+	var allMetadata []*FileMetadata
+
+	err := s.WalkMetadata(ctx, func(metadata *FileMetadata) error {
+		allMetadata = append(allMetadata, metadata)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return allMetadata, nil
+}
+
+// WalkMetadata последовательно передает метаданные всех файлов в fn, не
+// загружая их в память целиком. Ошибка fn прерывает обход
+func (s *S3Storage) WalkMetadata(ctx context.Context, fn func(*FileMetadata) error) error {
 	// Список всех объектов в папке metadata/
 	listInput := &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucket),
 		Prefix: aws.String("metadata/"),
 	}
 
-	var allMetadata []*FileMetadata
-
 	// Получаем все страницы результатов
 	paginator := s3.NewListObjectsV2Paginator(s.client, listInput)
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list metadata objects: %w", err)
+			return fmt.Errorf("failed to list metadata objects: %w", err)
 		}
 
 		// Обрабатываем каждый объект метаданных
@@ -247,40 +459,11 @@ func (s *S3Storage) ListAllMetadata(ctx context.Context) ([]*FileMetadata, error
 				continue
 			}
 
-			allMetadata = append(allMetadata, metadata)
+			if err := fn(metadata); err != nil {
+				return err
+			}
 		}
 	}
 
-	return allMetadata, nil
-}
-
-// GetContentType определяет content type файла по расширению
-func GetContentType(filename string) string {
-	ext := strings.ToLower(filename)
-	switch {
-	case strings.HasSuffix(ext, ".jpg") || strings.HasSuffix(ext, ".jpeg"):
-		return "image/jpeg"
-	case strings.HasSuffix(ext, ".png"):
-		return "image/png"
-	case strings.HasSuffix(ext, ".gif"):
-		return "image/gif"
-	case strings.HasSuffix(ext, ".pdf"):
-		return "application/pdf"
-	case strings.HasSuffix(ext, ".zip"):
-		return "application/zip"
-	case strings.HasSuffix(ext, ".txt"):
-		return "text/plain"
-	case strings.HasSuffix(ext, ".json"):
-		return "application/json"
-	case strings.HasSuffix(ext, ".xml"):
-		return "application/xml"
-	case strings.HasSuffix(ext, ".html"):
-		return "text/html"
-	case strings.HasSuffix(ext, ".css"):
-		return "text/css"
-	case strings.HasSuffix(ext, ".js"):
-		return "application/javascript"
-	default:
-		return "application/octet-stream"
-	}
+	return nil
 }
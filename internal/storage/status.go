@@ -0,0 +1,26 @@
+package storage
+
+import "time"
+
+// Статусы обработки файла и отдельных обработчиков
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+)
+
+// ProcessorResult результат работы одного обработчика после загрузки
+type ProcessorResult struct {
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	Output     map[string]interface{} `json:"output,omitempty"`
+	Attempts   int                    `json:"attempts,omitempty"`
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+}
+
+// Finished проверяет, завершил ли обработчик работу (успешно или нет)
+func (r *ProcessorResult) Finished() bool {
+	return r.Status == StatusReady || r.Status == StatusFailed
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Ограничения на теги и пользовательские метаданные
+const (
+	MaxTags          = 32
+	MaxTagLength     = 64
+	MaxMetaKeys      = 32
+	MaxMetaKeyLength = 64
+	MaxMetaValueSize = 1024
+	MaxMetaTotalSize = 8 << 10
+)
+
+// ErrInvalidMetadata возвращается при нарушении ограничений на теги и метаданные
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+var (
+	metaKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	tagPattern     = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}_.:/-]*$`)
+)
+
+// NormalizeTags приводит теги к нижнему регистру, удаляет дубликаты
+// и проверяет ограничения
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength || !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: tag %q is not allowed", ErrInvalidMetadata, tag)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+
+	if len(result) > MaxTags {
+		return nil, fmt.Errorf("%w: too many tags (%d > %d)", ErrInvalidMetadata, len(result), MaxTags)
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// ParseTags разбирает список тегов, где каждое значение может содержать
+// несколько тегов через запятую
+func ParseTags(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+	return tags
+}
+
+// ValidateMeta проверяет ключи и размеры пользовательских метаданных
+func ValidateMeta(meta map[string]string) error {
+	if len(meta) > MaxMetaKeys {
+		return fmt.Errorf("%w: too many meta keys (%d > %d)", ErrInvalidMetadata, len(meta), MaxMetaKeys)
+	}
+
+	total := 0
+	for key, value := range meta {
+		if len(key) > MaxMetaKeyLength || !metaKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: meta key %q is not allowed", ErrInvalidMetadata, key)
+		}
+		if len(value) > MaxMetaValueSize {
+			return fmt.Errorf("%w: meta value for %q exceeds %d bytes", ErrInvalidMetadata, key, MaxMetaValueSize)
+		}
+		total += len(key) + len(value)
+	}
+
+	if total > MaxMetaTotalSize {
+		return fmt.Errorf("%w: meta exceeds %d bytes", ErrInvalidMetadata, MaxMetaTotalSize)
+	}
+
+	return nil
+}
+
+// HasTags проверяет, что у файла есть все указанные теги
+func (m *FileMetadata) HasTags(tags []string) bool {
+	for _, want := range tags {
+		found := false
+		for _, tag := range m.Tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterByTags оставляет только файлы, имеющие все указанные теги
+func FilterByTags(files []*FileMetadata, tags []string) []*FileMetadata {
+	if len(tags) == 0 {
+		return files
+	}
+
+	filtered := make([]*FileMetadata, 0, len(files))
+	for _, meta := range files {
+		if meta.HasTags(tags) {
+			filtered = append(filtered, meta)
+		}
+	}
+	return filtered
+}
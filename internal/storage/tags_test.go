@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	many := make([]string, MaxTags+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{"lowercase, dedupe and sort", []string{" Foo ", "foo", "bar", ""}, []string{"bar", "foo"}, false},
+		{"unicode", []string{"Отчет", "q1:2024", "a/b-c_d.e"}, []string{"a/b-c_d.e", "q1:2024", "отчет"}, false},
+		{"empty", nil, []string{}, false},
+		{"leading punctuation", []string{"-draft"}, nil, true},
+		{"inner space", []string{"two words"}, nil, true},
+		{"too long", []string{strings.Repeat("a", MaxTagLength+1)}, nil, true},
+		{"too many", many, nil, true},
+		{"duplicates do not count", append(many[:MaxTags:MaxTags], "TAG0"), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.tags)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMetadata) {
+					t.Errorf("NormalizeTags() error = %v, want ErrInvalidMetadata", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeTags() error = %v", err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got := ParseTags([]string{"a,b", "c", ""})
+	want := []string{"a", "b", "c", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTags() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateMeta(t *testing.T) {
+	many := make(map[string]string, MaxMetaKeys+1)
+	for i := 0; i <= MaxMetaKeys; i++ {
+		many[fmt.Sprintf("key%d", i)] = "v"
+	}
+	large := make(map[string]string)
+	for i := 0; i < 9; i++ {
+		large[fmt.Sprintf("key%d", i)] = strings.Repeat("v", MaxMetaValueSize)
+	}
+
+	tests := []struct {
+		name    string
+		meta    map[string]string
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"valid keys", map[string]string{"project": "alpha", "source.app_v-2": "x"}, false},
+		{"uppercase key", map[string]string{"Project": "alpha"}, true},
+		{"leading dot", map[string]string{".hidden": "x"}, true},
+		{"long key", map[string]string{strings.Repeat("k", MaxMetaKeyLength+1): "x"}, true},
+		{"long value", map[string]string{"k": strings.Repeat("v", MaxMetaValueSize+1)}, true},
+		{"too many keys", many, true},
+		{"total size", large, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMeta(tt.meta)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("ValidateMeta() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidMetadata) {
+				t.Errorf("ValidateMeta() error = %v, want ErrInvalidMetadata", err)
+			}
+		})
+	}
+}
+
+func TestFilterByTags(t *testing.T) {
+	files := []*FileMetadata{
+		{ID: "1", Tags: []string{"a", "b"}},
+		{ID: "2", Tags: []string{"a"}},
+		{ID: "3"},
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"no filter", nil, []string{"1", "2", "3"}},
+		{"single tag", []string{"a"}, []string{"1", "2"}},
+		{"all tags required", []string{"a", "b"}, []string{"1"}},
+		{"unknown tag", []string{"c"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			for _, m := range FilterByTags(files, tt.tags) {
+				ids = append(ids, m.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("FilterByTags() = %q, want %q", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"file-agent/internal/imaging"
+	"file-agent/internal/storage"
+)
+
+// ProcessorName имя обработчика миниатюр
+const ProcessorName = "thumbnails"
+
+// maxSourceSize максимальный размер исходного изображения для миниатюр
+const maxSourceSize = 64 << 20
+
+// jpegQuality качество JPEG-миниатюр
+const jpegQuality = 85
+
+// Key возвращает ключ миниатюры рядом с файлом files/{id}
+func Key(fileID string, size int) string {
+	return fmt.Sprintf("files/%s.thumbnails/%d", fileID, size)
+}
+
+// ParseSizes разбирает список размеров вида "128,256,512"
+func ParseSizes(spec string) ([]int, error) {
+	var sizes []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		size, err := strconv.Atoi(part)
+		if err != nil || size < 16 || size > 4096 {
+			return nil, fmt.Errorf("invalid thumbnail size %q", part)
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// ChooseSize выбирает наименьший доступный размер не меньше запрошенного,
+// а если такого нет - наибольший
+func ChooseSize(sizes []int, requested int) int {
+	for _, size := range sizes {
+		if size >= requested {
+			return size
+		}
+	}
+	return sizes[len(sizes)-1]
+}
+
+// Processor создает миниатюры изображений после загрузки
+type Processor struct {
+	store *storage.S3Storage
+	sizes []int
+}
+
+// NewProcessor создает обработчик миниатюр указанных размеров
+func NewProcessor(store *storage.S3Storage, sizes []int) *Processor {
+	return &Processor{
+		store: store,
+		sizes: sizes,
+	}
+}
+
+// Name возвращает имя обработчика
+func (p *Processor) Name() string {
+	return ProcessorName
+}
+
+// Supports проверяет, является ли файл поддерживаемым изображением
+func (p *Processor) Supports(file *storage.FileMetadata) bool {
+	return imaging.Supports(file.ContentType) && file.Size <= maxSourceSize
+}
+
+// Process создает миниатюры всех размеров
+func (p *Processor) Process(ctx context.Context, file *storage.FileMetadata) (map[string]interface{}, error) {
+	reader, _, err := p.store.GetFile(ctx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxSourceSize))
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Прозрачные изображения сохраняются в PNG, остальные в JPEG
+	format := imaging.FormatJPEG
+	if imaging.HasAlpha(img) {
+		format = imaging.FormatPNG
+	}
+
+	for _, size := range p.sizes {
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, imaging.Fit(img, size, size), format, jpegQuality); err != nil {
+			return nil, fmt.Errorf("failed to encode %d thumbnail: %w", size, err)
+		}
+		if err := p.store.PutObject(ctx, Key(file.ID, size), buf.Bytes(), imaging.ContentType(format)); err != nil {
+			return nil, err
+		}
+	}
+
+	bounds := img.Bounds()
+	return map[string]interface{}{
+		"sizes":  p.sizes,
+		"format": format,
+		"width":  bounds.Dx(),
+		"height": bounds.Dy(),
+	}, nil
+}
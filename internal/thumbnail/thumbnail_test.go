@@ -0,0 +1,61 @@
+package thumbnail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSizes(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{"128,256,512", []int{128, 256, 512}, false},
+		{" 512 , 128,,256 ", []int{128, 256, 512}, false},
+		{"", nil, false},
+		{"16,4096", []int{16, 4096}, false},
+		{"15", nil, true},
+		{"4097", nil, true},
+		{"128,big", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseSizes(tt.spec)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ParseSizes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSizes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseSize(t *testing.T) {
+	sizes := []int{128, 256, 512}
+
+	tests := []struct {
+		requested int
+		want      int
+	}{
+		{1, 128},
+		{128, 128},
+		{129, 256},
+		{512, 512},
+		{2000, 512},
+	}
+
+	for _, tt := range tests {
+		if got := ChooseSize(sizes, tt.requested); got != tt.want {
+			t.Errorf("ChooseSize(%d) = %d, want %d", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	if got := Key("abc", 256); got != "files/abc.thumbnails/256" {
+		t.Errorf("Key() = %q", got)
+	}
+}
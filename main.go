@@ -7,12 +7,21 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"file-agent/internal/analytics"
+	"file-agent/internal/bandwidth"
 	"file-agent/internal/handlers"
+	"file-agent/internal/metrics"
 	"file-agent/internal/middleware"
+	"file-agent/internal/policy"
+	"file-agent/internal/processing"
+	"file-agent/internal/quota"
+	"file-agent/internal/scanner"
 	"file-agent/internal/storage"
+	"file-agent/internal/thumbnail"
 
 	"github.com/gorilla/mux"
 )
@@ -56,15 +65,213 @@ func main() {
 		}
 	}
 
+	// Количество доверенных прокси перед сервисом (ingress, прокси аутентификации)
+	trustedProxies := 0
+	if proxiesStr := os.Getenv("TRUSTED_PROXIES"); proxiesStr != "" {
+		if n, err := strconv.Atoi(proxiesStr); err == nil && n >= 0 {
+			trustedProxies = n
+		} else {
+			log.Printf("Invalid TRUSTED_PROXIES value: %s, using default: %d", proxiesStr, trustedProxies)
+		}
+	}
+
+	// Дополнительные MIME-типы по расширениям
+	if mimeTypes := os.Getenv("MIME_TYPES"); mimeTypes != "" {
+		if err := storage.LoadContentTypes(mimeTypes); err != nil {
+			log.Fatalf("Invalid MIME_TYPES value: %v", err)
+		}
+	}
+	if mimeTypesFile := os.Getenv("MIME_TYPES_FILE"); mimeTypesFile != "" {
+		if err := storage.LoadContentTypesFile(mimeTypesFile); err != nil {
+			log.Fatalf("Failed to load MIME_TYPES_FILE: %v", err)
+		}
+	}
+
 	// Создаем S3 storage
 	s3Storage, err := storage.NewS3Storage(s3Endpoint, accessKey, secretKey, bucket)
 	if err != nil {
 		log.Fatalf("Failed to initialize S3 storage: %v", err)
 	}
 
+	// Антивирусная проверка через clamd (опционально)
+	var clamd *scanner.Client
+	if clamdAddress := os.Getenv("CLAMD_ADDRESS"); clamdAddress != "" {
+		clamdTimeout := 60 * time.Second
+		if timeoutStr := os.Getenv("CLAMD_TIMEOUT"); timeoutStr != "" {
+			if timeout, err := time.ParseDuration(timeoutStr); err == nil && timeout > 0 {
+				clamdTimeout = timeout
+			} else {
+				log.Printf("Invalid CLAMD_TIMEOUT value: %s, using default: %s", timeoutStr, clamdTimeout)
+			}
+		}
+
+		clamd, err = scanner.NewClient(clamdAddress, clamdTimeout)
+		if err != nil {
+			log.Fatalf("Failed to initialize clamd client: %v", err)
+		}
+		if err := clamd.Ping(context.Background()); err != nil {
+			log.Printf("clamd is not reachable at %s: %v", clamdAddress, err)
+		}
+	}
+
+	// Административные команды выполняются вместо запуска сервера
+	if len(os.Args) > 1 {
+		env := commandEnv{storage: s3Storage, internalPort: os.Getenv("INTERNAL_PORT")}
+		if err := runCommand(env, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("Command %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	// Индексы путей и тегов для файлов, загруженных до их появления
+	if err := s3Storage.EnsureIndexes(context.Background()); err != nil {
+		log.Fatalf("Failed to build file indexes: %v", err)
+	}
+
+	// Обработчики, выполняемые после загрузки
+	var processors []processing.Processor
+
 	// Инициализируем хендлеры
 	fileHandler := handlers.NewFileHandler(s3Storage, maxFileSize)
-	analyticsHandler := handlers.NewAnalyticsHandler(s3Storage)
+	if clamd != nil {
+		scanMode := os.Getenv("SCAN_MODE")
+		if scanMode == "" {
+			scanMode = scanner.ModeReject // значение по умолчанию
+		}
+		switch scanMode {
+		case scanner.ModeReject, scanner.ModeQuarantine:
+			fileHandler.SetScanner(clamd, scanMode)
+		case scanner.ModeAsync:
+			processors = append(processors, scanner.NewProcessor(s3Storage, clamd))
+		default:
+			log.Fatalf("Invalid SCAN_MODE value: %s", scanMode)
+		}
+	}
+
+	// Повторная проверка выполняется сервисом, чтобы обновления метаданных
+	// сериализовались вместе с остальными
+	var rescanner *scanner.Rescanner
+	if clamd != nil {
+		rescanner = scanner.NewRescanner(s3Storage, clamd)
+	}
+
+	// Миниатюры изображений
+	thumbnailSizes := []int{128, 256, 512} // значение по умолчанию
+	if sizesStr, ok := os.LookupEnv("THUMBNAIL_SIZES"); ok {
+		thumbnailSizes, err = thumbnail.ParseSizes(sizesStr)
+		if err != nil {
+			log.Fatalf("Invalid THUMBNAIL_SIZES value: %v", err)
+		}
+	}
+	if len(thumbnailSizes) > 0 {
+		processors = append(processors, thumbnail.NewProcessor(s3Storage, thumbnailSizes))
+	}
+
+	// Ограничение на размеры результата преобразования изображений
+	maxImageDimension := 2048 // значение по умолчанию
+	if dimensionStr := os.Getenv("MAX_IMAGE_DIMENSION"); dimensionStr != "" {
+		if n, err := strconv.Atoi(dimensionStr); err == nil && n > 0 {
+			maxImageDimension = n
+		} else {
+			log.Printf("Invalid MAX_IMAGE_DIMENSION value: %s, using default: %d", dimensionStr, maxImageDimension)
+		}
+	}
+
+	// Очередь обработки запускается, только если есть обработчики
+	var queue *processing.Queue
+	if len(processors) > 0 {
+		workers := 2 // значение по умолчанию
+		if workersStr := os.Getenv("PROCESSING_WORKERS"); workersStr != "" {
+			if n, err := strconv.Atoi(workersStr); err == nil && n > 0 {
+				workers = n
+			} else {
+				log.Printf("Invalid PROCESSING_WORKERS value: %s, using default: %d", workersStr, workers)
+			}
+		}
+
+		queue = processing.NewQueue(s3Storage, workers, processors...)
+		if err := queue.Start(); err != nil {
+			log.Printf("Failed to resume processing jobs: %v", err)
+		}
+		fileHandler.SetQueue(queue)
+	}
+	// Удаление EXIF/XMP из изображений при загрузке
+	if stripStr := os.Getenv("STRIP_IMAGE_METADATA"); stripStr != "" {
+		strip, err := strconv.ParseBool(stripStr)
+		if err != nil {
+			log.Fatalf("Invalid STRIP_IMAGE_METADATA value: %s", stripStr)
+		}
+		fileHandler.SetStripMetadata(strip)
+	}
+	if policyFile := os.Getenv("UPLOAD_POLICY_FILE"); policyFile != "" {
+		uploadPolicy, err := policy.Load(policyFile)
+		if err != nil {
+			log.Fatalf("Failed to load upload policy: %v", err)
+		}
+		fileHandler.SetUploadPolicy(uploadPolicy)
+		log.Printf("Upload policy loaded from %s (%d rules)", policyFile, len(uploadPolicy.Rules))
+	}
+
+	// Статистика поддерживается инкрементально и сохраняется в бакет
+	// ведущим экземпляром; остальные работают ведомыми
+	aggregates := analytics.NewStore(s3Storage)
+	if err := aggregates.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load analytics aggregates: %v", err)
+	}
+	aggregates.Start()
+	fileHandler.SetAnalytics(aggregates)
+
+	// Квоты авторов загрузок считаются по статистике файлов
+	if quotaFile := os.Getenv("QUOTA_FILE"); quotaFile != "" {
+		quotaConfig, err := quota.Load(quotaFile)
+		if err != nil {
+			log.Fatalf("Failed to load quotas: %v", err)
+		}
+		fileHandler.SetQuotas(quota.New(quotaConfig, aggregates))
+		log.Printf("Quotas loaded from %s (%d user overrides)", quotaFile, len(quotaConfig.Users))
+	}
+
+	// Ограничение скорости отдачи файлов в байтах в секунду
+	egressLimits := bandwidth.Limits{
+		Global:  rateFromEnv("EGRESS_RATE_LIMIT"),
+		PerIP:   rateFromEnv("EGRESS_RATE_LIMIT_PER_IP"),
+		PerUser: rateFromEnv("EGRESS_RATE_LIMIT_PER_USER"),
+		PerFile: rateFromEnv("EGRESS_RATE_LIMIT_PER_FILE"),
+	}
+	var throttle *bandwidth.Throttle
+	if egressLimits != (bandwidth.Limits{}) {
+		throttle = bandwidth.NewThrottle(egressLimits)
+		fileHandler.SetThrottle(throttle)
+		log.Printf("Egress rate limits (bytes/s): global %d, per IP %d, per user %d, per file %d",
+			egressLimits.Global, egressLimits.PerIP, egressLimits.PerUser, egressLimits.PerFile)
+	}
+
+	// Общие показатели хранилища для /metrics
+	metrics.Default.NewGaugeFunc("file_agent_files", "Number of stored files.", func() float64 {
+		return float64(aggregates.Totals().FileCount)
+	})
+	metrics.Default.NewGaugeFunc("file_agent_stored_bytes", "Total size of stored files in bytes.", func() float64 {
+		return float64(aggregates.Totals().TotalSize)
+	})
+
+	// Ежедневные снимки статистики для отчетов о росте хранилища
+	history := analytics.NewHistory(s3Storage, aggregates)
+	history.Start()
+
+	analyticsHandler := handlers.NewAnalyticsHandler(s3Storage, aggregates)
+	analyticsHandler.SetHistory(history)
+	folderHandler := handlers.NewFolderHandler(s3Storage)
+	archiveHandler := handlers.NewArchiveHandler(s3Storage)
+	archiveHandler.SetThrottle(throttle)
+	previewHandler := handlers.NewPreviewHandler(s3Storage)
+	imageHandler := handlers.NewImageHandler(s3Storage, thumbnailSizes, maxImageDimension)
+	imageHandler.SetThrottle(throttle)
+	imageHandler.SetAnalytics(aggregates)
+	imageHandler.SetVariants(
+		intListFromEnv("IMAGE_SIZES", handlers.DefaultImageSizes, 1, maxImageDimension),
+		intListFromEnv("IMAGE_QUALITIES", handlers.DefaultImageQualities, 1, 100),
+	)
+	scanHandler := handlers.NewScanHandler(rescanner)
 	infoHandler := handlers.NewInfoHandler()
 
 	// Настраиваем роутер
@@ -73,6 +280,9 @@ func main() {
 	// Применяем CORS middleware
 	r.Use(middleware.CORSMiddleware)
 
+	// Аутентифицированный пользователь из заголовка доверенного прокси
+	r.Use(middleware.IdentityMiddleware(trustedProxies))
+
 	// Health check роуты для Kubernetes (должны быть первыми)
 	r.HandleFunc("/health", healthCheck).Methods("GET")
 	r.HandleFunc("/ready", readinessCheck).Methods("GET")
@@ -80,14 +290,39 @@ func main() {
 	// API роуты (порядок важен - более специфичные роуты должны быть первыми)
 	r.HandleFunc("/", fileHandler.UploadFile).Methods("POST", "OPTIONS")
 	r.HandleFunc("/analytics", analyticsHandler.GetAnalytics).Methods("GET", "OPTIONS")
+	r.HandleFunc("/analytics/history", analyticsHandler.GetHistory).Methods("GET", "OPTIONS")
+	r.HandleFunc("/analytics/users", analyticsHandler.ListUsers).Methods("GET", "OPTIONS")
+	r.HandleFunc("/analytics/users/{user}", analyticsHandler.GetUser).Methods("GET", "OPTIONS")
+	r.HandleFunc("/quota", fileHandler.GetQuota).Methods("GET", "OPTIONS")
 	r.HandleFunc("/info", infoHandler.GetInfo).Methods("GET", "OPTIONS")
+	r.HandleFunc("/files", fileHandler.ListFiles).Methods("GET", "OPTIONS")
+	r.HandleFunc("/export/metadata", fileHandler.ExportMetadata).Methods("GET", "OPTIONS")
 	r.HandleFunc("/metadata/{id}", fileHandler.GetFileMetadata).Methods("GET", "OPTIONS")
+	r.HandleFunc("/metadata/{id}", fileHandler.UpdateFileMetadata).Methods("PATCH")
+	r.HandleFunc("/metadata/{id}/history", fileHandler.GetMetadataHistory).Methods("GET", "OPTIONS")
+	r.HandleFunc("/folders", folderHandler.ListFolder).Methods("GET", "OPTIONS")
+	r.HandleFunc("/folders", folderHandler.CreateFolder).Methods("POST")
+	r.HandleFunc("/folders/{id}", folderHandler.GetFolder).Methods("GET", "OPTIONS")
+	r.HandleFunc("/folders/{id}", folderHandler.UpdateFolder).Methods("PATCH")
+	r.HandleFunc("/scan/rescan", scanHandler.GetRescan).Methods("GET", "OPTIONS")
+	r.HandleFunc("/scan/rescan", scanHandler.StartRescan).Methods("POST")
+	r.HandleFunc("/path/{path:.*}", fileHandler.DownloadFileByPath).Methods("GET", "OPTIONS")
+	r.HandleFunc("/{id}/thumbnail", imageHandler.GetThumbnail).Methods("GET", "OPTIONS")
+	r.HandleFunc("/{id}/image", imageHandler.TransformImage).Methods("GET", "OPTIONS")
+	r.HandleFunc("/{id}/preview", previewHandler.GetPreview).Methods("GET", "OPTIONS")
+	r.HandleFunc("/{id}/archive/entries", archiveHandler.ListEntries).Methods("GET", "OPTIONS")
+	r.HandleFunc("/{id}/archive/entries/{path:.+}", archiveHandler.GetEntry).Methods("GET", "OPTIONS")
 	r.HandleFunc("/{id}", fileHandler.DownloadFile).Methods("GET", "OPTIONS")
+	r.HandleFunc("/{id}", fileHandler.DeleteFile).Methods("DELETE")
+
+	// Метрики запросов по маршрутам, включая запросы без маршрута (404, 405)
+	handler := middleware.MetricsMiddleware(r)(r)
 
-	// Настраиваем сервер
+	// Настраиваем сервер. Скачивания продлевают срок записи сами,
+	// WriteTimeout ограничивает остальные ответы
 	srv := &http.Server{
 		Addr:         ":" + port,
-		Handler:      r,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -101,6 +336,31 @@ func main() {
 		}
 	}()
 
+	// Внутренний порт обслуживает те же роуты, но запросы помечаются
+	// областью internal для политики загрузки. Метрики Prometheus
+	// отдаются только на нем
+	var internalSrv *http.Server
+	if internalPort := os.Getenv("INTERNAL_PORT"); internalPort != "" {
+		internalMux := http.NewServeMux()
+		internalMux.Handle("/metrics", metrics.Default.Handler())
+		internalMux.Handle("/", handler)
+
+		internalSrv = &http.Server{
+			Addr:         ":" + internalPort,
+			Handler:      middleware.ScopeMiddleware(middleware.ScopeInternal)(internalMux),
+			ReadTimeout:  srv.ReadTimeout,
+			WriteTimeout: srv.WriteTimeout,
+			IdleTimeout:  srv.IdleTimeout,
+		}
+
+		go func() {
+			log.Printf("Internal server starting on :%s", internalPort)
+			if err := internalSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Internal server failed to start: %v", err)
+			}
+		}()
+	}
+
 	// Ожидаем сигнал для graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -112,10 +372,28 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if internalSrv != nil {
+		if err := internalSrv.Shutdown(ctx); err != nil {
+			log.Printf("Internal server forced to shutdown: %v", err)
+		}
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Останавливаем обработку; незавершенные задачи продолжатся после перезапуска
+	if queue != nil {
+		queue.Stop()
+	}
+	if rescanner != nil {
+		rescanner.Stop()
+	}
+
+	// Сохраняем последние изменения статистики
+	history.Stop()
+	aggregates.Stop()
+
 	log.Println("Server exited")
 }
 
@@ -130,3 +408,35 @@ func readinessCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Ready"))
 }
+
+// rateFromEnv читает ограничение скорости в байтах в секунду; 0 - без ограничения
+func rateFromEnv(name string) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	rate, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || rate < 0 {
+		log.Printf("Invalid %s value: %s, rate limit disabled", name, value)
+		return 0
+	}
+	return rate
+}
+
+// intListFromEnv читает список чисел вида "64,128,256" в диапазоне [min, max]
+func intListFromEnv(name string, def []int, min, max int) []int {
+	value, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(value) == "" {
+		return def
+	}
+
+	var list []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < min || n > max {
+			log.Fatalf("Invalid %s value: %s (expected numbers from %d to %d)", name, value, min, max)
+		}
+		list = append(list, n)
+	}
+	return list
+}